@@ -4,12 +4,15 @@ package main
 import (
 	"context"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 	"time"
 
 	"github.com/Bitlatte/evoke/pkg/build"
 	init_pkg "github.com/Bitlatte/evoke/pkg/init"
 	"github.com/Bitlatte/evoke/pkg/logger"
+	"github.com/Bitlatte/evoke/pkg/plugins"
 	"github.com/Bitlatte/evoke/pkg/serve"
 	"github.com/charmbracelet/log"
 	"github.com/urfave/cli/v3"
@@ -17,6 +20,23 @@ import (
 
 var version = "dev"
 
+// Flags selecting which unpublished pages are included, shared by the build
+// and serve commands.
+var (
+	draftsFlag = &cli.BoolFlag{
+		Name:  "drafts",
+		Usage: "Include pages marked as drafts",
+	}
+	futureFlag = &cli.BoolFlag{
+		Name:  "future",
+		Usage: "Include pages with a publish date in the future",
+	}
+	expiredFlag = &cli.BoolFlag{
+		Name:  "expired",
+		Usage: "Include pages with an expiry date in the past",
+	}
+)
+
 // main is the entry point for the evoke command. It sets up the CLI commands
 // and executes them.
 func main() {
@@ -42,13 +62,30 @@ func main() {
 						Value: runtime.NumCPU(),
 						Usage: "Number of worker goroutines to use for processing content",
 					},
+					&cli.BoolFlag{
+						Name:  "strict-links",
+						Usage: "Fail the build when broken internal links are found",
+					},
+					&cli.BoolFlag{
+						Name:  "minify",
+						Usage: "Minify the generated HTML, CSS, JavaScript, SVG and JSON files",
+					},
+					draftsFlag,
+					futureFlag,
+					expiredFlag,
 				},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
 					if cmd.Bool("verbose") {
 						logger.Logger.SetLevel(log.DebugLevel)
 					}
 					start := time.Now()
-					err := build.Build("dist", cmd.Bool("clean"), cmd.Int("workers"))
+					err := build.Build("dist", cmd.Bool("clean"), cmd.Int("workers"), build.Options{
+						StrictLinks: cmd.Bool("strict-links"),
+						Minify:      cmd.Bool("minify"),
+						Drafts:      cmd.Bool("drafts"),
+						Future:      cmd.Bool("future"),
+						Expired:     cmd.Bool("expired"),
+					})
 					if err != nil {
 						logger.Logger.Error("Build failed", "error", err)
 						return err
@@ -67,6 +104,9 @@ func main() {
 						Value: 8990,
 						Usage: "port to serve the site on",
 					},
+					draftsFlag,
+					futureFlag,
+					expiredFlag,
 				},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
 					port := cmd.Value("port").(int)
@@ -74,7 +114,11 @@ func main() {
 						logger.Logger.SetLevel(log.DebugLevel)
 					}
 					logger.Logger.Info("Starting server...", "port", port)
-					return serve.Serve(port)
+					return serve.Serve(port, build.Options{
+						Drafts:  cmd.Bool("drafts"),
+						Future:  cmd.Bool("future"),
+						Expired: cmd.Bool("expired"),
+					})
 				},
 			},
 			{
@@ -84,9 +128,29 @@ func main() {
 					return init_pkg.Run()
 				},
 			},
+			pluginCommand(),
+			{
+				// Plugins with resource limits are started through evoke,
+				// which applies them before running the plugin
+				Name:            plugins.ExecCommand,
+				Hidden:          true,
+				SkipFlagParsing: true,
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return plugins.ExecLimited(cmd.Args().Slice())
+				},
+			},
 		},
 	}
 
+	// Stop the plugin processes when evoke is interrupted
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		plugins.KillAll()
+		os.Exit(1)
+	}()
+
 	if err := cmd.Run(context.Background(), os.Args); err != nil {
 		logger.Logger.Fatal(err)
 	}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Bitlatte/evoke/pkg/logger"
+	"github.com/Bitlatte/evoke/pkg/plugins"
+	"github.com/urfave/cli/v3"
+)
+
+// pluginsDir is the directory plugins are installed in.
+const pluginsDir = "plugins"
+
+// pluginCommand returns the command managing the installed plugins and the
+// lockfile recording them.
+func pluginCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "plugin",
+		Usage: "Manage the plugins of the project",
+		Commands: []*cli.Command{
+			{
+				Name:      "add",
+				Usage:     "Install a plugin from an executable, a WebAssembly module or an archive and lock it",
+				ArgsUsage: "<path>",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					if cmd.Args().Len() != 1 {
+						return fmt.Errorf("expected the path of the plugin to install")
+					}
+					lock, err := plugins.ReadLock(plugins.LockFile)
+					if err != nil {
+						return err
+					}
+					p, err := plugins.Install(cmd.Args().First(), pluginsDir)
+					if err != nil {
+						return err
+					}
+					lock.Set(p)
+					if err := lock.Write(plugins.LockFile); err != nil {
+						return err
+					}
+					logger.Logger.Info("Plugin installed", "name", p.Name, "version", p.Version, "path", p.Path)
+					return nil
+				},
+			},
+			{
+				Name:      "remove",
+				Usage:     "Uninstall a plugin and remove it from the lockfile",
+				ArgsUsage: "<name>",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					if cmd.Args().Len() != 1 {
+						return fmt.Errorf("expected the name of the plugin to remove")
+					}
+					name := cmd.Args().First()
+					lock, err := plugins.ReadLock(plugins.LockFile)
+					if err != nil {
+						return err
+					}
+					p := lock.Find(name)
+					if p == nil {
+						return fmt.Errorf("plugin %s isn't in %s", name, plugins.LockFile)
+					}
+					if err := plugins.Uninstall(*p, pluginsDir); err != nil {
+						return err
+					}
+					lock.Remove(name)
+					if err := lock.Write(plugins.LockFile); err != nil {
+						return err
+					}
+					logger.Logger.Info("Plugin removed", "name", name)
+					return nil
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "List the installed plugins",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					statuses, err := pluginStatuses()
+					if err != nil {
+						return err
+					}
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(w, "NAME\tVERSION\tSTATUS\tPATH")
+					for _, s := range statuses {
+						fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Name, s.Version, s.Status, s.Path)
+					}
+					return w.Flush()
+				},
+			},
+			{
+				Name:  "verify",
+				Usage: "Check the installed plugins against the lockfile",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					statuses, err := pluginStatuses()
+					if err != nil {
+						return err
+					}
+					failed := 0
+					for _, s := range statuses {
+						switch s.Status {
+						case plugins.StatusOK:
+							logger.Logger.Info("Plugin verified", "name", s.Name, "version", s.Version)
+						case plugins.StatusUnlocked:
+							logger.Logger.Warn("Plugin isn't in "+plugins.LockFile, "name", s.Name, "path", s.Path)
+						default:
+							logger.Logger.Error("Plugin doesn't match "+plugins.LockFile, "name", s.Name, "status", s.Status)
+							failed++
+						}
+					}
+					if failed > 0 {
+						return fmt.Errorf("%d plugins don't match %s", failed, plugins.LockFile)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// pluginStatuses returns the status of the plugins of the project.
+func pluginStatuses() ([]plugins.PluginStatus, error) {
+	lock, err := plugins.ReadLock(plugins.LockFile)
+	if err != nil {
+		return nil, err
+	}
+	return plugins.Status(pluginsDir, lock)
+}
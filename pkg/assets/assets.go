@@ -0,0 +1,270 @@
+// Package assets fingerprints the files copied from the public directory, so
+// that they can be cached forever and still be updated by a deploy.
+package assets
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ManifestFile is the name of the manifest written to the output directory.
+const ManifestFile = "manifest.json"
+
+// hashLength is the number of hexadecimal digits of the hash added to the
+// names of fingerprinted files.
+const hashLength = 8
+
+// Asset is a file copied from the public directory.
+type Asset struct {
+	// File is the path of the file in the output directory, which includes
+	// the hash of its content if it's fingerprinted.
+	File string `json:"file"`
+	// Integrity is the Subresource Integrity hash of the file.
+	Integrity string `json:"integrity"`
+}
+
+// Manifest maps the paths of the files of the public directory to the files
+// they were copied to. Paths are relative to the public directory and use
+// forward slashes, e.g. css/style.css.
+type Manifest map[string]Asset
+
+// Fingerprint indexes the files copied from the public directory to the
+// output directory and renames the ones matching one of the patterns after
+// their content, e.g. css/style.css to css/style.3f9a1c2b.css. Patterns are
+// relative to the public directory and may use ** to match any number of
+// directories.
+//
+// The manifest is written to the output directory if any patterns are given.
+// Fingerprinted files and manifests left over by previous builds are removed.
+// Files that weren't copied again since the previous build are looked up
+// under the name they were fingerprinted to, and renamed back if they no
+// longer match a pattern.
+func Fingerprint(publicDir, outputDir string, patterns []string) (Manifest, error) {
+	manifest := make(Manifest)
+	if _, err := os.Stat(publicDir); os.IsNotExist(err) {
+		return manifest, nil
+	}
+
+	previous, err := ReadManifest(filepath.Join(outputDir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.Walk(publicDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(publicDir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		// A file the copy left alone is still under the name the previous
+		// build fingerprinted it to
+		current := filepath.Join(outputDir, rel)
+		if _, err := os.Stat(current); os.IsNotExist(err) && previous[name].File != "" {
+			current = filepath.Join(outputDir, filepath.FromSlash(previous[name].File))
+		}
+
+		// The file may have been changed by plugins once copied
+		content, err := os.ReadFile(current)
+		if err != nil {
+			return fmt.Errorf("error reading asset %s: %w", name, err)
+		}
+		integrity := sha512.Sum384(content)
+		asset := Asset{
+			File:      name,
+			Integrity: "sha384-" + base64.StdEncoding.EncodeToString(integrity[:]),
+		}
+		if MatchAny(patterns, name) {
+			sum := sha256.Sum256(content)
+			asset.File = fingerprintedName(name, hex.EncodeToString(sum[:])[:hashLength])
+		}
+		if dest := filepath.Join(outputDir, filepath.FromSlash(asset.File)); current != dest {
+			if err := os.Rename(current, dest); err != nil {
+				return fmt.Errorf("error fingerprinting asset %s: %w", name, err)
+			}
+		}
+		manifest[name] = asset
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove the fingerprinted files of previous builds
+	current := make(map[string]bool, len(manifest))
+	for _, asset := range manifest {
+		current[asset.File] = true
+	}
+	for name, asset := range previous {
+		if asset.File == name || current[asset.File] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(outputDir, filepath.FromSlash(asset.File))); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error removing stale asset %s: %w", asset.File, err)
+		}
+	}
+
+	manifestPath := filepath.Join(outputDir, ManifestFile)
+	if len(patterns) == 0 {
+		if err := os.Remove(manifestPath); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error removing manifest: %w", err)
+		}
+		return manifest, nil
+	}
+	if err := manifest.Write(manifestPath); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// fingerprintedName inserts the hash before the extension of the file name.
+func fingerprintedName(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// ReadManifest reads the manifest at path. A missing manifest is empty.
+func ReadManifest(path string) (Manifest, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Manifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest: %w", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("error parsing manifest %s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// Write writes the manifest to path.
+func (m Manifest) Write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing manifest: %w", err)
+	}
+	return nil
+}
+
+// URL returns the URL of the file copied from the public directory at path,
+// e.g. /css/style.3f9a1c2b.css for css/style.css.
+func (m Manifest) URL(path string) (string, error) {
+	asset, err := m.find(path)
+	if err != nil {
+		return "", err
+	}
+	return "/" + asset.File, nil
+}
+
+// Integrity returns the Subresource Integrity hash of the file copied from
+// the public directory at path, for the integrity attribute of script and
+// link elements.
+func (m Manifest) Integrity(path string) (string, error) {
+	asset, err := m.find(path)
+	if err != nil {
+		return "", err
+	}
+	return asset.Integrity, nil
+}
+
+// find returns the asset at path, with or without a leading slash.
+func (m Manifest) find(path string) (Asset, error) {
+	asset, ok := m[strings.TrimPrefix(path, "/")]
+	if !ok {
+		return Asset{}, fmt.Errorf("asset %s not found in the public directory", path)
+	}
+	return asset, nil
+}
+
+// Hash returns a hash of the manifest, which changes whenever a
+// fingerprinted file does.
+func (m Manifest) Hash() string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s %s %s\n", name, m[name].File, m[name].Integrity)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Funcs returns the template functions resolving assets. asset returns the
+// URL of a file, and integrity the Subresource Integrity attributes of the
+// element loading it:
+//
+//	<link rel="stylesheet" href="{{ asset "css/style.css" }}" {{ integrity "css/style.css" }}>
+func (m Manifest) Funcs() template.FuncMap {
+	return template.FuncMap{
+		"asset": m.URL,
+		"integrity": func(path string) (template.HTMLAttr, error) {
+			integrity, err := m.Integrity(path)
+			if err != nil {
+				return "", err
+			}
+			return template.HTMLAttr(fmt.Sprintf(`integrity="%s" crossorigin="anonymous"`, integrity)), nil
+		},
+	}
+}
+
+// MatchAny reports whether the slash-separated path matches any of the
+// patterns.
+func MatchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if Match(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether the slash-separated path matches the pattern. The
+// pattern has the syntax of path.Match, and a ** element matches any number
+// of directories. Malformed patterns match nothing.
+func Match(pattern, name string) bool {
+	return matchParts(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchParts matches the elements of a path against the elements of a
+// pattern.
+func matchParts(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchParts(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,103 @@
+package assets_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitlatte/evoke/pkg/assets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	// Arrange
+	tmpDir := t.TempDir()
+	publicDir := filepath.Join(tmpDir, "public")
+	outputDir := filepath.Join(tmpDir, "dist")
+	for _, dir := range []string{publicDir, outputDir} {
+		os.MkdirAll(filepath.Join(dir, "css"), 0755)
+		os.WriteFile(filepath.Join(dir, "css", "style.css"), []byte("body { color: red; }"), 0644)
+		os.WriteFile(filepath.Join(dir, "robots.txt"), []byte("User-agent: *"), 0644)
+	}
+
+	// Act
+	manifest, err := assets.Fingerprint(publicDir, outputDir, []string{"css/**/*.css"})
+
+	// Assert
+	require.NoError(t, err)
+	url, err := manifest.URL("css/style.css")
+	require.NoError(t, err)
+	assert.Regexp(t, `^/css/style\.[0-9a-f]{8}\.css$`, url)
+	assert.FileExists(t, filepath.Join(outputDir, filepath.FromSlash(url)))
+	assert.NoFileExists(t, filepath.Join(outputDir, "css", "style.css"))
+
+	integrity, err := manifest.Integrity("/css/style.css")
+	require.NoError(t, err)
+	assert.Regexp(t, `^sha384-[A-Za-z0-9+/]{64}$`, integrity)
+
+	url, err = manifest.URL("robots.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "/robots.txt", url)
+
+	_, err = manifest.URL("missing.css")
+	assert.Error(t, err)
+
+	written, err := assets.ReadManifest(filepath.Join(outputDir, assets.ManifestFile))
+	require.NoError(t, err)
+	assert.Equal(t, manifest, written)
+}
+
+func TestFingerprint_RemovesStaleFiles(t *testing.T) {
+	// Arrange
+	tmpDir := t.TempDir()
+	publicDir := filepath.Join(tmpDir, "public")
+	outputDir := filepath.Join(tmpDir, "dist")
+	copyStyle := func(content string) {
+		for _, dir := range []string{publicDir, outputDir} {
+			os.MkdirAll(dir, 0755)
+			os.WriteFile(filepath.Join(dir, "style.css"), []byte(content), 0644)
+		}
+	}
+	copyStyle("a")
+	first, err := assets.Fingerprint(publicDir, outputDir, []string{"*.css"})
+	require.NoError(t, err)
+
+	// Act
+	copyStyle("b")
+	second, err := assets.Fingerprint(publicDir, outputDir, []string{"*.css"})
+
+	// Assert
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Hash(), second.Hash())
+	assert.NoFileExists(t, filepath.Join(outputDir, first["style.css"].File))
+	assert.FileExists(t, filepath.Join(outputDir, second["style.css"].File))
+
+	// Turning fingerprinting off removes the manifest
+	copyStyle("b")
+	_, err = assets.Fingerprint(publicDir, outputDir, nil)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(outputDir, assets.ManifestFile))
+	assert.NoFileExists(t, filepath.Join(outputDir, second["style.css"].File))
+	assert.FileExists(t, filepath.Join(outputDir, "style.css"))
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.css", "style.css", true},
+		{"*.css", "css/style.css", false},
+		{"css/*.css", "css/style.css", true},
+		{"css/**/*.css", "css/style.css", true},
+		{"css/**/*.css", "css/vendor/lib/reset.css", true},
+		{"**/*.js", "app.js", true},
+		{"**/*.js", "js/app.css", false},
+		{"[", "[", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, assets.Match(tt.pattern, tt.path), "%s %s", tt.pattern, tt.path)
+	}
+}
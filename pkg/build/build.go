@@ -4,44 +4,77 @@ package build
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"html/template"
 
 	"gopkg.in/yaml.v3"
 
+	"github.com/Bitlatte/evoke/pkg/assets"
+	"github.com/Bitlatte/evoke/pkg/bundle"
 	"github.com/Bitlatte/evoke/pkg/cache"
 	"github.com/Bitlatte/evoke/pkg/config"
 	"github.com/Bitlatte/evoke/pkg/content"
 	"github.com/Bitlatte/evoke/pkg/dag"
+	"github.com/Bitlatte/evoke/pkg/data"
 	"github.com/Bitlatte/evoke/pkg/defaults"
 	"github.com/Bitlatte/evoke/pkg/diff"
+	"github.com/Bitlatte/evoke/pkg/feeds"
+	"github.com/Bitlatte/evoke/pkg/generate"
 	"github.com/Bitlatte/evoke/pkg/hash"
+	"github.com/Bitlatte/evoke/pkg/i18n"
+	"github.com/Bitlatte/evoke/pkg/images"
+	"github.com/Bitlatte/evoke/pkg/links"
 	"github.com/Bitlatte/evoke/pkg/logger"
+	"github.com/Bitlatte/evoke/pkg/minify"
+	"github.com/Bitlatte/evoke/pkg/pages"
 	"github.com/Bitlatte/evoke/pkg/partials"
 	"github.com/Bitlatte/evoke/pkg/pipelines"
+	"github.com/Bitlatte/evoke/pkg/plugin/api"
 	"github.com/Bitlatte/evoke/pkg/plugins"
-	"github.com/Bitlatte/evoke/pkg/util"
+	"github.com/Bitlatte/evoke/pkg/search"
+	"github.com/Bitlatte/evoke/pkg/shortcodes"
+	"github.com/Bitlatte/evoke/pkg/sitemap"
+	"github.com/Bitlatte/evoke/proto"
 	"github.com/yuin/goldmark"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/renderer/html"
+	gmutil "github.com/yuin/goldmark/util"
 )
 
-// LoadPlugins loads the build plugins.
-func LoadPlugins() ([]plugins.Plugin, error) {
+// LoadPlugins loads the build plugins configured in the plugins section of
+// the configuration with the given manager.
+func LoadPlugins(loadedConfig map[string]interface{}, manager *plugins.Manager) ([]plugins.Plugin, error) {
 	logger.Logger.Debug("Loading plugins...")
-	if _, err := os.Stat("plugins"); os.IsNotExist(err) {
+	var configs []config.Plugin
+	if err := config.Decode(loadedConfig, "plugins", &configs); err != nil {
+		return nil, fmt.Errorf("error decoding plugins config: %w", err)
+	}
+	if _, err := os.Stat("plugins"); os.IsNotExist(err) && len(configs) == 0 {
 		logger.Logger.Debug("No plugins directory found, skipping plugin loading.")
 		return nil, nil
 	}
-	p, err := plugins.LoadPlugins()
+	p, err := manager.Load(configs)
 	if err != nil {
 		return nil, err
 	}
+	for _, plugin := range p {
+		metadata, err := api.Metadata(plugin)
+		if err != nil {
+			return nil, err
+		}
+		logger.Logger.Debug("Plugin loaded.", "name", metadata.Name, "version", metadata.Version)
+	}
 	logger.Logger.Debug("Plugins loaded.", "count", len(p))
 	return p, nil
 }
@@ -84,22 +117,135 @@ func RunOnPublicAssetsCopiedHooks(loadedPlugins []plugins.Plugin) error {
 	return nil
 }
 
+// contentHook calls a content hook of a plugin.
+type contentHook func(plugins.Plugin, *proto.ContentFile) (*proto.ContentFile, error)
+
+// implementing returns the plugins that implement the hook.
+func implementing(loadedPlugins []plugins.Plugin, hook string) []plugins.Plugin {
+	var result []plugins.Plugin
+	for _, p := range loadedPlugins {
+		if i, ok := p.(interface{ Implements(string) bool }); ok && !i.Implements(hook) {
+			continue
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// runContentHooks runs a content hook of the given plugins on a file. Each
+// plugin gets the content and metadata returned by the previous one.
+func runContentHooks(loadedPlugins []plugins.Plugin, name string, hook contentHook, path string, content []byte, metadata map[string]interface{}) ([]byte, map[string]interface{}, error) {
+	for _, p := range loadedPlugins {
+		sent, err := plugins.EncodeMetadata(metadata)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error running %s hook of plugin %s: %w", name, p.Name(), err)
+		}
+		// Plugins called in-process may modify the metadata they get, so
+		// they get a copy to compare with
+		file, err := hook(p, &proto.ContentFile{Path: path, Content: content, Metadata: protobuf.Clone(sent).(*structpb.Struct)})
+		if err != nil {
+			return nil, nil, fmt.Errorf("error running %s hook of plugin %s: %w", name, p.Name(), err)
+		}
+		content = file.Content
+		metadata = plugins.MergeMetadata(metadata, sent, file.Metadata)
+	}
+	return content, metadata, nil
+}
+
 // CreateOutputDirectory creates the output directory.
 func CreateOutputDirectory(outputDir string) error {
 	logger.Logger.Debug("Creating output directory...", "path", outputDir)
 	return os.MkdirAll(outputDir, 0755)
 }
 
-// CopyPublicDirectory copies the public directory to the output directory.
-func CopyPublicDirectory(outputDir string) error {
-	logger.Logger.Debug("Copying public directory...")
-	if _, err := os.Stat("public"); !os.IsNotExist(err) {
-		if err := util.CopyDirectory("public", outputDir); err != nil {
-			return fmt.Errorf("error copying public directory: %w", err)
+// LoadMinifier returns the minifier configured by the minify section of the
+// configuration, or nil if minification is disabled. The enabled flag turns
+// it on regardless of the configuration.
+func LoadMinifier(loadedConfig map[string]interface{}, enabled bool) (*minify.Minifier, error) {
+	var cfg config.Minify
+	if err := config.Decode(loadedConfig, "minify", &cfg); err != nil {
+		return nil, fmt.Errorf("error decoding minify config: %w", err)
+	}
+	m := minify.New(cfg, enabled)
+	logger.Logger.Debug("Minifier loaded.", "types", m.String())
+	return m, nil
+}
+
+// FingerprintAssets fingerprints the files copied from the public directory
+// as configured in the assets section of the configuration and returns their
+// manifest.
+func FingerprintAssets(outputDir string, loadedConfig map[string]interface{}) (assets.Manifest, error) {
+	logger.Logger.Debug("Fingerprinting assets...")
+	var cfg config.Assets
+	if err := config.Decode(loadedConfig, "assets", &cfg); err != nil {
+		return nil, fmt.Errorf("error decoding assets config: %w", err)
+	}
+	manifest, err := assets.Fingerprint("public", outputDir, cfg.Fingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("error fingerprinting assets: %w", err)
+	}
+	if err := recordFingerprints(outputDir, manifest); err != nil {
+		return nil, err
+	}
+	logger.Logger.Debug("Assets fingerprinted.", "count", len(manifest))
+	return manifest, nil
+}
+
+// LoadBundler returns the bundler of the build, after bundling the entry
+// points listed in the bundle section of the configuration along with the
+// ones bundled by the previous build. Bundles are minified if the minifier
+// handles their type.
+func LoadBundler(outputDir string, loadedConfig map[string]interface{}, m *minify.Minifier) (*bundle.Bundler, error) {
+	logger.Logger.Debug("Bundling assets...")
+	var cfg config.Bundle
+	if err := config.Decode(loadedConfig, "bundle", &cfg); err != nil {
+		return nil, fmt.Errorf("error decoding bundle config: %w", err)
+	}
+	bundleOpts, err := bundle.NewOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	bundleOpts.MinifyJS = m.Handles("bundle.js")
+	bundleOpts.MinifyCSS = m.Handles("bundle.css")
+	b, err := bundle.New(outputDir, bundleOpts)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range append(cfg.Entries, b.Previous()...) {
+		if _, err := b.Bundle(entry); err != nil {
+			return nil, err
 		}
 	}
-	logger.Logger.Debug("Public directory copied.")
-	return nil
+	logger.Logger.Debug("Assets bundled.", "count", len(b.Manifest()))
+	return b, nil
+}
+
+// LoadImages returns the image processor configured by the images section of
+// the configuration.
+func LoadImages(outputDir string, loadedConfig map[string]interface{}) (*images.Processor, error) {
+	var cfg config.Images
+	if err := config.Decode(loadedConfig, "images", &cfg); err != nil {
+		return nil, fmt.Errorf("error decoding images config: %w", err)
+	}
+	imageOpts, err := images.NewOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return images.New(outputDir, imageOpts)
+}
+
+// LoadLanguages returns the languages configured by the languages section of
+// the configuration, or nil for a site in a single language.
+func LoadLanguages(loadedConfig map[string]interface{}) (*i18n.Languages, error) {
+	var cfgs []config.Language
+	if err := config.Decode(loadedConfig, "languages", &cfgs); err != nil {
+		return nil, fmt.Errorf("error decoding languages config: %w", err)
+	}
+	languages, err := i18n.New(cfgs)
+	if err != nil {
+		return nil, fmt.Errorf("error loading languages: %w", err)
+	}
+	return languages, nil
 }
 
 // LoadConfiguration loads the configuration.
@@ -113,11 +259,23 @@ func LoadConfiguration() (map[string]interface{}, error) {
 	return cfg, nil
 }
 
-// LoadPartials loads the partials.
-func LoadPartials() (*partials.Partials, error) {
+// LoadTemplateFuncs loads the template functions registered by the plugins,
+// which can't take the names of the builtin ones.
+func LoadTemplateFuncs(loadedPlugins []plugins.Plugin, builtin ...template.FuncMap) (template.FuncMap, error) {
+	logger.Logger.Debug("Loading template functions...")
+	funcs, err := plugins.TemplateFuncs(loadedPlugins, builtin...)
+	if err != nil {
+		return nil, err
+	}
+	logger.Logger.Debug("Template functions loaded.", "count", len(funcs))
+	return funcs, nil
+}
+
+// LoadPartials loads the partials with the given template functions.
+func LoadPartials(funcs template.FuncMap) (*partials.Partials, error) {
 	logger.Logger.Debug("Loading partials...")
 	if _, err := os.Stat("partials"); !os.IsNotExist(err) {
-		p, err := partials.LoadPartials()
+		p, err := partials.LoadPartials(funcs)
 		if err != nil {
 			return nil, err
 		}
@@ -125,32 +283,118 @@ func LoadPartials() (*partials.Partials, error) {
 		return p, nil
 	}
 	logger.Logger.Debug("No partials directory found, skipping partial loading.")
-	return &partials.Partials{}, nil
+	return &partials.Partials{Template: template.New("").Funcs(funcs)}, nil
+}
+
+// LoadShortcodes loads the shortcode templates.
+func LoadShortcodes(t *partials.Partials) (*shortcodes.Shortcodes, error) {
+	logger.Logger.Debug("Loading shortcodes...")
+	if _, err := os.Stat(shortcodes.Dir); !os.IsNotExist(err) {
+		s, err := shortcodes.LoadShortcodes(t)
+		if err != nil {
+			return nil, err
+		}
+		logger.Logger.Debug("Shortcodes loaded.")
+		return s, nil
+	}
+	logger.Logger.Debug("No shortcodes directory found, skipping shortcode loading.")
+	return nil, nil
 }
 
 // ProcessContent processes the content.
-func ProcessContent(outputDir string, loadedConfig map[string]interface{}, t *partials.Partials, loadedPlugins []plugins.Plugin, workerCount int) error {
+func ProcessContent(outputDir string, loadedConfig map[string]interface{}, t *partials.Partials, loadedPlugins []plugins.Plugin, workerCount int, opts Options) error {
+	return processContent(outputDir, loadedConfig, t, loadedPlugins, workerCount, &buildContext{Options: opts})
+}
+
+// processContent processes the content with the state of the build.
+func processContent(outputDir string, loadedConfig map[string]interface{}, t *partials.Partials, loadedPlugins []plugins.Plugin, workerCount int, b *buildContext) error {
 	logger.Logger.Debug("Processing content...")
+
+	siteData, err := LoadData()
+	if err != nil {
+		return fmt.Errorf("error loading data: %w", err)
+	}
+
+	// Index the pages, including the ones generated from data, and split off
+	// the ones that aren't published
+	generated, err := loadGenerators(siteData)
+	if err != nil {
+		return fmt.Errorf("error loading generators: %w", err)
+	}
+	pluginPages, err := loadPluginPages(loadedPlugins)
+	if err != nil {
+		return fmt.Errorf("error loading plugin pages: %w", err)
+	}
+	published, excluded, err := loadPages(b, generated, pluginPages)
+	if err != nil {
+		return fmt.Errorf("error loading pages: %w", err)
+	}
+	outputs, err := contentOutputs(published, b.languages)
+	if err != nil {
+		return fmt.Errorf("error listing content outputs: %w", err)
+	}
+	if err := checkCollisions(outputs); err != nil {
+		return err
+	}
+	if err := b.languages.Index(published); err != nil {
+		return err
+	}
+	site := newSite(loadedConfig, published, siteData)
+	if b.site != nil {
+		if err := b.site.setPages(published); err != nil {
+			return err
+		}
+	}
+
+	transformers := []gmutil.PrioritizedValue{gmutil.Prioritized(links.NewTransformer(b.languages), 100)}
+	if b.imageProcessor != nil && b.imageProcessor.Markdown() {
+		transformers = append(transformers, gmutil.Prioritized(images.NewTransformer(b.imageProcessor), 200))
+	}
 	gm := goldmark.New(
 		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithParserOptions(
+			parser.WithASTTransformers(transformers...),
+		),
 		goldmark.WithRendererOptions(
 			html.WithUnsafe(),
 		),
 	)
 
+	sc, err := LoadShortcodes(t)
+	if err != nil {
+		return fmt.Errorf("error loading shortcodes: %w", err)
+	}
+
+	markdownPipeline, err := newMarkdownPipeline(gm, site, sc)
+	if err != nil {
+		return err
+	}
+	markdownPipeline.Localize, err = localizeShortcodes(b.languages, site, sc)
+	if err != nil {
+		return fmt.Errorf("error loading shortcodes: %w", err)
+	}
+
 	var p []pipelines.Pipeline
-	p = append(p, pipelines.NewMarkdownPipeline(gm))
+	p = append(p, markdownPipeline)
 	p = append(p, pipelines.NewHTMLPipeline())
 	p = append(p, pipelines.NewCopyPipeline())
 
-	// Register plugin pipelines
+	// Register plugin pipelines, and the extensions they handle. The first
+	// pipeline registering an extension handles it.
+	extensions := make(map[string]pipelines.Pipeline)
 	for _, plugin := range loadedPlugins {
 		pluginPipelines, err := plugin.RegisterPipelines()
 		if err != nil {
 			return fmt.Errorf("error registering pipelines: %w", err)
 		}
 		for _, pipeline := range pluginPipelines {
-			p = append(p, pipelines.NewGRPCPipeline(plugin, pipeline.Name))
+			grpcPipeline := pipelines.NewGRPCPipeline(plugin, pipeline.Name)
+			p = append(p, grpcPipeline)
+			for _, ext := range pipeline.Extensions {
+				if _, ok := extensions[ext]; !ok {
+					extensions[ext] = grpcPipeline
+				}
+			}
 		}
 	}
 
@@ -158,6 +402,9 @@ func ProcessContent(outputDir string, loadedConfig map[string]interface{}, t *pa
 	if err != nil {
 		return fmt.Errorf("error creating content processor: %w", err)
 	}
+	contentProcessor.Extensions = extensions
+	contentProcessor.Minifier = b.minifier
+	contentProcessor.Languages = b.languages
 
 	// Create a new cache
 	c, err := cache.New(filepath.Join(outputDir, ".cache"))
@@ -166,7 +413,7 @@ func ProcessContent(outputDir string, loadedConfig map[string]interface{}, t *pa
 	}
 
 	// Build the dependency graph
-	d, err := dag.BuildGraph("content", "partials")
+	d, err := dag.BuildGraph("content", "partials", "data")
 	if err != nil {
 		return fmt.Errorf("error building dependency graph: %w", err)
 	}
@@ -177,7 +424,77 @@ func ProcessContent(outputDir string, loadedConfig map[string]interface{}, t *pa
 		return fmt.Errorf("error getting files to rebuild: %w", err)
 	}
 
-	if err := ProcessContentWithProcessor(contentProcessor, loadedConfig, toRebuild, workerCount); err != nil {
+	// Pages excluded by a previous build are only rendered again if the
+	// options change, so rebuild everything when they do.
+	if fingerprint := b.fingerprint(); c.Get(optionsCacheKey) != fingerprint {
+		for path := range d.Nodes {
+			toRebuild[path] = true
+		}
+		c.Set(optionsCacheKey, fingerprint)
+	}
+
+	// Skip excluded pages and remove their output from previous builds
+	for _, page := range excluded {
+		logger.Logger.Debug("Skipping unpublished page", "path", page.Path)
+		delete(toRebuild, page.Path)
+		// Forget the page's hash so it is rendered once it gets published
+		if d.Nodes[page.Path] != nil {
+			c.Set(page.Path, "")
+		}
+		if err := os.Remove(filepath.Join(outputDir, page.URL)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing unpublished page: %w", err)
+		}
+	}
+	for _, gp := range generated {
+		if len(gp.published) < len(gp.pages) {
+			c.Set(gp.generator.Path, "")
+		}
+	}
+
+	// Pages generated by plugins aren't tracked by the cache, so they are
+	// rendered on every build
+	var virtual []pipelines.Asset
+	var pluginURLs []string
+	for _, pp := range pluginPages {
+		if !pp.published {
+			continue
+		}
+		metadata := make(map[string]interface{}, len(pp.page.Params))
+		for k, v := range pp.page.Params {
+			metadata[k] = v
+		}
+		virtual = append(virtual, pipelines.Asset{Path: pp.page.Path, Content: bytes.NewReader(pp.content), Metadata: metadata})
+		pluginURLs = append(pluginURLs, pp.page.URL)
+	}
+
+	if err := ProcessContentWithProcessor(contentProcessor, site, toRebuild, workerCount, virtual...); err != nil {
+		return err
+	}
+
+	if err := removeStaleOutputs(outputDir, c, pluginPagesCacheKey, pluginURLs); err != nil {
+		return err
+	}
+
+	if err := generatePages(outputDir, generated, site, t, c, toRebuild, workerCount, b.minifier, b.languages); err != nil {
+		return err
+	}
+
+	// Index the rendered pages
+	if err := BuildSearchIndex(outputDir, loadedConfig, published, workerCount); err != nil {
+		return err
+	}
+
+	// List the published pages in the sitemaps and the feeds, and remove the
+	// ones of a previous build that are no longer written
+	sitemapURLs, err := BuildSitemaps(outputDir, loadedConfig, published, b.languages)
+	if err != nil {
+		return err
+	}
+	feedURLs, err := BuildFeeds(outputDir, loadedConfig, published, b.languages)
+	if err != nil {
+		return err
+	}
+	if err := removeStaleOutputs(outputDir, c, feedsCacheKey, append(sitemapURLs, feedURLs...)); err != nil {
 		return err
 	}
 
@@ -189,9 +506,200 @@ func ProcessContent(outputDir string, loadedConfig map[string]interface{}, t *pa
 	return nil
 }
 
+// generatedPages holds the pages of a generator.
+type generatedPages struct {
+	generator *generate.Generator
+	pages     []*pages.Page
+	published []*pages.Page
+}
+
+// loadGenerators loads the generators in the content directory along with
+// the pages they generate from the site data.
+func loadGenerators(siteData map[string]any) ([]*generatedPages, error) {
+	logger.Logger.Debug("Loading generators...")
+	generators, err := generate.Find("content")
+	if err != nil {
+		return nil, err
+	}
+
+	var generated []*generatedPages
+	for _, g := range generators {
+		p, err := g.Pages(siteData)
+		if err != nil {
+			return nil, err
+		}
+		generated = append(generated, &generatedPages{generator: g, pages: p})
+	}
+	logger.Logger.Debug("Generators loaded.", "count", len(generated))
+	return generated, nil
+}
+
+// pluginPage is a page generated by a plugin.
+type pluginPage struct {
+	page      *pages.Page
+	content   []byte
+	published bool
+}
+
+// loadPluginPages runs the GeneratePages hooks of the given plugins. The pages
+// must be markdown or HTML files inside the content directory that don't
+// collide with existing content.
+func loadPluginPages(loadedPlugins []plugins.Plugin) ([]*pluginPage, error) {
+	var result []*pluginPage
+	generatedBy := make(map[string]string)
+	for _, p := range loadedPlugins {
+		logger.Logger.Debug("Running GeneratePages hook", "plugin", p.Name())
+		generatedPages, err := api.GeneratePages(p)
+		if err != nil {
+			return nil, fmt.Errorf("error generating pages with plugin %s: %w", p.Name(), err)
+		}
+
+		for _, gp := range generatedPages {
+			rel := filepath.Clean(filepath.FromSlash(gp.Path))
+			if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return nil, fmt.Errorf("plugin %s generated page %s outside of the content directory", p.Name(), gp.Path)
+			}
+			if ext := filepath.Ext(rel); ext != ".md" && ext != ".html" {
+				return nil, fmt.Errorf("plugin %s generated page %s, pages must be .md or .html files", p.Name(), gp.Path)
+			}
+			path := filepath.Join("content", rel)
+			if other, ok := generatedBy[path]; ok {
+				return nil, fmt.Errorf("plugins %s and %s both generated page %s", other, p.Name(), gp.Path)
+			}
+			if _, err := os.Stat(path); err == nil {
+				return nil, fmt.Errorf("plugin %s generated page %s, which already exists", p.Name(), gp.Path)
+			}
+			generatedBy[path] = p.Name()
+
+			params := make(map[string]any)
+			if gp.FrontMatterJson != "" {
+				if err := json.Unmarshal([]byte(gp.FrontMatterJson), &params); err != nil {
+					return nil, fmt.Errorf("error parsing front matter of page %s generated by plugin %s: %w", gp.Path, p.Name(), err)
+				}
+			}
+			// Front matter in the body takes precedence, as it does when the
+			// page is rendered
+			if filepath.Ext(path) == ".md" {
+				frontMatter, _, err := pipelines.ParseFrontMatter(gp.Content)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing front matter of page %s generated by plugin %s: %w", gp.Path, p.Name(), err)
+				}
+				for k, v := range frontMatter {
+					params[k] = v
+				}
+			}
+
+			result = append(result, &pluginPage{page: pages.New(path, params), content: gp.Content})
+		}
+	}
+	return result, nil
+}
+
+// loadPages indexes the pages in the content directory together with the
+// generated pages, publishes them under their language, and splits them into
+// the published pages and the ones excluded as drafts, future or expired
+// pages.
+func loadPages(b *buildContext, generated []*generatedPages, pluginPages []*pluginPage) (published, excluded []*pages.Page, err error) {
+	logger.Logger.Debug("Loading pages...")
+	all, err := pages.Load("content")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filter := b.filter()
+	for _, gp := range generated {
+		all = append(all, gp.pages...)
+		gp.published, _ = filter.Apply(gp.pages)
+	}
+	for _, pp := range pluginPages {
+		all = append(all, pp.page)
+		pp.published = filter.Includes(pp.page)
+	}
+	for _, page := range all {
+		b.languages.Localize(page)
+	}
+	pages.Sort(all)
+
+	published, excluded = filter.Apply(all)
+	logger.Logger.Debug("Pages loaded.", "published", len(published), "excluded", len(excluded))
+	return published, excluded, nil
+}
+
+// LoadData loads the files in the data directory.
+func LoadData() (map[string]any, error) {
+	logger.Logger.Debug("Loading data...")
+	d, err := data.Load("data")
+	if err != nil {
+		return nil, err
+	}
+	logger.Logger.Debug("Data loaded.")
+	return d, nil
+}
+
+// newSite returns the data exposed to templates as .Site: the configuration
+// along with the published pages and the contents of the data directory.
+func newSite(loadedConfig map[string]interface{}, published []*pages.Page, siteData map[string]any) map[string]interface{} {
+	site := make(map[string]interface{}, len(loadedConfig)+2)
+	for k, v := range loadedConfig {
+		site[k] = v
+	}
+	site["Pages"] = published
+	site["Data"] = siteData
+	return site
+}
+
+// newMarkdownPipeline creates the markdown pipeline configured by the
+// markdown section of the configuration.
+func newMarkdownPipeline(gm goldmark.Markdown, loadedConfig map[string]interface{}, sc *shortcodes.Shortcodes) (*pipelines.MarkdownPipeline, error) {
+	p := pipelines.NewMarkdownPipeline(gm)
+	p.Shortcodes = sc
+	p.Site = loadedConfig
+	markdownConfig := config.Markdown{
+		TOC: config.TOC{
+			StartLevel: p.TOCStartLevel,
+			EndLevel:   p.TOCEndLevel,
+		},
+	}
+	if err := config.Decode(loadedConfig, "markdown", &markdownConfig); err != nil {
+		return nil, fmt.Errorf("error decoding markdown config: %w", err)
+	}
+	p.HeadingAnchors = markdownConfig.Anchors
+	p.TOCStartLevel = markdownConfig.TOC.StartLevel
+	p.TOCEndLevel = markdownConfig.TOC.EndLevel
+	return p, nil
+}
+
+// localizeShortcodes returns the function giving the markdown pipeline the
+// site and the shortcodes in the language of each page of a multilingual
+// site, whose i18n function returns the strings of the language. It returns
+// nil on a site in a single language.
+func localizeShortcodes(languages *i18n.Languages, site map[string]any, sc *shortcodes.Shortcodes) (func(string) (map[string]any, *shortcodes.Shortcodes), error) {
+	if languages == nil {
+		return nil, nil
+	}
+	// Templates can't be cloned once executed, so clone them up front
+	localized := make(map[string]*shortcodes.Shortcodes)
+	if sc != nil {
+		for _, lang := range languages.List() {
+			l, err := sc.Localize(languages.LanguageFuncs(lang))
+			if err != nil {
+				return nil, err
+			}
+			localized[lang.Code] = l
+		}
+	}
+	return func(path string) (map[string]any, *shortcodes.Shortcodes) {
+		return languages.Site(site, path), localized[languages.Of(path).Code]
+	}, nil
+}
+
 // ProcessContentWithProcessor processes the content with a given processor.
-func ProcessContentWithProcessor(contentProcessor *content.Content, loadedConfig map[string]interface{}, toRebuild map[string]bool, workerCount int) error {
-	if _, statErr := os.Stat("content"); os.IsNotExist(statErr) {
+// The virtual assets, such as pages generated by plugins, are processed after
+// the files in the content directory.
+func ProcessContentWithProcessor(contentProcessor *content.Content, loadedConfig map[string]interface{}, toRebuild map[string]bool, workerCount int, virtual ...pipelines.Asset) error {
+	_, statErr := os.Stat("content")
+	contentMissing := os.IsNotExist(statErr)
+	if contentMissing && len(virtual) == 0 {
 		return nil // No content directory, nothing to do.
 	}
 
@@ -211,6 +719,11 @@ func ProcessContentWithProcessor(contentProcessor *content.Content, loadedConfig
 		cancel()
 	}
 
+	// Look up the plugins implementing the content hooks once
+	loadedHooks := implementing(contentProcessor.Plugins, plugins.HookOnContentLoaded)
+	renderHooks := implementing(contentProcessor.Plugins, plugins.HookOnContentRender)
+	htmlHooks := implementing(contentProcessor.Plugins, plugins.HookOnHTMLRendered)
+
 	// Start worker goroutines
 	for i := 0; i < workerCount; i++ {
 		wg.Add(1)
@@ -225,6 +738,12 @@ func ProcessContentWithProcessor(contentProcessor *content.Content, loadedConfig
 						return
 					}
 
+					source := asset.Path
+					if err := runSourceHooks(&asset, loadedHooks, renderHooks); err != nil {
+						handleError(err)
+						return
+					}
+
 					var processedAsset *pipelines.Asset
 					var err error
 					var pipeline pipelines.Pipeline
@@ -236,37 +755,7 @@ func ProcessContentWithProcessor(contentProcessor *content.Content, loadedConfig
 						pipeline = contentProcessor.Pipelines[1]
 					default:
 						// Check for a plugin pipeline
-						for _, p := range contentProcessor.Pipelines[3:] {
-							grpcPipeline, ok := p.(*pipelines.GRPC)
-							if !ok {
-								continue
-							}
-							// This is a bit of a hack, but we need to get the extensions
-							// for the pipeline. We'll do this by calling the RegisterPipelines
-							// method on the plugin.
-							pluginPipelines, err := grpcPipeline.Plugin.RegisterPipelines()
-							if err != nil {
-								handleError(fmt.Errorf("error getting plugin pipelines: %w", err))
-								return
-							}
-
-							for _, pp := range pluginPipelines {
-								if pp.Name == grpcPipeline.Name() {
-									for _, e := range pp.Extensions {
-										if e == ext {
-											pipeline = p
-											break
-										}
-									}
-								}
-								if pipeline != nil {
-									break
-								}
-							}
-							if pipeline != nil {
-								break
-							}
-						}
+						pipeline = contentProcessor.Extensions[ext]
 					}
 
 					// If no pipeline was found, use the copy pipeline
@@ -288,43 +777,30 @@ func ProcessContentWithProcessor(contentProcessor *content.Content, loadedConfig
 							handleError(fmt.Errorf("buffer read error for %s: %w", asset.Path, err))
 							return
 						}
-						processedContent, err := processLayouts(layouts, buf.Bytes(), processedAsset.Metadata, contentProcessor.Partials, loadedConfig)
+						body, metadata, err := runContentHooks(htmlHooks, plugins.HookOnHTMLRendered, api.HTMLRendered, source, buf.Bytes(), processedAsset.Metadata)
+						if err != nil {
+							handleError(err)
+							return
+						}
+						languages := contentProcessor.Languages
+						processedContent, err := processLayouts(layouts, body, languages.Params(source, metadata), processedAsset.TableOfContents, contentProcessor.Partials, languages.Site(loadedConfig, source), languages.PageFuncs(source))
 						if err != nil {
 							handleError(fmt.Errorf("layout error for %s: %w", asset.Path, err))
 							return
 						}
 
-						outputPath := filepath.Join(contentProcessor.OutputDir, util.ToOutputPath(processedAsset.Path))
-						if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+						outputPath := filepath.Join(contentProcessor.OutputDir, contentProcessor.Languages.OutputPath(processedAsset.Path))
+						if err := writeOutput(outputPath, processedContent, contentProcessor.Minifier); err != nil {
 							handleError(err)
 							return
 						}
-
-						// Check if the file exists
-						if _, err := os.Stat(outputPath); os.IsNotExist(err) {
-							// If it doesn't exist, write the whole file
-							if err := os.WriteFile(outputPath, processedContent, 0644); err != nil {
-								handleError(err)
-								return
-							}
-						} else {
-							// If it does exist, apply a patch
-							existingContent, err := os.ReadFile(outputPath)
-							if err != nil {
-								handleError(err)
-								return
-							}
-
-							newContent, err := diff.Merge(existingContent, processedContent)
-							if err != nil {
-								handleError(err)
-								return
-							}
-
-							if err := os.WriteFile(outputPath, newContent, 0644); err != nil {
-								handleError(err)
-								return
-							}
+					} else {
+						// Other files, such as stylesheets next to a page,
+						// are written alongside the pages, minified if the
+						// minifier handles them
+						if err := writeAsset(contentProcessor, processedAsset); err != nil {
+							handleError(err)
+							return
 						}
 					}
 				}
@@ -335,6 +811,16 @@ func ProcessContentWithProcessor(contentProcessor *content.Content, loadedConfig
 	// Start file walker in a separate goroutine
 	go func() {
 		defer close(jobs)
+		for _, asset := range virtual {
+			select {
+			case jobs <- asset:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if contentMissing {
+			return
+		}
 		err := filepath.Walk("content", func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
@@ -369,6 +855,187 @@ func ProcessContentWithProcessor(contentProcessor *content.Content, loadedConfig
 	return <-errs
 }
 
+// runSourceHooks runs the OnContentLoaded hooks and, for pages, the
+// OnContentRender hooks on an asset before it is processed. The
+// OnContentRender hooks get the body of a markdown page and its front matter
+// as metadata.
+func runSourceHooks(asset *pipelines.Asset, loadedHooks, renderHooks []plugins.Plugin) error {
+	ext := filepath.Ext(asset.Path)
+	isPage := ext == ".md" || ext == ".html"
+	if len(loadedHooks) == 0 && (len(renderHooks) == 0 || !isPage) {
+		return nil
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := buf.ReadFrom(asset.Content); err != nil {
+		return fmt.Errorf("buffer read error for %s: %w", asset.Path, err)
+	}
+	content, metadata, err := runContentHooks(loadedHooks, plugins.HookOnContentLoaded, api.ContentLoaded, asset.Path, buf.Bytes(), asset.Metadata)
+	if err != nil {
+		return err
+	}
+
+	if len(renderHooks) > 0 && isPage {
+		if ext == ".md" {
+			frontMatter, body, err := pipelines.ParseFrontMatter(content)
+			if err != nil {
+				return fmt.Errorf("error parsing front matter of %s: %w", asset.Path, err)
+			}
+			// The front matter takes precedence over the metadata, as it
+			// does when the page is rendered
+			if len(frontMatter) > 0 && metadata == nil {
+				metadata = make(map[string]interface{}, len(frontMatter))
+			}
+			for k, v := range frontMatter {
+				metadata[k] = v
+			}
+			content = body
+		}
+		content, metadata, err = runContentHooks(renderHooks, plugins.HookOnContentRender, api.ContentRender, asset.Path, content, metadata)
+		if err != nil {
+			return err
+		}
+	}
+
+	asset.Content = bytes.NewReader(content)
+	asset.Metadata = metadata
+	return nil
+}
+
+// writeAsset writes a processed asset that isn't a page to the output
+// directory, minified if the minifier handles it.
+func writeAsset(contentProcessor *content.Content, asset *pipelines.Asset) error {
+	buf := new(bytes.Buffer)
+	if _, err := buf.ReadFrom(asset.Content); err != nil {
+		return fmt.Errorf("buffer read error for %s: %w", asset.Path, err)
+	}
+	minified, err := contentProcessor.Minifier.Minify(asset.Path, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	outputPath := filepath.Join(contentProcessor.OutputDir, contentProcessor.Languages.OutputPath(asset.Path))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	return replaceFile(outputPath, minified)
+}
+
+// writeOutput minifies the rendered content and writes it to the output path.
+// Existing files are patched rather than replaced.
+func writeOutput(outputPath string, processedContent []byte, m *minify.Minifier) error {
+	processedContent, err := m.Minify(outputPath, processedContent)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+
+	// Check if the file exists
+	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
+		// If it doesn't exist, write the whole file
+		return os.WriteFile(outputPath, processedContent, 0644)
+	}
+
+	// If it does exist, apply a patch
+	existingContent, err := os.ReadFile(outputPath)
+	if err != nil {
+		return err
+	}
+
+	newContent, err := diff.Merge(existingContent, processedContent)
+	if err != nil {
+		return err
+	}
+
+	return replaceFile(outputPath, newContent)
+}
+
+// replaceFile writes the file anew instead of in place, so that a file hard
+// linked from the public directory is replaced rather than written through.
+func replaceFile(path string, content []byte) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// generatePages renders the pages of the generators that need to be rebuilt
+// and removes the output of pages that a generator no longer produces.
+func generatePages(outputDir string, generated []*generatedPages, site map[string]any, t *partials.Partials, c *cache.Cache, toRebuild map[string]bool, workerCount int, m *minify.Minifier, languages *i18n.Languages) error {
+	for _, gp := range generated {
+		if !toRebuild[gp.generator.Path] {
+			continue
+		}
+		logger.Logger.Debug("Generating pages", "generator", gp.generator.Path, "count", len(gp.published))
+
+		var (
+			wg       sync.WaitGroup
+			errOnce  sync.Once
+			firstErr error
+		)
+		jobs := make(chan *pages.Page)
+		for i := 0; i < workerCount; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for page := range jobs {
+					layouts := append([]string{gp.generator.LayoutPath()}, getLayouts(page.Path, t)...)
+					processedContent, err := processLayouts(layouts, nil, languages.Params(page.Path, page.Params), nil, t, languages.Site(site, page.Path), languages.PageFuncs(page.Path))
+					if err == nil {
+						err = writeOutput(filepath.Join(outputDir, page.URL), processedContent, m)
+					}
+					if err != nil {
+						errOnce.Do(func() { firstErr = fmt.Errorf("error generating %s: %w", page.Path, err) })
+					}
+				}
+			}()
+		}
+		for _, page := range gp.published {
+			jobs <- page
+		}
+		close(jobs)
+		wg.Wait()
+		if firstErr != nil {
+			return firstErr
+		}
+
+		// Remove the pages generated by the previous build that are gone
+		var urls []string
+		for _, page := range gp.published {
+			urls = append(urls, page.URL)
+		}
+		if err := removeStaleOutputs(outputDir, c, generatedCacheKey+gp.generator.Path, urls); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeStaleOutputs removes the outputs recorded under the cache key by the
+// previous build that are not among the current URLs, then records the
+// current URLs.
+func removeStaleOutputs(outputDir string, c *cache.Cache, cacheKey string, urls []string) error {
+	current := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		current[url] = true
+	}
+	for _, url := range strings.Split(c.Get(cacheKey), "\n") {
+		if url == "" || current[url] {
+			continue
+		}
+		// A file of the public directory may have taken its place
+		if _, err := os.Stat(filepath.Join("public", filepath.FromSlash(url))); err == nil {
+			continue
+		}
+		if err := os.Remove(filepath.Join(outputDir, url)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing generated page: %w", err)
+		}
+	}
+	c.Set(cacheKey, strings.Join(urls, "\n"))
+	return nil
+}
+
 // RunOnPostBuildHooks runs the OnPostBuild hooks for the given plugins.
 func RunOnPostBuildHooks(loadedPlugins []plugins.Plugin) error {
 	logger.Logger.Debug("Running OnPostBuild hooks...")
@@ -411,8 +1078,10 @@ func getLayouts(path string, p *partials.Partials) []string {
 	return layouts
 }
 
-// processLayouts processes the layouts for a given content file.
-func processLayouts(layouts []string, content []byte, frontMatter map[string]any, p *partials.Partials, config map[string]any) ([]byte, error) {
+// processLayouts processes the layouts for a given content file, with the
+// table of contents of markdown pages. The template functions, if any,
+// override the ones of the partials.
+func processLayouts(layouts []string, content []byte, frontMatter map[string]any, toc *pipelines.TableOfContents, p *partials.Partials, config map[string]any, funcs template.FuncMap) ([]byte, error) {
 	processedContent := content
 
 	for _, layoutPath := range layouts {
@@ -422,6 +1091,9 @@ func processLayouts(layouts []string, content []byte, frontMatter map[string]any
 		if err != nil {
 			return nil, err
 		}
+		if funcs != nil {
+			t.Template.Funcs(funcs)
+		}
 
 		if layoutPath == "default" {
 			if _, err = t.Template.Parse(defaults.Layout); err != nil {
@@ -434,13 +1106,15 @@ func processLayouts(layouts []string, content []byte, frontMatter map[string]any
 		}
 
 		data := struct {
-			Site    map[string]any
-			Page    map[string]any
-			Content template.HTML
+			Site            map[string]any
+			Page            map[string]any
+			Content         template.HTML
+			TableOfContents *pipelines.TableOfContents
 		}{
-			Site:    config,
-			Page:    frontMatter,
-			Content: template.HTML(processedContent),
+			Site:            config,
+			Page:            frontMatter,
+			Content:         template.HTML(processedContent),
+			TableOfContents: toc,
 		}
 
 		if layoutPath == "default" {
@@ -473,11 +1147,10 @@ func getFilesToRebuild(c *cache.Cache, d *dag.Graph) (map[string]bool, error) {
 
 		if c.Get(path) != h {
 			toRebuild[path] = true
-			// If a partial is modified, we need to rebuild all of its dependents
-			if filepath.Dir(path) == "partials" {
-				for _, dependent := range d.GetDependents(node) {
-					toRebuild[dependent.Path] = true
-				}
+			// If a partial, shortcode, data file or layout is modified, we
+			// need to rebuild all of its dependents
+			for _, dependent := range d.GetAllDependents(node) {
+				toRebuild[dependent.Path] = true
 			}
 		}
 		c.Set(path, h)
@@ -486,19 +1159,380 @@ func getFilesToRebuild(c *cache.Cache, d *dag.Graph) (map[string]bool, error) {
 	return toRebuild, nil
 }
 
+// CheckLinks checks the generated site for broken internal links. Broken
+// links are logged as warnings, or returned as an error if strict is true.
+func CheckLinks(outputDir string, strict bool) error {
+	logger.Logger.Debug("Checking links...")
+	broken, err := links.Check(outputDir)
+	if err != nil {
+		return fmt.Errorf("error checking links: %w", err)
+	}
+	for _, b := range broken {
+		if strict {
+			logger.Logger.Error("Broken link", "page", b.Page, "link", b.Link, "reason", b.Reason)
+		} else {
+			logger.Logger.Warn("Broken link", "page", b.Page, "link", b.Link, "reason", b.Reason)
+		}
+	}
+	if strict && len(broken) > 0 {
+		return fmt.Errorf("found %d broken links", len(broken))
+	}
+	logger.Logger.Debug("Links checked.", "broken", len(broken))
+	return nil
+}
+
+// BuildSearchIndex writes the search index of the published pages to the
+// output directory if the search section of the configuration enables it,
+// and removes the index of a previous build otherwise. Pages are indexed from
+// their output with the given number of workers, leaving out the ones whose
+// front matter sets search to false.
+func BuildSearchIndex(outputDir string, loadedConfig map[string]interface{}, published []*pages.Page, workerCount int) error {
+	var cfg config.Search
+	if err := config.Decode(loadedConfig, "search", &cfg); err != nil {
+		return fmt.Errorf("error decoding search config: %w", err)
+	}
+	if !cfg.Enabled {
+		// A file of the public directory may have the name of the index
+		if _, err := os.Stat(filepath.Join("public", search.IndexFile)); err == nil {
+			return nil
+		}
+		return search.Remove(outputDir)
+	}
+	logger.Logger.Debug("Building search index...")
+
+	var indexed []*pages.Page
+	for _, page := range published {
+		if include, ok := page.Params["search"].(bool); ok && !include {
+			continue
+		}
+		indexed = append(indexed, page)
+	}
+
+	documents := make([]*search.Document, len(indexed))
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	jobs := make(chan int)
+	for i := 0; i < max(workerCount, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				page := indexed[j]
+				doc, err := indexPage(outputDir, page)
+				if err != nil {
+					errOnce.Do(func() { firstErr = fmt.Errorf("error indexing %s: %w", page.Path, err) })
+					continue
+				}
+				documents[j] = doc
+			}
+		}()
+	}
+	for j := range indexed {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+
+	if err := search.Write(outputDir, documents, cfg.ShardSize); err != nil {
+		return err
+	}
+	logger.Logger.Debug("Search index built.", "pages", len(documents))
+	return nil
+}
+
+// BuildSitemaps writes the sitemap of the published pages to the output
+// directory if the sitemap section of the configuration enables it, leaving
+// out the pages whose front matter sets sitemap to false. Multilingual sites
+// get a sitemap per language, e.g. sitemap.de.xml, listed by the sitemap
+// index. It returns the URLs of the files written.
+func BuildSitemaps(outputDir string, loadedConfig map[string]interface{}, published []*pages.Page, languages *i18n.Languages) ([]string, error) {
+	var cfg config.Sitemap
+	if err := config.Decode(loadedConfig, "sitemap", &cfg); err != nil {
+		return nil, fmt.Errorf("error decoding sitemap config: %w", err)
+	}
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	baseURL, err := siteBaseURL(loadedConfig, "sitemap")
+	if err != nil {
+		return nil, err
+	}
+	logger.Logger.Debug("Building sitemaps...")
+
+	var listed []*pages.Page
+	for _, page := range published {
+		if include, ok := page.Params["sitemap"].(bool); ok && !include {
+			continue
+		}
+		listed = append(listed, page)
+	}
+
+	index := "/" + sitemap.File
+	if languages == nil {
+		if err := writeSyndication(outputDir, index, func(path string) error {
+			return sitemap.Write(path, baseURL, listed)
+		}); err != nil {
+			return nil, err
+		}
+		return []string{index}, nil
+	}
+	var urls []string
+	for _, group := range groupByLanguage(listed, languages) {
+		url := "/" + strings.TrimSuffix(sitemap.File, ".xml") + "." + group.language.Code + ".xml"
+		if err := writeSyndication(outputDir, url, func(path string) error {
+			return sitemap.Write(path, baseURL, group.pages)
+		}); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	if err := writeSyndication(outputDir, index, func(path string) error {
+		return sitemap.WriteIndex(path, baseURL, urls)
+	}); err != nil {
+		return nil, err
+	}
+	logger.Logger.Debug("Sitemaps built.", "pages", len(listed))
+	return append(urls, index), nil
+}
+
+// BuildFeeds writes the RSS and Atom feeds of the published pages with a
+// date to the output directory if the feeds section of the configuration
+// enables it, leaving out the pages whose front matter sets feed to false.
+// Multilingual sites get the feeds of each language under its home, e.g.
+// /de/feed.xml. It returns the URLs of the files written.
+func BuildFeeds(outputDir string, loadedConfig map[string]interface{}, published []*pages.Page, languages *i18n.Languages) ([]string, error) {
+	cfg := config.Feeds{Limit: feeds.DefaultLimit}
+	if err := config.Decode(loadedConfig, "feeds", &cfg); err != nil {
+		return nil, fmt.Errorf("error decoding feeds config: %w", err)
+	}
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	baseURL, err := siteBaseURL(loadedConfig, "feeds")
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Title == "" {
+		cfg.Title, _ = loadedConfig["siteName"].(string)
+	}
+	logger.Logger.Debug("Building feeds...")
+
+	var dated []*pages.Page
+	for _, page := range published {
+		if include, ok := page.Params["feed"].(bool); (ok && !include) || page.PublishDate().IsZero() {
+			continue
+		}
+		dated = append(dated, page)
+	}
+	pages.Sort(dated)
+
+	var urls []string
+	for _, group := range groupByLanguage(dated, languages) {
+		feed := &feeds.Feed{Title: cfg.Title, BaseURL: baseURL, Home: "/", Pages: group.pages}
+		if group.language != nil {
+			feed.Home = group.language.URL()
+			feed.Language = group.language.Code
+		}
+		if cfg.Limit > 0 && len(feed.Pages) > cfg.Limit {
+			feed.Pages = feed.Pages[:cfg.Limit]
+		}
+		rss, atom := feed.Home+feeds.RSSFile, feed.Home+feeds.AtomFile
+		if err := writeSyndication(outputDir, rss, feed.WriteRSS); err != nil {
+			return nil, err
+		}
+		if err := writeSyndication(outputDir, atom, feed.WriteAtom); err != nil {
+			return nil, err
+		}
+		urls = append(urls, rss, atom)
+	}
+	logger.Logger.Debug("Feeds built.", "pages", len(dated))
+	return urls, nil
+}
+
+// languageGroup holds the pages in a language of a multilingual site, or
+// every page of a site in a single language, whose language is nil.
+type languageGroup struct {
+	language *i18n.Language
+	pages    []*pages.Page
+}
+
+// groupByLanguage splits the pages by language, in the order of the
+// languages of the site. Every language gets a group, even without pages.
+func groupByLanguage(published []*pages.Page, languages *i18n.Languages) []languageGroup {
+	if languages == nil {
+		return []languageGroup{{pages: published}}
+	}
+	var groups []languageGroup
+	for _, lang := range languages.List() {
+		group := languageGroup{language: lang}
+		for _, page := range published {
+			if page.Language == lang.Code {
+				group.pages = append(group.pages, page)
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// siteBaseURL returns the baseURL of the configuration, which the section
+// needs to write absolute URLs.
+func siteBaseURL(loadedConfig map[string]interface{}, section string) (string, error) {
+	baseURL, _ := loadedConfig["baseURL"].(string)
+	if baseURL == "" {
+		return "", fmt.Errorf("%s: baseURL must be set in evoke.yaml", section)
+	}
+	return baseURL, nil
+}
+
+// writeSyndication writes the sitemap or the feed at the URL with write. It
+// fails rather than overwrite a file of the public directory.
+func writeSyndication(outputDir, url string, write func(path string) error) error {
+	if _, err := os.Stat(filepath.Join("public", filepath.FromSlash(url))); err == nil {
+		return fmt.Errorf("%s would overwrite public%s", url, url)
+	}
+	path := filepath.Join(outputDir, filepath.FromSlash(url))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := write(path); err != nil {
+		return fmt.Errorf("error writing %s: %w", url, err)
+	}
+	return nil
+}
+
+// indexPage returns the search document of the page, read from its output.
+// The title of the front matter takes precedence over the one of the HTML.
+// On multilingual sites, the document records the language of the page.
+func indexPage(outputDir string, page *pages.Page) (*search.Document, error) {
+	f, err := os.Open(filepath.Join(outputDir, filepath.FromSlash(page.URL)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	doc, err := search.Extract(f)
+	if err != nil {
+		return nil, err
+	}
+	doc.URL = page.URL
+	doc.Language = page.Language
+	if title := page.Title(); title != "" {
+		doc.Title = title
+	}
+	return doc, nil
+}
+
+// optionsCacheKey is the cache key under which the fingerprint of the
+// options of the last build is stored.
+const optionsCacheKey = "evoke:options"
+
+// generatedCacheKey prefixes the cache keys under which the URLs of the pages
+// last produced by each generator are stored.
+const generatedCacheKey = "evoke:generated:"
+
+// feedsCacheKey is the cache key under which the URLs of the sitemaps and
+// the feeds last written are recorded.
+const feedsCacheKey = "evoke:feeds"
+
+// pluginPagesCacheKey is the cache key under which the URLs of the pages last
+// generated by plugins are stored.
+const pluginPagesCacheKey = "evoke:plugin-pages"
+
+// Options holds the optional settings of a build.
+type Options struct {
+	// StrictLinks turns broken internal links into a build error.
+	StrictLinks bool
+	// Drafts includes pages marked as drafts.
+	Drafts bool
+	// Future includes pages with a publish date in the future.
+	Future bool
+	// Expired includes pages with an expiry date in the past.
+	Expired bool
+	// Minify minifies the output, as if the minify section of the
+	// configuration enabled it.
+	Minify bool
+	// Plugins manages the plugin processes, so that they can be reused
+	// across builds. A build without a manager stops its plugins when it's
+	// done.
+	Plugins *plugins.Manager
+}
+
+// buildContext is the state of a build shared by its stages, along with the
+// options it was started with.
+type buildContext struct {
+	Options
+	// site is served to the plugins during the build.
+	site *pluginSite
+	// assets is the hash of the manifest of the public assets.
+	assets string
+	// minifier minifies the output, if enabled.
+	minifier *minify.Minifier
+	// bundles is the hash of the manifest of the bundles built before the
+	// content is processed.
+	bundles string
+	// imageProcessor processes the images of the site.
+	imageProcessor *images.Processor
+	// images is the hash of the images used by the previous build.
+	images string
+	// languages are the languages of a multilingual site.
+	languages *i18n.Languages
+}
+
+// filter returns the filter selecting the pages to publish.
+func (o Options) filter() pages.Filter {
+	return pages.Filter{
+		Drafts:  o.Drafts,
+		Future:  o.Future,
+		Expired: o.Expired,
+		Now:     time.Now(),
+	}
+}
+
+// fingerprint returns a string identifying the options and the state of the
+// build that affect which pages are rendered, or how.
+func (b *buildContext) fingerprint() string {
+	return fmt.Sprintf("drafts=%t future=%t expired=%t assets=%s bundles=%s images=%s minify=%s languages=%s", b.Drafts, b.Future, b.Expired, b.assets, b.bundles, b.images, b.minifier, b.languages.Hash())
+}
+
 // Build builds the site.
-func Build(outputDir string, clean bool, workerCount int) error {
-	// If clean is true, remove the cache file
+func Build(outputDir string, clean bool, workerCount int, opts Options) error {
+	// If clean is true, remove the cache file and the processed images
 	if clean {
 		if err := os.Remove(filepath.Join(outputDir, ".cache")); err != nil {
 			if !os.IsNotExist(err) {
 				return fmt.Errorf("error removing cache: %w", err)
 			}
 		}
+		if err := os.RemoveAll(filepath.FromSlash(images.CacheDir)); err != nil {
+			return fmt.Errorf("error removing image cache: %w", err)
+		}
+	}
+
+	// Load the configuration, which lists the plugins to load
+	loadedConfig, err := LoadConfiguration()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
 	}
 
 	// Load plugins
-	loadedPlugins, err := LoadPlugins()
+	manager := opts.Plugins
+	if manager == nil {
+		manager = plugins.NewManager()
+		defer manager.Kill()
+	}
+	b := &buildContext{Options: opts, site: newPluginSite()}
+	if err := b.site.setConfig(loadedConfig); err != nil {
+		return err
+	}
+	manager.SetSite(b.site)
+	defer manager.SetSite(nil)
+	loadedPlugins, err := LoadPlugins(loadedConfig, manager)
 	if err != nil {
 		return fmt.Errorf("error loading plugins: %w", err)
 	}
@@ -513,8 +1547,15 @@ func Build(outputDir string, clean bool, workerCount int) error {
 		return fmt.Errorf("error creating output directory: %w", err)
 	}
 
+	// Load the minifier, which minifies the files copied from the public
+	// directory and the generated pages
+	b.minifier, err = LoadMinifier(loadedConfig, opts.Minify)
+	if err != nil {
+		return err
+	}
+
 	// Copy the public directory
-	if err := CopyPublicDirectory(outputDir); err != nil {
+	if err := CopyPublicDirectory(outputDir, loadedConfig, b.minifier, loadedPlugins, workerCount); err != nil {
 		return err
 	}
 
@@ -523,12 +1564,6 @@ func Build(outputDir string, clean bool, workerCount int) error {
 		return err
 	}
 
-	// Process content
-	loadedConfig, err := LoadConfiguration()
-	if err != nil {
-		return fmt.Errorf("error loading config: %w", err)
-	}
-
 	// Run OnConfigLoaded hooks
 	configBytes, err := yaml.Marshal(loadedConfig)
 	if err != nil {
@@ -541,14 +1576,72 @@ func Build(outputDir string, clean bool, workerCount int) error {
 	if err := yaml.Unmarshal(configBytes, &loadedConfig); err != nil {
 		return fmt.Errorf("error unmarshalling config: %w", err)
 	}
+	if err := b.site.setConfig(loadedConfig); err != nil {
+		return err
+	}
+
+	// Load the languages of the site. Pages are rendered again when the
+	// languages, their strings or the translations of the pages change.
+	b.languages, err = LoadLanguages(loadedConfig)
+	if err != nil {
+		return err
+	}
+
+	// Fingerprint the public assets. Pages are rendered again when they
+	// change, as they may link to them.
+	manifest, err := FingerprintAssets(outputDir, loadedConfig)
+	if err != nil {
+		return err
+	}
+	b.assets = manifest.Hash()
+
+	// Bundle the scripts and stylesheets known before the content is
+	// processed. Pages are rendered again when they change, as they may link
+	// to them; the others are bundled when a page first asks for them.
+	bundler, err := LoadBundler(outputDir, loadedConfig, b.minifier)
+	if err != nil {
+		return err
+	}
+	b.bundles = bundler.Manifest().Hash()
+
+	// Load the image processor. Pages are rendered again when the images
+	// used by the previous build change.
+	b.imageProcessor, err = LoadImages(outputDir, loadedConfig)
+	if err != nil {
+		return err
+	}
+	b.images = b.imageProcessor.Hash()
+
+	// Load the template functions registered by plugins, along with the ones
+	// resolving assets, bundles and images and translating strings
+	builtin := []template.FuncMap{manifest.Funcs(), bundler.Funcs(), b.imageProcessor.Funcs(), b.languages.Funcs()}
+	funcs, err := LoadTemplateFuncs(loadedPlugins, builtin...)
+	if err != nil {
+		return fmt.Errorf("error loading template functions: %w", err)
+	}
+	for _, fm := range builtin {
+		for name, fn := range fm {
+			funcs[name] = fn
+		}
+	}
 
 	// Load partials
-	t, err := LoadPartials()
+	t, err := LoadPartials(funcs)
 	if err != nil {
 		return fmt.Errorf("error loading partials: %w", err)
 	}
 
-	if err := ProcessContent(outputDir, loadedConfig, t, loadedPlugins, workerCount); err != nil {
+	if err := processContent(outputDir, loadedConfig, t, loadedPlugins, workerCount, b); err != nil {
+		return err
+	}
+
+	// Record the bundles and remove the outdated ones
+	if err := bundler.Finish(); err != nil {
+		return err
+	}
+
+	// Record the images used by the build
+	if err := b.imageProcessor.Finish(); err != nil {
 		return err
 	}
 
@@ -557,5 +1650,15 @@ func Build(outputDir string, clean bool, workerCount int) error {
 		return err
 	}
 
+	// Report the problems found by plugins
+	if err := b.site.reportDiagnostics(); err != nil {
+		return err
+	}
+
+	// Check the generated site for broken links
+	if err := CheckLinks(outputDir, opts.StrictLinks); err != nil {
+		return err
+	}
+
 	return nil
 }
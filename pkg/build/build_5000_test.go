@@ -1,11 +1,18 @@
 package build_test
 
 import (
+	"fmt"
 	"os"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/Bitlatte/evoke/pkg/build"
+	"github.com/Bitlatte/evoke/pkg/plugin/sdk"
+	"github.com/Bitlatte/evoke/pkg/plugin/sdk/sdktest"
+	"github.com/Bitlatte/evoke/pkg/plugins"
+	"github.com/Bitlatte/evoke/proto"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 func BenchmarkBuild5000(b *testing.B) {
@@ -39,9 +46,87 @@ func BenchmarkBuild5000(b *testing.B) {
 		// measurement of a clean build.
 		os.RemoveAll("dist")
 
-		err = build.Build("dist", true, runtime.NumCPU())
+		err = build.Build("dist", true, runtime.NumCPU(), build.Options{})
 		if err != nil {
 			b.Fatal(err)
 		}
 	}
 }
+
+// benchmarkPlugin counts the words of every page and handles text files with
+// a pipeline.
+type benchmarkPlugin struct {
+	sdk.Base
+	concurrent bool
+}
+
+func (p *benchmarkPlugin) ConcurrencySafe() bool { return p.concurrent }
+func (p *benchmarkPlugin) OnContentRenderFile(file *proto.ContentFile) (*proto.ContentFile, error) {
+	words := len(strings.Fields(string(file.Content)))
+	file.Metadata.Fields["words"] = structpb.NewNumberValue(float64(words))
+	return file, nil
+}
+func (p *benchmarkPlugin) OnHTMLRendered(path string, content []byte) ([]byte, error) {
+	return content, nil
+}
+func (p *benchmarkPlugin) RegisterPipelines() ([]*proto.Pipeline, error) {
+	return []*proto.Pipeline{{Name: "text", Extensions: []string{".txt"}}}, nil
+}
+func (p *benchmarkPlugin) Capabilities() []string {
+	return []string{plugins.HookOnContentRender, plugins.HookOnHTMLRendered, plugins.HookRegisterPipelines, plugins.HookProcessAsset}
+}
+
+// BenchmarkBuild5000_Plugin measures the content processing of a site with
+// 5000 pages and 1000 text files with a plugin implementing two content hooks
+// and a pipeline for the text files, served over gRPC.
+func BenchmarkBuild5000_Plugin(b *testing.B) {
+	for _, concurrent := range []bool{false, true} {
+		name := "Serial"
+		if concurrent {
+			name = "ConcurrencySafe"
+		}
+		b.Run(name, func(b *testing.B) {
+			tmpDir, err := os.MkdirTemp("", "evoke-benchmark-5000-plugin")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			originalWd, err := os.Getwd()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := os.Chdir(tmpDir); err != nil {
+				b.Fatal(err)
+			}
+			defer os.Chdir(originalWd)
+
+			generateBenchmarkSite(b, 5000)
+			for i := 0; i < 1000; i++ {
+				os.WriteFile(fmt.Sprintf("content/posts/note-%d.txt", i), []byte("A note"), 0644)
+			}
+
+			loadedConfig, err := build.LoadConfiguration()
+			if err != nil {
+				b.Fatal(err)
+			}
+			partials, err := build.LoadPartials(nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			plugin := sdktest.Start(b, &benchmarkPlugin{concurrent: concurrent}, nil)
+
+			b.ResetTimer()
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				os.RemoveAll("dist")
+
+				err = build.ProcessContent("dist", loadedConfig, partials, []plugins.Plugin{plugin}, runtime.NumCPU(), build.Options{})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,15 +1,41 @@
 package build_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/Bitlatte/evoke/pkg/assets"
 	"github.com/Bitlatte/evoke/pkg/build"
+	"github.com/Bitlatte/evoke/pkg/bundle"
+	"github.com/Bitlatte/evoke/pkg/plugin/sdk"
+	"github.com/Bitlatte/evoke/pkg/plugins"
+	"github.com/Bitlatte/evoke/pkg/search"
+	"github.com/Bitlatte/evoke/proto"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
+// pagesPlugin is a plugin that only generates pages.
+type pagesPlugin struct {
+	sdk.Base
+	pages []*proto.GeneratedPage
+}
+
+func (p *pagesPlugin) Name() string { return "pages" }
+func (p *pagesPlugin) GeneratePages() ([]*proto.GeneratedPage, error) {
+	return p.pages, nil
+}
+
 func TestBuild(t *testing.T) {
 	// Create a temporary directory for the test
 	tmpDir, err := os.MkdirTemp("", "evoke-test")
@@ -37,7 +63,7 @@ func TestBuild(t *testing.T) {
 	os.WriteFile("public/style.css", []byte("body { color: red; }"), 0644)
 
 	// Run the build
-	err = build.Build("dist", false, runtime.NumCPU())
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
 	assert.NoError(t, err)
 
 	// Assert the results
@@ -47,13 +73,946 @@ func TestBuild(t *testing.T) {
 	// Verify the content of the created file
 	content, err := os.ReadFile("dist/index.html")
 	assert.NoError(t, err)
-	assert.Contains(t, string(content), "<html><body><h1>Hello World</h1>\n</body></html>")
+	assert.Contains(t, string(content), "<html><body><h1 id=\"hello-world\">Hello World</h1>\n</body></html>")
 
 	css, err := os.ReadFile("dist/style.css")
 	assert.NoError(t, err)
 	assert.Equal(t, "body { color: red; }", string(css))
 }
 
+func TestBuild_TableOfContents(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	os.Mkdir("content", 0755)
+	os.WriteFile("content/_layout.html", []byte(`{{ .Page.TableOfContents.HTML }}{{ range .Page.TableOfContents.Entries }}[{{ .ID }}]{{ end }}{{ len .TableOfContents.Entries }}`), 0644)
+	os.WriteFile("content/guide.md", []byte("## Install\n\n## Usage\n"), 0644)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	content, err := os.ReadFile("dist/guide.html")
+	assert.NoError(t, err)
+	assert.Equal(t, `<nav class="toc"><ul><li><a href="#install">Install</a></li><li><a href="#usage">Usage</a></li></ul></nav>[install][usage]2`, string(content))
+}
+
+func TestBuild_FingerprintsAssets(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	// Create a page linking to a fingerprinted stylesheet
+	os.Mkdir("content", 0755)
+	os.MkdirAll("public/css", 0755)
+	os.WriteFile("evoke.yaml", []byte("assets:\n  fingerprint: [\"css/*.css\"]\n"), 0644)
+	os.WriteFile("content/_layout.html", []byte(`<link rel="stylesheet" href="{{ asset "css/style.css" }}" {{ integrity "css/style.css" }}>`), 0644)
+	os.WriteFile("content/index.md", []byte("Hi"), 0644)
+	os.WriteFile("public/css/style.css", []byte("body { color: red; }"), 0644)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+
+	manifest, err := assets.ReadManifest("dist/manifest.json")
+	assert.NoError(t, err)
+	first := manifest["css/style.css"]
+	assert.FileExists(t, "dist/"+first.File)
+	assert.NoFileExists(t, "dist/css/style.css")
+	content, err := os.ReadFile("dist/index.html")
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf(`<link rel="stylesheet" href="/%s" integrity="%s" crossorigin="anonymous">`, first.File, first.Integrity), string(content))
+
+	// Unchanged fingerprinted files aren't copied again
+	copied, err := os.Stat("dist/" + first.File)
+	assert.NoError(t, err)
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	info, err := os.Stat("dist/" + first.File)
+	assert.NoError(t, err)
+	assert.Equal(t, copied.ModTime(), info.ModTime())
+	assert.NoFileExists(t, "dist/css/style.css")
+
+	// Pages link to the new file once the stylesheet changes
+	os.WriteFile("public/css/style.css", []byte("body { color: blue; }"), 0644)
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+
+	manifest, err = assets.ReadManifest("dist/manifest.json")
+	assert.NoError(t, err)
+	second := manifest["css/style.css"]
+	assert.NotEqual(t, first.File, second.File)
+	assert.NoFileExists(t, "dist/"+first.File)
+	content, err = os.ReadFile("dist/index.html")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), second.File)
+
+	// Files are renamed back once they're no longer fingerprinted
+	os.WriteFile("evoke.yaml", []byte(""), 0644)
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	assert.FileExists(t, "dist/css/style.css")
+	assert.NoFileExists(t, "dist/"+second.File)
+}
+
+func TestBuild_BundlesAssets(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	// Create a page linking to a bundled script and a configured stylesheet
+	os.Mkdir("content", 0755)
+	os.MkdirAll("assets/js", 0755)
+	os.MkdirAll("assets/css", 0755)
+	os.WriteFile("evoke.yaml", []byte("bundle:\n  entries: [css/main.css]\n"), 0644)
+	os.WriteFile("content/_layout.html", []byte(`{{ $js := bundle "js/main.ts" }}<script src="{{ $js }}" {{ $js.Integrity }}></script>`), 0644)
+	os.WriteFile("content/index.md", []byte("Hi"), 0644)
+	os.WriteFile("assets/js/main.ts", []byte("const answer: number = 42;\nconsole.log(answer);\n"), 0644)
+	os.WriteFile("assets/css/main.css", []byte("body { color: red; }\n"), 0644)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+
+	manifest, err := bundle.ReadManifest("dist/bundles.json")
+	assert.NoError(t, err)
+	assert.Len(t, manifest, 2)
+	first := manifest["js/main.ts"]
+	assert.FileExists(t, "dist/"+first.File)
+	assert.FileExists(t, "dist/"+first.File+".map")
+	assert.FileExists(t, "dist/"+manifest["css/main.css"].File)
+	content, err := os.ReadFile("dist/index.html")
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf(`<script src="/%s" integrity="%s" crossorigin="anonymous"></script>`, first.File, first.SRI), string(content))
+
+	// Pages link to the new bundle once a script changes
+	os.WriteFile("assets/js/main.ts", []byte("const answer: number = 43;\nconsole.log(answer);\n"), 0644)
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+
+	manifest, err = bundle.ReadManifest("dist/bundles.json")
+	assert.NoError(t, err)
+	second := manifest["js/main.ts"]
+	assert.NotEqual(t, first.File, second.File)
+	assert.NoFileExists(t, "dist/"+first.File)
+	content, err = os.ReadFile("dist/index.html")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), second.File)
+
+	// Bundling errors fail the build
+	os.WriteFile("assets/js/main.ts", []byte("import \"./missing\";\n"), 0644)
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.ErrorContains(t, err, "error bundling js/main.ts")
+}
+
+func TestBuild_ProcessesImages(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	os.MkdirAll("content/blog", 0755)
+	os.MkdirAll("public/img", 0755)
+	os.MkdirAll("assets", 0755)
+	img := image.NewNRGBA(image.Rect(0, 0, 1000, 500))
+	buf := new(bytes.Buffer)
+	assert.NoError(t, png.Encode(buf, img))
+	os.WriteFile("public/img/hero.png", buf.Bytes(), 0644)
+	os.WriteFile("assets/logo.png", buf.Bytes(), 0644)
+	os.WriteFile("evoke.yaml", []byte("images:\n  widths: [300, 600]\n"), 0644)
+	os.WriteFile("content/_layout.html", []byte(`{{ $logo := image "logo.png" }}{{ $small := $logo.Resize "100x" }}<img src="{{ $small }}" width="{{ $small.Width }}" height="{{ $small.Height }}">{{ .Content }}`), 0644)
+	os.WriteFile("content/blog/post.md", []byte("![Hero](/img/hero.png)\n\n![Remote](https://example.com/a.png)\n"), 0644)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+
+	content, err := os.ReadFile("dist/blog/post.html")
+	assert.NoError(t, err)
+	assert.Regexp(t, `^<img src="/logo\.100x50\.\w+\.png" width="100" height="50">`, string(content))
+	assert.Regexp(t, `<img src="/img/hero\.600x300\.\w+\.png" alt="Hero" srcset="/img/hero\.300x150\.\w+\.png 300w, /img/hero\.600x300\.\w+\.png 600w" sizes="\(max-width: 600px\) 100vw, 600px" width="600" height="300" loading="lazy" decoding="async">`, string(content))
+	assert.Contains(t, string(content), `<img src="https://example.com/a.png" alt="Remote">`)
+	matches, err := filepath.Glob("dist/img/hero.*x*.png")
+	assert.NoError(t, err)
+	assert.Len(t, matches, 2)
+
+	// The processed images are cached out of the output directory
+	cached, err := filepath.Glob(".evoke/images/*.png")
+	assert.NoError(t, err)
+	assert.Len(t, cached, 3)
+	assert.NoDirExists(t, "dist/.evoke")
+
+	// Broken images fail the build
+	os.WriteFile("public/img/hero.png", []byte("not an image"), 0644)
+	os.WriteFile("content/blog/post.md", []byte("![Hero](hero.png)\n"), 0644)
+	os.MkdirAll("public/blog", 0755)
+	os.WriteFile("public/blog/hero.png", []byte("not an image"), 0644)
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.ErrorContains(t, err, "error decoding image blog/hero.png")
+}
+
+func TestBuild_Minify(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	os.MkdirAll("content/blog", 0755)
+	os.MkdirAll("public/css", 0755)
+	os.WriteFile("content/_layout.html", []byte("<html>\n  <body>\n    {{ .Content }}\n  </body>\n</html>\n"), 0644)
+	os.WriteFile("content/index.md", []byte("Hi"), 0644)
+	os.WriteFile("content/blog/post.css", []byte("p {\n  margin: 0px;\n}\n"), 0644)
+	os.WriteFile("public/css/style.css", []byte("body {\n  color: #ff0000;\n}\n"), 0644)
+	os.WriteFile("public/css/vendor.min.css", []byte("a {\n  color: blue;\n}\n"), 0644)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	content, err := os.ReadFile("dist/index.html")
+	assert.NoError(t, err)
+	assert.Equal(t, "<html>\n  <body>\n    <p>Hi</p>\n\n  </body>\n</html>\n", string(content))
+	content, err = os.ReadFile("dist/blog/post.css")
+	assert.NoError(t, err)
+	assert.Equal(t, "p {\n  margin: 0px;\n}\n", string(content))
+
+	// The flag turns minification on and rebuilds the pages
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{Minify: true})
+	assert.NoError(t, err)
+	content, err = os.ReadFile("dist/index.html")
+	assert.NoError(t, err)
+	assert.Equal(t, "<html><body><p>Hi</p></body></html>", string(content))
+	content, err = os.ReadFile("dist/css/style.css")
+	assert.NoError(t, err)
+	assert.Equal(t, "body{color:red}", string(content))
+	content, err = os.ReadFile("dist/blog/post.css")
+	assert.NoError(t, err)
+	assert.Equal(t, "p{margin:0}", string(content))
+	content, err = os.ReadFile("dist/css/vendor.min.css")
+	assert.NoError(t, err)
+	assert.Equal(t, "a {\n  color: blue;\n}\n", string(content))
+
+	// Types can be turned off in the configuration
+	os.WriteFile("evoke.yaml", []byte("minify:\n  enabled: true\n  css: false\n"), 0644)
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	content, err = os.ReadFile("dist/css/style.css")
+	assert.NoError(t, err)
+	assert.Equal(t, "body {\n  color: #ff0000;\n}\n", string(content))
+	content, err = os.ReadFile("dist/index.html")
+	assert.NoError(t, err)
+	assert.Equal(t, "<html><body><p>Hi</p></body></html>", string(content))
+}
+
+func TestBuild_CopiesPublicIncrementally(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	os.Mkdir("content", 0755)
+	os.MkdirAll("public/js", 0755)
+	os.WriteFile("content/index.md", []byte("Hi"), 0644)
+	os.WriteFile("public/robots.txt", []byte("User-agent: *"), 0644)
+	os.WriteFile("public/old.txt", []byte("old"), 0644)
+	os.WriteFile("public/js/run.sh", []byte("#!/bin/sh"), 0755)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	info, err := os.Stat("dist/js/run.sh")
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	// Unchanged files aren't copied again, even when touched
+	copied, err := os.Stat("dist/robots.txt")
+	assert.NoError(t, err)
+	future := time.Now().Add(time.Hour)
+	os.Chtimes("public/robots.txt", future, future)
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	info, err = os.Stat("dist/robots.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, copied.ModTime(), info.ModTime())
+
+	// Changed files, and copies changed since, are copied again while the
+	// copies of removed files are removed
+	os.WriteFile("public/robots.txt", []byte("User-agent: evoke"), 0644)
+	os.WriteFile("dist/js/run.sh", []byte("changed"), 0755)
+	os.Remove("public/old.txt")
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	content, err := os.ReadFile("dist/robots.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "User-agent: evoke", string(content))
+	content, err = os.ReadFile("dist/js/run.sh")
+	assert.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh", string(content))
+	assert.NoFileExists(t, "dist/old.txt")
+
+	// Files are hard linked when configured
+	os.WriteFile("evoke.yaml", []byte("assets:\n  link: hardlink\n"), 0644)
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	src, err := os.Stat("public/robots.txt")
+	assert.NoError(t, err)
+	dest, err := os.Stat("dist/robots.txt")
+	assert.NoError(t, err)
+	assert.True(t, os.SameFile(src, dest))
+
+	// But copied when plugins are loaded, as they could change the originals
+	// through the links
+	loadedConfig := map[string]interface{}{"assets": map[string]interface{}{"link": "hardlink"}}
+	err = build.CopyPublicDirectory("dist", loadedConfig, nil, []plugins.Plugin{&metadataPlugin{}}, runtime.NumCPU())
+	assert.NoError(t, err)
+	dest, err = os.Stat("dist/robots.txt")
+	assert.NoError(t, err)
+	assert.False(t, os.SameFile(src, dest))
+
+	os.WriteFile("evoke.yaml", []byte("assets:\n  link: symlink\n"), 0644)
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.ErrorContains(t, err, "unknown link symlink")
+}
+
+func TestBuild_PublicCollision(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	os.MkdirAll("content/about", 0755)
+	os.MkdirAll("public/about", 0755)
+	os.WriteFile("content/about/index.md", []byte("About"), 0644)
+	os.WriteFile("public/about/index.html", []byte("<p>About</p>"), 0644)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.ErrorContains(t, err, filepath.Join("public", "about", "index.html"))
+
+	// Other files of the content directory can't overwrite them either
+	os.Remove("public/about/index.html")
+	os.WriteFile("content/about/style.css", []byte("p { color: red; }"), 0644)
+	os.WriteFile("public/about/style.css", []byte("p { color: blue; }"), 0644)
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.ErrorContains(t, err, filepath.Join("content", "about", "style.css"))
+	assert.ErrorContains(t, err, filepath.Join("public", "about", "style.css"))
+}
+
+func TestBuild_SearchIndex(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	os.MkdirAll("content/blog", 0755)
+	os.WriteFile("content/_layout.html", []byte("<html><head><title>Site</title></head><body><nav>Menu</nav><main>{{ .Content }}</main></body></html>"), 0644)
+	os.WriteFile("content/index.md", []byte("---\ntitle: Home\n---\n# Welcome\n\nHello there."), 0644)
+	os.WriteFile("content/blog/post.md", []byte("# A Post\n\n## Details\n\nSome text."), 0644)
+	os.WriteFile("content/404.md", []byte("---\nsearch: false\n---\nNot found."), 0644)
+
+	// The index is only written when enabled
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	assert.NoFileExists(t, "dist/search.json")
+
+	os.WriteFile("evoke.yaml", []byte("search:\n  enabled: true\n"), 0644)
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+
+	var index struct {
+		Documents []*search.Document `json:"documents"`
+	}
+	data, err := os.ReadFile("dist/search.json")
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &index))
+	assert.Equal(t, []*search.Document{
+		{
+			URL:      "/blog/post.html",
+			Title:    "Site",
+			Headings: []search.Heading{{ID: "a-post", Text: "A Post"}, {ID: "details", Text: "Details"}},
+			Text:     "A Post Details Some text.",
+		},
+		{
+			URL:      "/index.html",
+			Title:    "Home",
+			Headings: []search.Heading{{ID: "welcome", Text: "Welcome"}},
+			Text:     "Welcome Hello there.",
+		},
+	}, index.Documents)
+
+	// The index is removed once search is disabled
+	os.WriteFile("evoke.yaml", []byte(""), 0644)
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	assert.NoFileExists(t, "dist/search.json")
+}
+
+func TestBuild_Multilingual(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	os.MkdirAll("content/ja", 0755)
+	os.MkdirAll("i18n", 0755)
+	os.MkdirAll("partials/shortcodes", 0755)
+	os.WriteFile("evoke.yaml", []byte("languages:\n  - code: en\n  - code: de\n  - code: ja\n    dir: ja\n"), 0644)
+	os.WriteFile("partials/shortcodes/more.html", []byte(`<em>{{ i18n "readMore" }} ({{ .Site.Language }}, {{ len .Site.Pages }})</em>`), 0644)
+	os.WriteFile("i18n/en.yaml", []byte("readMore: Read more\npages: \"%d pages\"\n"), 0644)
+	os.WriteFile("i18n/de.yaml", []byte("readMore: Weiterlesen\n"), 0644)
+	os.WriteFile("content/_layout.html", []byte(`<html lang="{{ .Page.Language }}"><body>{{ i18n "readMore" }}, {{ i18n "pages" (len .Site.Pages) }}{{ range .Page.Translations }}<link rel="alternate" hreflang="{{ .Language }}" href="{{ .URL }}">{{ end }}{{ .Content }}</body></html>`), 0644)
+	os.WriteFile("content/guide.md", []byte("[Install](install.md)"), 0644)
+	os.WriteFile("content/guide.de.md", []byte("[Installation](install.md)"), 0644)
+	os.WriteFile("content/install.md", []byte("Install"), 0644)
+	os.WriteFile("content/install.de.md", []byte("Installation {{< more >}}"), 0644)
+	os.WriteFile("content/ja/guide.md", []byte("ガイド"), 0644)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+
+	// Pages in the default language are published at the root
+	content, err := os.ReadFile("dist/guide.html")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `<html lang="en">`)
+	assert.Contains(t, string(content), "Read more, 2 pages")
+	assert.Contains(t, string(content), `<link rel="alternate" hreflang="de" href="/de/guide.html"><link rel="alternate" hreflang="ja" href="/ja/guide.html">`)
+
+	// Pages in other languages are published under their code, whether their
+	// name ends with it or they are in the directory of the language
+	content, err = os.ReadFile("dist/de/guide.html")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `<html lang="de">`)
+	assert.Contains(t, string(content), "Weiterlesen, 2 pages")
+	assert.Contains(t, string(content), `<a href="install.html">Installation</a>`)
+	assert.NoFileExists(t, "dist/guide.de.html")
+
+	// Shortcodes get the strings and the site of the language of the page
+	content, err = os.ReadFile("dist/de/install.html")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "Installation <em>Weiterlesen (de, 2)</em>")
+	content, err = os.ReadFile("dist/ja/guide.html")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `<html lang="ja">`)
+	assert.Contains(t, string(content), "Read more, 1 pages")
+
+	// Pages are rendered again when the strings change
+	os.WriteFile("i18n/de.yaml", []byte("readMore: Mehr lesen\n"), 0644)
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	content, err = os.ReadFile("dist/de/guide.html")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "Mehr lesen, 2 pages")
+	content, err = os.ReadFile("dist/de/install.html")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "<em>Mehr lesen (de, 2)</em>")
+}
+
+func TestBuild_SitemapsAndFeeds(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	os.Mkdir("content", 0755)
+	os.WriteFile("evoke.yaml", []byte("languages:\n  - code: en\n  - code: de\nsitemap:\n  enabled: true\nfeeds:\n  enabled: true\n"), 0644)
+	os.WriteFile("content/_layout.html", []byte("{{ .Content }}"), 0644)
+	os.WriteFile("content/post.md", []byte("---\ntitle: Post\ndate: 2024-03-01\n---\n"), 0644)
+	os.WriteFile("content/post.de.md", []byte("---\ntitle: Beitrag\ndate: 2024-03-02\n---\n"), 0644)
+	os.WriteFile("content/about.md", []byte("---\ntitle: About\n---\n"), 0644)
+	os.WriteFile("content/hidden.md", []byte("---\ntitle: Hidden\ndate: 2024-03-03\nsitemap: false\nfeed: false\n---\n"), 0644)
+
+	// Sitemaps and feeds need the URL of the site
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.ErrorContains(t, err, "baseURL")
+
+	os.WriteFile("evoke.yaml", []byte("baseURL: https://example.com\nsiteName: Blog\nlanguages:\n  - code: en\n  - code: de\nsitemap:\n  enabled: true\nfeeds:\n  enabled: true\n"), 0644)
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+
+	// Each language gets a sitemap, listed by the sitemap index, whose pages
+	// link to their translations
+	content, err := os.ReadFile("dist/sitemap.xml")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "<loc>https://example.com/sitemap.en.xml</loc>")
+	assert.Contains(t, string(content), "<loc>https://example.com/sitemap.de.xml</loc>")
+	content, err = os.ReadFile("dist/sitemap.en.xml")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "<loc>https://example.com/about.html</loc>")
+	assert.Contains(t, string(content), `<xhtml:link rel="alternate" hreflang="de" href="https://example.com/de/post.html"></xhtml:link>`)
+	assert.NotContains(t, string(content), "hidden.html")
+	content, err = os.ReadFile("dist/sitemap.de.xml")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "<loc>https://example.com/de/post.html</loc>")
+	assert.NotContains(t, string(content), "about.html")
+
+	// Each language gets feeds of its dated pages under its home
+	content, err = os.ReadFile("dist/feed.xml")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "<title>Blog</title>")
+	assert.Contains(t, string(content), "<link>https://example.com/post.html</link>")
+	assert.Contains(t, string(content), `<atom:link rel="alternate" hreflang="de" href="https://example.com/de/post.html"></atom:link>`)
+	assert.NotContains(t, string(content), "about.html")
+	assert.NotContains(t, string(content), "hidden.html")
+	content, err = os.ReadFile("dist/de/atom.xml")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `<feed xmlns="http://www.w3.org/2005/Atom" xml:lang="de">`)
+	assert.Contains(t, string(content), `<link rel="alternate" hreflang="en" href="https://example.com/post.html"></link>`)
+	assert.FileExists(t, "dist/atom.xml")
+	assert.FileExists(t, "dist/de/feed.xml")
+
+	// They are removed once disabled
+	os.WriteFile("evoke.yaml", []byte("baseURL: https://example.com\nlanguages:\n  - code: en\n  - code: de\n"), 0644)
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	for _, path := range []string{"dist/sitemap.xml", "dist/sitemap.en.xml", "dist/sitemap.de.xml", "dist/feed.xml", "dist/atom.xml", "dist/de/feed.xml", "dist/de/atom.xml"} {
+		assert.NoFileExists(t, path)
+	}
+}
+
+func TestBuild_ShortcodeChangeRebuildsDependents(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	// Create a page using a shortcode and a page without one
+	os.Mkdir("content", 0755)
+	os.MkdirAll("partials/shortcodes", 0755)
+	os.WriteFile("content/_layout.html", []byte("{{.Content}}"), 0644)
+	os.WriteFile("content/a.md", []byte("{{< note >}}\nHi\n{{< /note >}}"), 0644)
+	os.WriteFile("content/b.md", []byte("Plain"), 0644)
+	os.WriteFile("partials/shortcodes/note.html", []byte("<aside>{{ .Inner }}</aside>"), 0644)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	content, err := os.ReadFile("dist/a.html")
+	assert.NoError(t, err)
+	assert.Equal(t, "<aside><p>Hi</p></aside>\n", string(content))
+
+	// Change the shortcode and remove the output of the page not using it
+	os.Remove("dist/b.html")
+	os.WriteFile("partials/shortcodes/note.html", []byte("<div>{{ .Inner }}</div>"), 0644)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+
+	content, err = os.ReadFile("dist/a.html")
+	assert.NoError(t, err)
+	assert.Equal(t, "<div><p>Hi</p></div>\n", string(content))
+	assert.NoFileExists(t, "dist/b.html")
+}
+
+func TestBuild_EscapedShortcodesWithoutShortcodes(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	// Escaped shortcodes are shown literally without a shortcodes directory
+	os.Mkdir("content", 0755)
+	os.WriteFile("content/_layout.html", []byte("{{.Content}}"), 0644)
+	os.WriteFile("content/a.md", []byte("Use `{{</* note */>}}`.\n\n```\n{{</* note */>}}\n```\n"), 0644)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	content, err := os.ReadFile("dist/a.html")
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>Use <code>{{&lt; note &gt;}}</code>.</p>\n<pre><code>{{&lt; note &gt;}}\n</code></pre>\n", string(content))
+}
+
+func TestBuild_UnpublishedPages(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	// Create a published page, a draft and a future page
+	os.Mkdir("content", 0755)
+	os.WriteFile("content/_layout.html", []byte("{{range .Site.Pages}}[{{.Title}}]{{end}}"), 0644)
+	os.WriteFile("content/index.md", []byte("---\ntitle: Home\ndate: 2024-01-01\n---\n"), 0644)
+	os.WriteFile("content/draft.md", []byte("---\ntitle: Draft\ndraft: true\n---\n"), 0644)
+	os.WriteFile("content/future.md", []byte("---\ntitle: Future\npublishDate: 2999-01-01\n---\n"), 0644)
+
+	// Build without unpublished pages
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	assert.NoFileExists(t, "dist/draft.html")
+	assert.NoFileExists(t, "dist/future.html")
+	content, err := os.ReadFile("dist/index.html")
+	assert.NoError(t, err)
+	assert.Equal(t, "[Home]", string(content))
+
+	// Build with drafts, reusing the cache of the previous build
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{Drafts: true})
+	assert.NoError(t, err)
+	assert.FileExists(t, "dist/draft.html")
+	content, err = os.ReadFile("dist/index.html")
+	assert.NoError(t, err)
+	assert.Equal(t, "[Home][Draft]", string(content))
+
+	// Build without drafts again, which removes the draft's output
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	assert.NoFileExists(t, "dist/draft.html")
+}
+
+func TestBuild_DataChangeRebuildsDependents(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	// Create a layout using one data file, and a data file nobody uses
+	os.MkdirAll("content/team", 0755)
+	os.MkdirAll("data/team", 0755)
+	os.WriteFile("content/team/_layout.html", []byte("{{range .Site.Data.team.members}}{{.name}};{{end}}"), 0644)
+	os.WriteFile("content/team/index.md", []byte("Team"), 0644)
+	os.WriteFile("content/about.md", []byte("About"), 0644)
+	os.WriteFile("data/team/members.yaml", []byte("- name: Ada\n"), 0644)
+	os.WriteFile("data/products.json", []byte("[]"), 0644)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	content, err := os.ReadFile("dist/team/index.html")
+	assert.NoError(t, err)
+	assert.Equal(t, "Ada;", string(content))
+
+	// Change both data files and remove the output of the unrelated page
+	os.Remove("dist/about.html")
+	os.WriteFile("data/team/members.yaml", []byte("- name: Ada\n- name: Linus\n"), 0644)
+	os.WriteFile("data/products.json", []byte("[1]"), 0644)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	content, err = os.ReadFile("dist/team/index.html")
+	assert.NoError(t, err)
+	assert.Equal(t, "Ada;Linus;", string(content))
+	assert.NoFileExists(t, "dist/about.html")
+}
+
+func TestBuild_DataChangeRebuildsPartialDependents(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	// Create a layout including a partial that uses a data file
+	os.MkdirAll("content", 0755)
+	os.MkdirAll("partials", 0755)
+	os.MkdirAll("data", 0755)
+	os.WriteFile("content/_layout.html", []byte(`{{ template "navbar.html" . }}{{ .Content }}`), 0644)
+	os.WriteFile("content/index.md", []byte("Home"), 0644)
+	os.WriteFile("partials/navbar.html", []byte("{{range .Site.Data.nav}}{{.}};{{end}}"), 0644)
+	os.WriteFile("data/nav.yaml", []byte("- Home\n"), 0644)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	content, err := os.ReadFile("dist/index.html")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "Home;")
+
+	// Changing the data file rebuilds the pages using the partial
+	os.WriteFile("data/nav.yaml", []byte("- Home\n- Blog\n"), 0644)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	content, err = os.ReadFile("dist/index.html")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "Home;Blog;")
+}
+
+func TestBuild_GeneratesPagesFromData(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	// Create a generator for the products and a page listing them
+	os.MkdirAll("content/products", 0755)
+	os.MkdirAll("content/list", 0755)
+	os.Mkdir("data", 0755)
+	os.WriteFile("content/_layout.html", []byte("<main>{{.Content}}</main>"), 0644)
+	os.WriteFile("content/list/_layout.html", []byte("{{range .Site.Pages}}[{{.URL}}]{{end}}"), 0644)
+	os.WriteFile("content/list/index.md", []byte("List"), 0644)
+	os.WriteFile("content/products/_generate.yaml", []byte("data: products\npath: \"{{ .slug }}\"\ntitle: \"{{ .name }}\"\nlayout: _product.html\n"), 0644)
+	os.WriteFile("content/products/_product.html", []byte("{{.Page.title}}"), 0644)
+	os.WriteFile("data/products.yaml", []byte("- slug: tea\n  name: Tea\n- slug: coffee\n  name: Coffee\n"), 0644)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	content, err := os.ReadFile("dist/products/tea.html")
+	assert.NoError(t, err)
+	assert.Equal(t, "<main>Tea</main>", string(content))
+	assert.FileExists(t, "dist/products/coffee.html")
+	content, err = os.ReadFile("dist/list/index.html")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "[/products/tea.html]")
+
+	// Removing an item removes its page, changing one rebuilds it
+	os.WriteFile("data/products.yaml", []byte("- slug: tea\n  name: Green Tea\n"), 0644)
+
+	err = build.Build("dist", false, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	content, err = os.ReadFile("dist/products/tea.html")
+	assert.NoError(t, err)
+	assert.Equal(t, "<main>Green Tea</main>", string(content))
+	assert.NoFileExists(t, "dist/products/coffee.html")
+}
+
+func TestProcessContent_PluginPages(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	os.Mkdir("content", 0755)
+	os.Mkdir("partials", 0755)
+	os.WriteFile("content/_layout.html", []byte("<title>{{.Page.title}}</title>{{.Content}}{{range .Site.Pages}}[{{.URL}}]{{end}}"), 0644)
+	os.WriteFile("content/index.md", []byte("Home"), 0644)
+
+	partials, err := build.LoadPartials(nil)
+	assert.NoError(t, err)
+	plugin := &pagesPlugin{pages: []*proto.GeneratedPage{
+		{Path: "api/users.md", FrontMatterJson: `{"title": "Users"}`, Content: []byte("# Users")},
+		{Path: "api/orders.md", Content: []byte("---\ntitle: Orders\n---\n# Orders")},
+	}}
+
+	err = build.ProcessContent("dist", map[string]interface{}{}, partials, []plugins.Plugin{plugin}, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	content, err := os.ReadFile("dist/api/users.html")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "<title>Users</title>")
+	assert.Contains(t, string(content), `<h1 id="users">Users</h1>`)
+	content, err = os.ReadFile("dist/index.html")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "[/api/orders.html]")
+	assert.Contains(t, string(content), "[/api/users.html]")
+
+	// Pages the plugin no longer generates are removed
+	plugin.pages = plugin.pages[:1]
+	err = build.ProcessContent("dist", map[string]interface{}{}, partials, []plugins.Plugin{plugin}, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+	assert.FileExists(t, "dist/api/users.html")
+	assert.NoFileExists(t, "dist/api/orders.html")
+
+	// Pages must not replace content files
+	plugin.pages = []*proto.GeneratedPage{{Path: "index.md"}}
+	err = build.ProcessContent("dist", map[string]interface{}{}, partials, []plugins.Plugin{plugin}, runtime.NumCPU(), build.Options{})
+	assert.Error(t, err)
+}
+
+// metadataPlugin computes the reading time of pages and marks their HTML.
+type metadataPlugin struct {
+	sdk.Base
+}
+
+func (p *metadataPlugin) Name() string { return "metadata" }
+func (p *metadataPlugin) OnContentRenderFile(file *proto.ContentFile) (*proto.ContentFile, error) {
+	words := len(strings.Fields(string(file.Content)))
+	file.Metadata.Fields["readingTime"] = structpb.NewNumberValue(float64(words))
+	file.Metadata.Fields["title"] = structpb.NewStringValue(strings.ToUpper(file.Metadata.Fields["title"].GetStringValue()))
+	return file, nil
+}
+func (p *metadataPlugin) OnHTMLRendered(path string, content []byte) ([]byte, error) {
+	return append(content, []byte("<!-- rendered -->")...), nil
+}
+
+func TestProcessContent_PluginMetadata(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	os.Mkdir("content", 0755)
+	os.Mkdir("partials", 0755)
+	os.WriteFile("content/_layout.html", []byte("<title>{{.Page.title}}</title><p>{{.Page.readingTime}} {{.Page.date.Year}}</p>{{.Content}}"), 0644)
+	os.WriteFile("content/index.md", []byte("---\ntitle: Home\ndate: 2024-01-02T00:00:00Z\n---\nthree short words"), 0644)
+
+	partials, err := build.LoadPartials(nil)
+	assert.NoError(t, err)
+	err = build.ProcessContent("dist", map[string]interface{}{}, partials, []plugins.Plugin{&metadataPlugin{}}, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+
+	content, err := os.ReadFile("dist/index.html")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "<title>HOME</title>")
+	// Values the plugin left alone keep their type
+	assert.Contains(t, string(content), "<p>3 2024</p>")
+	assert.Contains(t, string(content), "<p>three short words</p>\n<!-- rendered -->")
+}
+
+// pipelinePlugin renders text files as pages and counts how often its
+// pipelines are registered.
+type pipelinePlugin struct {
+	sdk.Base
+	registrations int32
+}
+
+func (p *pipelinePlugin) Name() string { return "pipeline" }
+func (p *pipelinePlugin) RegisterPipelines() ([]*proto.Pipeline, error) {
+	atomic.AddInt32(&p.registrations, 1)
+	return []*proto.Pipeline{{Name: "text", Extensions: []string{".txt"}}}, nil
+}
+func (p *pipelinePlugin) ProcessAsset(asset *proto.Asset) (*proto.Asset, error) {
+	asset.Path = strings.TrimSuffix(asset.Path, ".txt") + ".html"
+	asset.Content = []byte("<pre>" + string(asset.Content) + "</pre>")
+	return asset, nil
+}
+
+func TestProcessContent_PluginPipeline(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Change to the temporary directory
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir(tmpDir)
+	assert.NoError(t, err)
+	defer os.Chdir(originalWd)
+
+	os.Mkdir("content", 0755)
+	os.Mkdir("partials", 0755)
+	for i := 0; i < 10; i++ {
+		os.WriteFile(fmt.Sprintf("content/file-%d.txt", i), []byte("text"), 0644)
+	}
+
+	partials, err := build.LoadPartials(nil)
+	assert.NoError(t, err)
+	plugin := &pipelinePlugin{}
+	err = build.ProcessContent("dist", map[string]interface{}{}, partials, []plugins.Plugin{plugin}, runtime.NumCPU(), build.Options{})
+	assert.NoError(t, err)
+
+	content, err := os.ReadFile("dist/file-3.html")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "<pre>text</pre>")
+
+	// The pipelines are looked up once per build, not once per file
+	assert.Equal(t, int32(1), plugin.registrations)
+}
+
 func generateBenchmarkSite(b *testing.B, numPages int) {
 	// Create the necessary directories
 	os.MkdirAll("content/posts", 0755)
@@ -106,7 +1065,7 @@ func BenchmarkBuild(b *testing.B) {
 		// measurement of a clean build.
 		os.RemoveAll("dist")
 
-		err = build.Build("dist", true, runtime.NumCPU())
+		err = build.Build("dist", true, runtime.NumCPU(), build.Options{})
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -0,0 +1,357 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Bitlatte/evoke/pkg/assets"
+	"github.com/Bitlatte/evoke/pkg/cache"
+	"github.com/Bitlatte/evoke/pkg/config"
+	"github.com/Bitlatte/evoke/pkg/hash"
+	"github.com/Bitlatte/evoke/pkg/i18n"
+	"github.com/Bitlatte/evoke/pkg/logger"
+	"github.com/Bitlatte/evoke/pkg/minify"
+	"github.com/Bitlatte/evoke/pkg/pages"
+	"github.com/Bitlatte/evoke/pkg/plugins"
+	"github.com/Bitlatte/evoke/pkg/util"
+)
+
+// publicCacheKey prefixes the cache keys under which the state of each file
+// copied from the public directory is stored.
+const publicCacheKey = "evoke:public:"
+
+// Ways of copying the files of the public directory, as named by the link
+// setting of the assets section.
+const (
+	linkCopy     = "copy"
+	linkHardlink = "hardlink"
+	linkReflink  = "reflink"
+)
+
+// publicFile is the state of a file copied from the public directory, as
+// recorded in the cache.
+type publicFile struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`
+	Mode    uint32 `json:"mode"`
+	Hash    string `json:"hash"`
+	// OutputSize and OutputModTime are the size and modification time of
+	// the copy, to tell if something else changed it.
+	OutputSize    int64 `json:"outputSize"`
+	OutputModTime int64 `json:"outputModTime"`
+	// Method is how the file was copied, e.g. hardlink.
+	Method string `json:"method"`
+	// Output is the path of the copy relative to the output directory once
+	// it's fingerprinted, e.g. css/style.3f9a1c2b.css.
+	Output string `json:"output,omitempty"`
+}
+
+// CopyPublicDirectory copies the public directory to the output directory
+// with the given number of workers. Files that haven't changed since the
+// previous build are skipped, and the copies of files removed from the public
+// directory are removed. Files the minifier handles are minified, the others
+// are copied, hard linked or cloned as configured by the assets section of
+// the configuration. Files aren't hard linked when plugins are loaded, as a
+// plugin changing a copy in place would change the original too.
+func CopyPublicDirectory(outputDir string, loadedConfig map[string]interface{}, m *minify.Minifier, loadedPlugins []plugins.Plugin, workerCount int) error {
+	logger.Logger.Debug("Copying public directory...")
+	var cfg config.Assets
+	if err := config.Decode(loadedConfig, "assets", &cfg); err != nil {
+		return fmt.Errorf("error decoding assets config: %w", err)
+	}
+	link := cfg.Link
+	switch link {
+	case "":
+		link = linkCopy
+	case linkCopy, linkHardlink, linkReflink:
+	default:
+		return fmt.Errorf("unknown link %s in the assets config, it must be copy, hardlink or reflink", cfg.Link)
+	}
+	if link == linkHardlink && len(loadedPlugins) > 0 {
+		logger.Logger.Warn("Copying the public directory instead of hard linking it, as plugins could change the originals through the links")
+		link = linkCopy
+	}
+	if _, err := os.Stat("public"); os.IsNotExist(err) {
+		logger.Logger.Debug("No public directory found, skipping public copy.")
+		return nil
+	}
+
+	c, err := cache.New(filepath.Join(outputDir, ".cache"))
+	if err != nil {
+		return fmt.Errorf("error creating cache: %w", err)
+	}
+
+	// Create the directories while walking, then copy the files in parallel
+	var files []string
+	err = filepath.Walk("public", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(outputDir, path[len("public"):]), info.Mode().Perm())
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error copying public directory: %w", err)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		copied   atomic.Int64
+	)
+	jobs := make(chan string)
+	for i := 0; i < max(workerCount, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				ok, err := copyPublicFile(c, outputDir, path, link, m)
+				if err != nil {
+					errOnce.Do(func() { firstErr = fmt.Errorf("error copying %s: %w", path, err) })
+					continue
+				}
+				if ok {
+					copied.Add(1)
+				}
+			}
+		}()
+	}
+	for _, path := range files {
+		jobs <- path
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+
+	// Remove the copies of the files that are gone
+	current := make(map[string]bool, len(files))
+	for _, path := range files {
+		current[filepath.ToSlash(path)] = true
+	}
+	removed := 0
+	for _, key := range c.Keys(publicCacheKey) {
+		path := strings.TrimPrefix(key, publicCacheKey)
+		if current[path] {
+			continue
+		}
+		output := filepath.Join(outputDir, filepath.FromSlash(strings.TrimPrefix(path, "public/")))
+		var previous publicFile
+		if err := json.Unmarshal([]byte(c.Get(key)), &previous); err == nil && previous.Output != "" {
+			output = filepath.Join(outputDir, filepath.FromSlash(previous.Output))
+		}
+		if err := os.Remove(output); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing %s: %w", output, err)
+		}
+		c.Delete(key)
+		removed++
+	}
+
+	if err := c.Save(); err != nil {
+		return fmt.Errorf("error saving cache: %w", err)
+	}
+	logger.Logger.Debug("Public directory copied.", "copied", copied.Load(), "skipped", int64(len(files))-copied.Load(), "removed", removed)
+	return nil
+}
+
+// copyPublicFile copies the file at src to the output directory, unless it's
+// unchanged since the previous build, and records its state in the cache. It
+// reports whether the file was copied.
+func copyPublicFile(c *cache.Cache, outputDir, src, link string, m *minify.Minifier) (bool, error) {
+	dest := filepath.Join(outputDir, src[len("public"):])
+	info, err := os.Stat(src)
+	if err != nil {
+		return false, err
+	}
+	method := link
+	if m.Handles(src) {
+		method = "minify=" + m.String()
+	}
+	key := publicCacheKey + filepath.ToSlash(src)
+
+	// Skip the file if neither it nor its copy changed. Files touched
+	// without being modified are compared by hash, and fingerprinted copies
+	// are found under their fingerprinted name.
+	var previous publicFile
+	if err := json.Unmarshal([]byte(c.Get(key)), &previous); err == nil && previous.Method == method && previous.Mode == uint32(info.Mode().Perm()) {
+		copied := dest
+		if previous.Output != "" {
+			copied = filepath.Join(outputDir, filepath.FromSlash(previous.Output))
+		}
+		if output, err := os.Stat(copied); err == nil && output.Size() == previous.OutputSize && output.ModTime().UnixNano() == previous.OutputModTime {
+			if info.Size() == previous.Size && info.ModTime().UnixNano() == previous.ModTime {
+				return false, nil
+			}
+			if info.Size() == previous.Size {
+				h, err := hash.New(src)
+				if err != nil {
+					return false, err
+				}
+				if h == previous.Hash {
+					previous.ModTime = info.ModTime().UnixNano()
+					return false, setPublicFile(c, key, previous)
+				}
+			}
+		}
+	}
+
+	// Remove the previous copy first, as it may be a hard link to the file
+	// and writing to it would change the file itself
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	switch {
+	case m.Handles(src):
+		content, err := os.ReadFile(src)
+		if err != nil {
+			return false, err
+		}
+		content, err = m.Minify(src, content)
+		if err != nil {
+			return false, err
+		}
+		if err := os.WriteFile(dest, content, info.Mode().Perm()); err != nil {
+			return false, err
+		}
+		if err := os.Chmod(dest, info.Mode().Perm()); err != nil {
+			return false, err
+		}
+	case link == linkHardlink:
+		if err := os.Link(src, dest); err != nil {
+			// Hard links don't cross file systems
+			logger.Logger.Debug("Could not hard link, copying instead", "path", src, "error", err)
+			if err := util.CopyFile(src, dest); err != nil {
+				return false, err
+			}
+		}
+	case link == linkReflink:
+		if err := util.CloneFile(src, dest); err != nil {
+			logger.Logger.Debug("Could not clone, copying instead", "path", src, "error", err)
+			if err := util.CopyFile(src, dest); err != nil {
+				return false, err
+			}
+		}
+	default:
+		if err := util.CopyFile(src, dest); err != nil {
+			return false, err
+		}
+	}
+
+	h, err := hash.New(src)
+	if err != nil {
+		return false, err
+	}
+	output, err := os.Stat(dest)
+	if err != nil {
+		return false, err
+	}
+	return true, setPublicFile(c, key, publicFile{
+		Size:          info.Size(),
+		ModTime:       info.ModTime().UnixNano(),
+		Mode:          uint32(info.Mode().Perm()),
+		Hash:          h,
+		OutputSize:    output.Size(),
+		OutputModTime: output.ModTime().UnixNano(),
+		Method:        method,
+	})
+}
+
+// recordFingerprints records in the cache the names the files copied from
+// the public directory were fingerprinted to, so that the next build finds
+// their copies.
+func recordFingerprints(outputDir string, manifest assets.Manifest) error {
+	if len(manifest) == 0 {
+		return nil
+	}
+	c, err := cache.New(filepath.Join(outputDir, ".cache"))
+	if err != nil {
+		return fmt.Errorf("error creating cache: %w", err)
+	}
+	for name, asset := range manifest {
+		key := publicCacheKey + "public/" + name
+		var file publicFile
+		if err := json.Unmarshal([]byte(c.Get(key)), &file); err != nil {
+			continue
+		}
+		file.Output = ""
+		if asset.File != name {
+			file.Output = asset.File
+		}
+		if err := setPublicFile(c, key, file); err != nil {
+			return err
+		}
+	}
+	if err := c.Save(); err != nil {
+		return fmt.Errorf("error saving cache: %w", err)
+	}
+	return nil
+}
+
+// setPublicFile records the state of a copied file in the cache.
+func setPublicFile(c *cache.Cache, key string, file publicFile) error {
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	c.Set(key, string(data))
+	return nil
+}
+
+// contentOutput is a file written to the output directory from the content
+// directory: a page, or a file written next to the pages.
+type contentOutput struct {
+	// source is the path of the page or of the file.
+	source string
+	// url is the URL the output is written to.
+	url string
+}
+
+// contentOutputs returns the outputs of the published pages and of the other
+// files of the content directory, which are written where the content
+// directory puts them.
+func contentOutputs(published []*pages.Page, languages *i18n.Languages) ([]contentOutput, error) {
+	outputs := make([]contentOutput, 0, len(published))
+	for _, page := range published {
+		outputs = append(outputs, contentOutput{source: page.Path, url: page.URL})
+	}
+	if _, err := os.Stat("content"); os.IsNotExist(err) {
+		return outputs, nil
+	}
+	err := filepath.Walk("content", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name()[0] == '_' {
+			return nil
+		}
+		// Pages are listed above, once published
+		if ext := filepath.Ext(path); ext == ".md" || ext == ".html" {
+			return nil
+		}
+		outputs = append(outputs, contentOutput{source: path, url: "/" + filepath.ToSlash(languages.OutputPath(path))})
+		return nil
+	})
+	return outputs, err
+}
+
+// checkCollisions returns an error if a page or another file of the content
+// directory would overwrite a file copied from the public directory.
+func checkCollisions(outputs []contentOutput) error {
+	for _, output := range outputs {
+		public := filepath.Join("public", filepath.FromSlash(output.url))
+		if info, err := os.Stat(public); err == nil && !info.IsDir() {
+			return fmt.Errorf("%s would overwrite %s, as both are written to %s", output.source, public, output.url)
+		}
+	}
+	return nil
+}
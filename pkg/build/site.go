@@ -0,0 +1,142 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Bitlatte/evoke/pkg/logger"
+	"github.com/Bitlatte/evoke/pkg/pages"
+	"github.com/Bitlatte/evoke/proto"
+)
+
+// pluginSite is the site being built, as served to plugins. The
+// configuration is set once it's loaded and the pages once they are indexed,
+// so plugins see them from the content hooks on.
+type pluginSite struct {
+	mu          sync.RWMutex
+	config      []byte
+	pages       []*proto.Page
+	byPath      map[string]*proto.Page
+	diagnostics []*proto.Diagnostic
+}
+
+// newPluginSite creates an empty site.
+func newPluginSite() *pluginSite {
+	return &pluginSite{byPath: make(map[string]*proto.Page)}
+}
+
+// setConfig sets the configuration of the site.
+func (s *pluginSite) setConfig(loadedConfig map[string]interface{}) error {
+	config, err := json.Marshal(loadedConfig)
+	if err != nil {
+		return fmt.Errorf("error encoding config: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = config
+	return nil
+}
+
+// setPages sets the published pages of the site.
+func (s *pluginSite) setPages(published []*pages.Page) error {
+	result := make([]*proto.Page, 0, len(published))
+	byPath := make(map[string]*proto.Page, len(published))
+	for _, page := range published {
+		frontMatter, err := json.Marshal(page.Params)
+		if err != nil {
+			return fmt.Errorf("error encoding front matter of page %s: %w", page.Path, err)
+		}
+		p := &proto.Page{
+			Path:            filepath.ToSlash(page.Path),
+			Url:             page.URL,
+			Title:           page.Title(),
+			FrontMatterJson: string(frontMatter),
+			Language:        page.Language,
+		}
+		if len(page.Translations) > 0 {
+			p.Translations = make(map[string]string, len(page.Translations))
+			for _, translation := range page.Translations {
+				p.Translations[translation.Language] = translation.URL
+			}
+		}
+		result = append(result, p)
+		// Pages generated from data share the path of their generator
+		if _, ok := byPath[p.Path]; !ok {
+			byPath[p.Path] = p
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages = result
+	s.byPath = byPath
+	return nil
+}
+
+// Page returns the published page generated from the source file at path,
+// which may leave out the content directory.
+func (s *pluginSite) Page(path string) (*proto.Page, error) {
+	path = filepath.ToSlash(filepath.Clean(filepath.FromSlash(path)))
+	if !strings.HasPrefix(path, "content/") {
+		path = "content/" + path
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	page, ok := s.byPath[path]
+	if !ok {
+		return nil, fmt.Errorf("page %s not found", path)
+	}
+	return page, nil
+}
+
+// Pages returns the published pages, newest first.
+func (s *pluginSite) Pages() ([]*proto.Page, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pages, nil
+}
+
+// Config returns the configuration as a JSON object.
+func (s *pluginSite) Config() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.config == nil {
+		return nil, fmt.Errorf("the configuration isn't loaded yet")
+	}
+	return s.config, nil
+}
+
+// AddDiagnostic records a problem reported by a plugin.
+func (s *pluginSite) AddDiagnostic(diagnostic *proto.Diagnostic) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.diagnostics = append(s.diagnostics, diagnostic)
+}
+
+// reportDiagnostics logs the problems reported by plugins and returns an
+// error if any of them is an error.
+func (s *pluginSite) reportDiagnostics() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	errors := 0
+	for _, d := range s.diagnostics {
+		fields := []interface{}{"plugin", d.Plugin}
+		if d.Path != "" {
+			fields = append(fields, "path", d.Path)
+		}
+		if d.Severity == "error" {
+			logger.Logger.Error(d.Message, fields...)
+			errors++
+		} else {
+			logger.Logger.Warn(d.Message, fields...)
+		}
+	}
+	if errors > 0 {
+		return fmt.Errorf("plugins reported %d errors", errors)
+	}
+	return nil
+}
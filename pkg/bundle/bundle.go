@@ -0,0 +1,363 @@
+// Package bundle bundles and transpiles the scripts and stylesheets of the
+// assets directory with esbuild.
+package bundle
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Bitlatte/evoke/pkg/config"
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// Dir is the directory holding the entry points of the bundles and the files
+// they import.
+const Dir = "assets"
+
+// ManifestFile is the name of the file, in the output directory, mapping the
+// entry points to their bundles.
+const ManifestFile = "bundles.json"
+
+// targets maps the targets of the configuration to the ones of esbuild.
+var targets = map[string]api.Target{
+	"esnext": api.ESNext,
+	"es2015": api.ES2015,
+	"es2016": api.ES2016,
+	"es2017": api.ES2017,
+	"es2018": api.ES2018,
+	"es2019": api.ES2019,
+	"es2020": api.ES2020,
+	"es2021": api.ES2021,
+	"es2022": api.ES2022,
+	"es2023": api.ES2023,
+	"es2024": api.ES2024,
+}
+
+// outputExtensions maps the extensions of the entry points to the extension
+// of their bundle.
+var outputExtensions = map[string]string{
+	".js":  ".js",
+	".mjs": ".js",
+	".jsx": ".js",
+	".ts":  ".js",
+	".mts": ".js",
+	".tsx": ".js",
+	".css": ".css",
+}
+
+// Bundle is a script or stylesheet bundled from an entry point.
+type Bundle struct {
+	// File is the path of the bundle relative to the output directory, e.g.
+	// js/main.Q2ZDKX7A.js.
+	File string `json:"file"`
+	// SRI is the Subresource Integrity hash of the bundle.
+	SRI string `json:"integrity"`
+	// Outputs are the files written for the bundle, relative to the output
+	// directory: the bundle, its source map and the files it imports, such
+	// as fonts.
+	Outputs []string `json:"outputs"`
+}
+
+// URL returns the URL of the bundle.
+func (b Bundle) URL() string {
+	return "/" + b.File
+}
+
+// String returns the URL of the bundle, so that templates can print it.
+func (b Bundle) String() string {
+	return b.URL()
+}
+
+// Integrity returns the attributes checking the integrity of the bundle.
+func (b Bundle) Integrity() template.HTMLAttr {
+	return template.HTMLAttr(fmt.Sprintf(`integrity="%s" crossorigin="anonymous"`, b.SRI))
+}
+
+// Manifest maps the entry points to their bundles.
+type Manifest map[string]Bundle
+
+// ReadManifest reads the manifest at path. A missing manifest is empty.
+func ReadManifest(path string) (Manifest, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Manifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading bundle manifest: %w", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("error parsing bundle manifest %s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// Write writes the manifest to path.
+func (m Manifest) Write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding bundle manifest: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing bundle manifest: %w", err)
+	}
+	return nil
+}
+
+// Hash returns a hash of the manifest, which changes whenever a bundle does.
+func (m Manifest) Hash() string {
+	entries := make([]string, 0, len(m))
+	for entry := range m {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	h := sha256.New()
+	for _, entry := range entries {
+		fmt.Fprintf(h, "%s %s %s\n", entry, m[entry].File, m[entry].SRI)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Options are the options bundles are built with.
+type Options struct {
+	// Target is the version of JavaScript the scripts are transpiled to.
+	Target api.Target
+	// SourceMaps writes a source map next to each bundle.
+	SourceMaps bool
+	// MinifyJS and MinifyCSS minify the scripts and the stylesheets.
+	MinifyJS  bool
+	MinifyCSS bool
+}
+
+// NewOptions returns the options configured by the bundle section of the
+// configuration.
+func NewOptions(cfg config.Bundle) (Options, error) {
+	opts := Options{
+		Target:     api.ESNext,
+		SourceMaps: cfg.SourceMaps == nil || *cfg.SourceMaps,
+	}
+	if cfg.Target != "" {
+		target, ok := targets[strings.ToLower(cfg.Target)]
+		if !ok {
+			return Options{}, fmt.Errorf("unknown bundle target %s", cfg.Target)
+		}
+		opts.Target = target
+	}
+	return opts, nil
+}
+
+// Bundler builds the bundles of a build into the output directory. Bundles
+// are built once per build, when they are first asked for.
+type Bundler struct {
+	outputDir string
+	opts      Options
+
+	mu       sync.Mutex
+	bundles  Manifest
+	previous Manifest
+}
+
+// New returns a Bundler writing to the output directory. The bundles of the
+// previous build are read from its manifest, so that their outdated files
+// can be removed once the build is done.
+func New(outputDir string, opts Options) (*Bundler, error) {
+	previous, err := ReadManifest(filepath.Join(outputDir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	return &Bundler{
+		outputDir: outputDir,
+		opts:      opts,
+		bundles:   make(Manifest),
+		previous:  previous,
+	}, nil
+}
+
+// Previous returns the entry points bundled by the previous build that
+// still exist.
+func (b *Bundler) Previous() []string {
+	var entries []string
+	for entry := range b.previous {
+		if _, err := os.Stat(filepath.Join(Dir, filepath.FromSlash(entry))); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// Bundle returns the bundle of the entry point, a path relative to the
+// assets directory, building it if it wasn't yet.
+func (b *Bundler) Bundle(entry string) (Bundle, error) {
+	entry = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(entry)), "/")
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if bundle, ok := b.bundles[entry]; ok {
+		return bundle, nil
+	}
+	bundle, err := b.build(entry)
+	if err != nil {
+		return Bundle{}, err
+	}
+	b.bundles[entry] = bundle
+	return bundle, nil
+}
+
+// build bundles the entry point and writes the bundle to the output
+// directory.
+func (b *Bundler) build(entry string) (Bundle, error) {
+	ext := strings.ToLower(filepath.Ext(entry))
+	outputExt, ok := outputExtensions[ext]
+	if !ok {
+		return Bundle{}, fmt.Errorf("can't bundle %s, entry points must be scripts or stylesheets", entry)
+	}
+	source := filepath.Join(Dir, filepath.FromSlash(entry))
+	if _, err := os.Stat(source); err != nil {
+		return Bundle{}, fmt.Errorf("can't bundle %s: %w", entry, err)
+	}
+	outputDir, err := filepath.Abs(b.outputDir)
+	if err != nil {
+		return Bundle{}, err
+	}
+
+	sourcemap := api.SourceMapNone
+	if b.opts.SourceMaps {
+		sourcemap = api.SourceMapLinked
+	}
+	minify := b.opts.MinifyJS
+	if outputExt == ".css" {
+		minify = b.opts.MinifyCSS
+	}
+	result := api.Build(api.BuildOptions{
+		EntryPoints:       []string{source},
+		Outbase:           Dir,
+		Outdir:            outputDir,
+		EntryNames:        "[dir]/[name].[hash]",
+		AssetNames:        "[dir]/[name].[hash]",
+		Bundle:            true,
+		Write:             false,
+		Sourcemap:         sourcemap,
+		Target:            b.opts.Target,
+		MinifyWhitespace:  minify,
+		MinifyIdentifiers: minify,
+		MinifySyntax:      minify,
+		Loader: map[string]api.Loader{
+			".png":   api.LoaderFile,
+			".jpg":   api.LoaderFile,
+			".jpeg":  api.LoaderFile,
+			".gif":   api.LoaderFile,
+			".svg":   api.LoaderFile,
+			".webp":  api.LoaderFile,
+			".woff":  api.LoaderFile,
+			".woff2": api.LoaderFile,
+			".ttf":   api.LoaderFile,
+			".eot":   api.LoaderFile,
+		},
+		LogLevel: api.LogLevelSilent,
+	})
+	if len(result.Errors) > 0 {
+		return Bundle{}, fmt.Errorf("error bundling %s: %s", entry, formatMessages(result.Errors))
+	}
+
+	var bundle Bundle
+	prefix := strings.TrimSuffix(entry, filepath.Ext(entry)) + "."
+	for _, file := range result.OutputFiles {
+		rel, err := filepath.Rel(outputDir, file.Path)
+		if err != nil {
+			return Bundle{}, err
+		}
+		if err := os.MkdirAll(filepath.Dir(file.Path), 0755); err != nil {
+			return Bundle{}, err
+		}
+		if err := os.WriteFile(file.Path, file.Contents, 0644); err != nil {
+			return Bundle{}, fmt.Errorf("error writing bundle of %s: %w", entry, err)
+		}
+		rel = filepath.ToSlash(rel)
+		bundle.Outputs = append(bundle.Outputs, rel)
+		if bundle.File == "" && strings.HasPrefix(rel, prefix) && filepath.Ext(rel) == outputExt {
+			integrity := sha512.Sum384(file.Contents)
+			bundle.File = rel
+			bundle.SRI = "sha384-" + base64.StdEncoding.EncodeToString(integrity[:])
+		}
+	}
+	if bundle.File == "" {
+		return Bundle{}, fmt.Errorf("error bundling %s: esbuild wrote no %s file", entry, outputExt)
+	}
+	sort.Strings(bundle.Outputs)
+	return bundle, nil
+}
+
+// formatMessages formats the errors reported by esbuild.
+func formatMessages(messages []api.Message) string {
+	var lines []string
+	for _, m := range messages {
+		if m.Location != nil {
+			lines = append(lines, fmt.Sprintf("%s:%d:%d: %s", m.Location.File, m.Location.Line, m.Location.Column, m.Text))
+		} else {
+			lines = append(lines, m.Text)
+		}
+	}
+	return strings.Join(lines, "; ")
+}
+
+// Manifest returns the bundles built so far.
+func (b *Bundler) Manifest() Manifest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	manifest := make(Manifest, len(b.bundles))
+	for entry, bundle := range b.bundles {
+		manifest[entry] = bundle
+	}
+	return manifest
+}
+
+// Finish writes the manifest of the bundles built by the build and removes
+// the files of the previous build that no bundle needs anymore.
+func (b *Bundler) Finish() error {
+	manifest := b.Manifest()
+	current := make(map[string]bool)
+	for _, bundle := range manifest {
+		for _, output := range bundle.Outputs {
+			current[output] = true
+		}
+	}
+	for _, bundle := range b.previous {
+		for _, output := range bundle.Outputs {
+			if current[output] {
+				continue
+			}
+			if err := os.Remove(filepath.Join(b.outputDir, filepath.FromSlash(output))); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("error removing stale bundle %s: %w", output, err)
+			}
+		}
+	}
+
+	manifestPath := filepath.Join(b.outputDir, ManifestFile)
+	if len(manifest) == 0 {
+		if err := os.Remove(manifestPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing bundle manifest: %w", err)
+		}
+		return nil
+	}
+	return manifest.Write(manifestPath)
+}
+
+// Funcs returns the template functions building bundles: bundle returns the
+// bundle of an entry point, which prints as its URL.
+func (b *Bundler) Funcs() template.FuncMap {
+	return template.FuncMap{
+		"bundle": b.Bundle,
+	}
+}
@@ -0,0 +1,129 @@
+package bundle_test
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitlatte/evoke/pkg/bundle"
+	"github.com/Bitlatte/evoke/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chdir changes to a temporary directory for the duration of the test.
+func chdir(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(tmpDir))
+	t.Cleanup(func() { os.Chdir(originalWd) })
+}
+
+func TestBundler_Bundle(t *testing.T) {
+	chdir(t)
+	os.MkdirAll("assets/js", 0755)
+	os.MkdirAll("assets/css", 0755)
+	os.WriteFile("assets/js/main.ts", []byte("import { greet } from \"./greet\";\nconsole.log(greet(\"world\"));\n"), 0644)
+	os.WriteFile("assets/js/greet.ts", []byte("export function greet(name: string): string {\n  return `Hello ${name}`;\n}\n"), 0644)
+	os.WriteFile("assets/css/main.css", []byte("@import \"./base.css\";\nh1 { color: red; }\n"), 0644)
+	os.WriteFile("assets/css/base.css", []byte("body { margin: 0; }\n"), 0644)
+
+	opts, err := bundle.NewOptions(config.Bundle{})
+	require.NoError(t, err)
+	b, err := bundle.New("dist", opts)
+	require.NoError(t, err)
+
+	js, err := b.Bundle("js/main.ts")
+	require.NoError(t, err)
+	assert.Regexp(t, `^js/main\.[A-Z0-9]{8}\.js$`, js.File)
+	assert.Equal(t, "/"+js.File, js.String())
+	assert.Equal(t, []string{js.File, js.File + ".map"}, js.Outputs)
+	content, err := os.ReadFile(filepath.Join("dist", js.File))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "function greet(name)")
+	assert.NotContains(t, string(content), "name: string")
+	sum := sha512.Sum384(content)
+	assert.Equal(t, "sha384-"+base64.StdEncoding.EncodeToString(sum[:]), js.SRI)
+
+	css, err := b.Bundle("/css/main.css")
+	require.NoError(t, err)
+	assert.Regexp(t, `^css/main\.[A-Z0-9]{8}\.css$`, css.File)
+	content, err = os.ReadFile(filepath.Join("dist", css.File))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "margin: 0")
+	assert.Contains(t, string(content), "color: red")
+
+	// Bundles are built once per build
+	again, err := b.Bundle("js/main.ts")
+	require.NoError(t, err)
+	assert.Equal(t, js, again)
+	assert.Len(t, b.Manifest(), 2)
+}
+
+func TestBundler_Errors(t *testing.T) {
+	chdir(t)
+	os.MkdirAll("assets/js", 0755)
+	os.WriteFile("assets/js/main.ts", []byte("import \"./missing\";\n"), 0644)
+	os.WriteFile("assets/js/data.txt", []byte("text"), 0644)
+
+	opts, err := bundle.NewOptions(config.Bundle{})
+	require.NoError(t, err)
+	b, err := bundle.New("dist", opts)
+	require.NoError(t, err)
+
+	_, err = b.Bundle("js/main.ts")
+	assert.ErrorContains(t, err, "error bundling js/main.ts")
+	assert.ErrorContains(t, err, "./missing")
+	_, err = b.Bundle("js/other.ts")
+	assert.ErrorContains(t, err, "can't bundle js/other.ts")
+	_, err = b.Bundle("js/data.txt")
+	assert.ErrorContains(t, err, "entry points must be scripts or stylesheets")
+
+	_, err = bundle.NewOptions(config.Bundle{Target: "es3"})
+	assert.ErrorContains(t, err, "unknown bundle target es3")
+}
+
+func TestBundler_Finish(t *testing.T) {
+	chdir(t)
+	os.MkdirAll("assets/js", 0755)
+	os.WriteFile("assets/js/main.js", []byte("console.log(1);\n"), 0644)
+
+	off := false
+	opts, err := bundle.NewOptions(config.Bundle{SourceMaps: &off})
+	require.NoError(t, err)
+	b, err := bundle.New("dist", opts)
+	require.NoError(t, err)
+	first, err := b.Bundle("js/main.js")
+	require.NoError(t, err)
+	assert.Equal(t, []string{first.File}, first.Outputs)
+	require.NoError(t, b.Finish())
+
+	manifest, err := bundle.ReadManifest(filepath.Join("dist", bundle.ManifestFile))
+	require.NoError(t, err)
+	assert.Equal(t, bundle.Manifest{"js/main.js": first}, manifest)
+
+	// The next build knows the bundles of the previous one, and removes their
+	// outdated files
+	os.WriteFile("assets/js/main.js", []byte("console.log(2);\n"), 0644)
+	b, err = bundle.New("dist", opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"js/main.js"}, b.Previous())
+	second, err := b.Bundle("js/main.js")
+	require.NoError(t, err)
+	assert.NotEqual(t, first.File, second.File)
+	require.NoError(t, b.Finish())
+	assert.NoFileExists(t, filepath.Join("dist", first.File))
+	assert.FileExists(t, filepath.Join("dist", second.File))
+
+	// The manifest is removed along with the last bundle
+	os.Remove("assets/js/main.js")
+	b, err = bundle.New("dist", opts)
+	require.NoError(t, err)
+	assert.Empty(t, b.Previous())
+	require.NoError(t, b.Finish())
+	assert.NoFileExists(t, filepath.Join("dist", second.File))
+	assert.NoFileExists(t, filepath.Join("dist", bundle.ManifestFile))
+}
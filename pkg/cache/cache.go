@@ -4,6 +4,8 @@ import (
 	"encoding/gob"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 )
 
@@ -92,3 +94,24 @@ func (c *Cache) Set(path, hash string) {
 	defer c.mu.Unlock()
 	c.Store[path] = hash
 }
+
+// Delete removes the entry for the given path
+func (c *Cache) Delete(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.Store, path)
+}
+
+// Keys returns the paths with the given prefix
+func (c *Cache) Keys(prefix string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var keys []string
+	for key := range c.Store {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
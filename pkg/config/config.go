@@ -3,10 +3,165 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// Markdown holds the settings for the markdown pipeline.
+type Markdown struct {
+	// Anchors controls whether a self-link anchor is appended to each heading.
+	Anchors bool `yaml:"anchors"`
+	// TOC controls which headings are collected into the table of contents.
+	TOC TOC `yaml:"toc"`
+}
+
+// TOC holds the settings for the generated table of contents.
+type TOC struct {
+	// StartLevel is the first heading level included in the table of contents.
+	StartLevel int `yaml:"startLevel"`
+	// EndLevel is the last heading level included in the table of contents.
+	EndLevel int `yaml:"endLevel"`
+}
+
+// Assets holds the settings for the files copied from the public directory.
+type Assets struct {
+	// Fingerprint lists globs of files, relative to the public directory,
+	// whose names get a hash of their content, e.g. css/**/*.css.
+	Fingerprint []string `yaml:"fingerprint"`
+	// Link is how files are copied: copy, the default, hardlink to hard link
+	// them or reflink to clone them on file systems supporting it.
+	Link string `yaml:"link"`
+}
+
+// Minify holds the settings for the minification of the output.
+type Minify struct {
+	// Enabled turns minification on, like the --minify flag does.
+	Enabled bool `yaml:"enabled"`
+	// HTML, CSS, JS, SVG and JSON turn off the minification of a type of
+	// file when set to false.
+	HTML *bool `yaml:"html"`
+	CSS  *bool `yaml:"css"`
+	JS   *bool `yaml:"js"`
+	SVG  *bool `yaml:"svg"`
+	JSON *bool `yaml:"json"`
+}
+
+// Bundle holds the settings for the scripts and stylesheets bundled from the
+// assets directory.
+type Bundle struct {
+	// Entries lists the entry points, relative to the assets directory, that
+	// are bundled on every build, e.g. js/main.ts.
+	Entries []string `yaml:"entries"`
+	// Target is the version of JavaScript the scripts are transpiled to, e.g.
+	// es2018. Defaults to esnext.
+	Target string `yaml:"target"`
+	// SourceMaps turns off the source maps of the bundles when set to false.
+	SourceMaps *bool `yaml:"sourcemaps"`
+}
+
+// Images holds the settings for the processing of images.
+type Images struct {
+	// Widths are the widths of the images in a srcset, e.g. 480, 960 and
+	// 1440.
+	Widths []int `yaml:"widths"`
+	// Quality is the quality of the JPEG images, from 1 to 100.
+	Quality int `yaml:"quality"`
+	// Markdown turns off the srcset of the images of markdown pages when set
+	// to false.
+	Markdown *bool `yaml:"markdown"`
+}
+
+// Search holds the settings for the search index.
+type Search struct {
+	// Enabled writes the search index of the site to search.json.
+	Enabled bool `yaml:"enabled"`
+	// ShardSize is the number of pages above which the index is split into
+	// shards of that many pages. Defaults to 1000.
+	ShardSize int `yaml:"shardSize"`
+}
+
+// Sitemap holds the settings for the sitemap.
+type Sitemap struct {
+	// Enabled writes the sitemap of the site to sitemap.xml. Multilingual
+	// sites get a sitemap per language, listed by sitemap.xml. It requires
+	// the baseURL of the site.
+	Enabled bool `yaml:"enabled"`
+}
+
+// Feeds holds the settings for the RSS and Atom feeds.
+type Feeds struct {
+	// Enabled writes the RSS and Atom feeds of the dated pages of the site
+	// to feed.xml and atom.xml. Multilingual sites get feeds per language,
+	// under the home of the language. It requires the baseURL of the site.
+	Enabled bool `yaml:"enabled"`
+	// Title is the title of the feeds. Defaults to the siteName of the
+	// configuration.
+	Title string `yaml:"title"`
+	// Limit is the number of pages in a feed, the newest first. Defaults to
+	// 20.
+	Limit int `yaml:"limit"`
+}
+
+// Language holds the settings of a language of a multilingual site, listed
+// in the languages section. The first language is the default one.
+type Language struct {
+	// Code is the code of the language, e.g. de. Pages in other languages
+	// than the default one are published under it, e.g. /de/guide.html.
+	Code string `yaml:"code"`
+	// Name is the name of the language, e.g. Deutsch.
+	Name string `yaml:"name"`
+	// Dir is the directory, relative to the content directory, holding the
+	// pages in the language, e.g. de. Pages elsewhere are in the language
+	// their file name ends with, e.g. guide.de.md, or in the default one.
+	Dir string `yaml:"dir"`
+}
+
+// Plugin holds the settings of a plugin listed in the plugins section.
+type Plugin struct {
+	// Name is the file name of the plugin executable in the plugins
+	// directory, without the extension.
+	Name string `yaml:"name"`
+	// Path is the path of the plugin executable. It defaults to the
+	// executable named after the plugin in the plugins directory.
+	Path string `yaml:"path"`
+	// Enabled controls whether the plugin is loaded. Plugins are enabled
+	// unless it is set to false.
+	Enabled *bool `yaml:"enabled"`
+	// Settings are passed to the plugin's Configure hook.
+	Settings map[string]interface{} `yaml:"settings"`
+	// Sandbox restricts what the plugin can access.
+	Sandbox Sandbox `yaml:"sandbox"`
+}
+
+// Sandbox holds the restrictions applied to a plugin.
+type Sandbox struct {
+	// Env lists the environment variables passed to the plugin, besides a
+	// few harmless ones like PATH. The rest of the environment is hidden.
+	Env []string `yaml:"env"`
+	// WorkDir is the working directory of the plugin. It defaults to a
+	// temporary directory of its own, so "." must be set for the plugin to
+	// see the project directory.
+	WorkDir string `yaml:"workdir"`
+	// Writable lets WebAssembly plugins write to their working directory,
+	// which they can only read by default.
+	Writable bool `yaml:"writable"`
+	// Memory is the memory limit of the plugin in megabytes. Zero means no
+	// limit.
+	Memory int `yaml:"memory"`
+	// CPU is the limit on the CPU time of the plugin process in seconds.
+	// Zero means no limit. Only enforced on Linux.
+	CPU int `yaml:"cpu"`
+	// Timeout is the longest a single call to the plugin may take. It
+	// defaults to five minutes.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// IsEnabled reports whether the plugin is enabled.
+func (p Plugin) IsEnabled() bool {
+	return p.Enabled == nil || *p.Enabled
+}
+
 // LoadConfig loads the evoke.yaml file and returns it as a map.
 func LoadConfig() (map[string]interface{}, error) {
 	configFile, err := os.ReadFile("evoke.yaml")
@@ -26,3 +181,18 @@ func LoadConfig() (map[string]interface{}, error) {
 
 	return config, nil
 }
+
+// Decode decodes the value stored under key in the configuration into out.
+// Missing keys leave out untouched, so callers can pre-populate defaults.
+func Decode(config map[string]interface{}, key string, out interface{}) error {
+	value, ok := config[key]
+	if !ok || value == nil {
+		return nil
+	}
+
+	raw, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(raw, out)
+}
@@ -27,3 +27,25 @@ description: "A site generated by Evoke"
 	// Clean up
 	os.Remove("evoke.yaml")
 }
+
+func TestDecode_Plugins(t *testing.T) {
+	// Arrange
+	loadedConfig := map[string]interface{}{
+		"plugins": []interface{}{
+			map[string]interface{}{"name": "search", "settings": map[string]interface{}{"index": "all"}},
+			map[string]interface{}{"name": "legacy", "enabled": false},
+		},
+	}
+
+	// Act
+	var plugins []config.Plugin
+	err := config.Decode(loadedConfig, "plugins", &plugins)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, plugins, 2)
+	assert.Equal(t, "search", plugins[0].Name)
+	assert.Equal(t, "all", plugins[0].Settings["index"])
+	assert.True(t, plugins[0].IsEnabled())
+	assert.False(t, plugins[1].IsEnabled())
+}
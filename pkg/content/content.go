@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"sync"
 
+	"github.com/Bitlatte/evoke/pkg/i18n"
+	"github.com/Bitlatte/evoke/pkg/minify"
 	"github.com/Bitlatte/evoke/pkg/partials"
 	"github.com/Bitlatte/evoke/pkg/pipelines"
 	"github.com/Bitlatte/evoke/pkg/plugins"
@@ -29,8 +31,18 @@ type Content struct {
 	TemplateCache sync.Map
 	// Pipelines are the content pipelines that are currently loaded.
 	Pipelines []pipelines.Pipeline
+	// Extensions maps the file extensions handled by plugin pipelines to
+	// their pipeline.
+	Extensions map[string]pipelines.Pipeline
 	// OutputDir is the directory where the site will be built.
-	OutputDir  string
+	OutputDir string
+	// Minifier minifies the files written to the output directory. Nil
+	// leaves them unchanged.
+	Minifier *minify.Minifier
+	// Languages are the languages of a multilingual site, which decide where
+	// pages are written. Nil writes them where the content directory puts
+	// them.
+	Languages  *i18n.Languages
 	bufferPool sync.Pool
 }
 
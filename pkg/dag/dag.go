@@ -7,12 +7,18 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/Bitlatte/evoke/pkg/data"
+	"github.com/Bitlatte/evoke/pkg/generate"
+	"github.com/Bitlatte/evoke/pkg/shortcodes"
 )
 
 // Node represents a node in the dependency graph
 type Node struct {
 	Path         string
 	Dependencies []*Node
+	// Dependents are the nodes that depend on this node.
+	Dependents []*Node
 }
 
 // Graph represents the dependency graph
@@ -37,32 +43,52 @@ func (g *Graph) AddNode(path string) *Node {
 // AddEdge adds an edge to the graph
 func (g *Graph) AddEdge(from, to *Node) {
 	from.Dependencies = append(from.Dependencies, to)
+	to.Dependents = append(to.Dependents, from)
 }
 
-// BuildGraph builds the dependency graph for the given content directory
-func BuildGraph(contentDir, partialsDir string) (*Graph, error) {
+// BuildGraph builds the dependency graph for the given content directory.
+// Content files depend on the partials and shortcodes they use, on the data
+// files they reference through .Site.Data and on the layouts they are
+// rendered with. Partials and shortcodes depend on the partials and data
+// files they use in turn, so that a change to a data file used by a partial
+// rebuilds the pages using the partial.
+func BuildGraph(contentDir, partialsDir, dataDir string) (*Graph, error) {
 	graph := NewGraph()
 
-	err := filepath.Walk(contentDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			graph.AddNode(path)
-		}
-		return nil
-	})
+	dataFiles, err := listDataFiles(dataDir)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := addFiles(graph, contentDir); err != nil {
+		return nil, err
+	}
+	contentNodes := make(map[*Node]bool, len(graph.Nodes))
 	for _, node := range graph.Nodes {
-		dependencies, err := getDependencies(node.Path, partialsDir)
+		contentNodes[node] = true
+	}
+	if err := addFiles(graph, partialsDir); err != nil {
+		return nil, err
+	}
+	partialNames := listPartials(graph, partialsDir)
+
+	scanned := make([]*Node, 0, len(graph.Nodes))
+	for _, node := range graph.Nodes {
+		scanned = append(scanned, node)
+	}
+	for _, node := range scanned {
+		dependencies, err := getDependencies(node.Path, partialsDir, partialNames, dataFiles)
 		if err != nil {
 			return nil, err
 		}
+		if contentNodes[node] {
+			dependencies = append(dependencies, getLayouts(node.Path, contentDir, graph)...)
+		}
 
 		for _, dependency := range dependencies {
+			if dependency == node.Path {
+				continue
+			}
 			if _, ok := graph.Nodes[dependency]; !ok {
 				graph.AddNode(dependency)
 			}
@@ -73,20 +99,164 @@ func BuildGraph(contentDir, partialsDir string) (*Graph, error) {
 	return graph, nil
 }
 
+// addFiles adds the files in the directory to the graph. A missing
+// directory adds nothing.
+func addFiles(graph *Graph, dir string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			graph.AddNode(path)
+		}
+		return nil
+	})
+}
+
+// listPartials returns the partials of the graph, leaving out the shortcode
+// templates, keyed by the name templates include them by.
+func listPartials(graph *Graph, partialsDir string) map[string]string {
+	shortcodesDir := filepath.Join(partialsDir, "shortcodes") + string(filepath.Separator)
+	names := make(map[string]string)
+	for path := range graph.Nodes {
+		if strings.HasPrefix(path, partialsDir+string(filepath.Separator)) && !strings.HasPrefix(path, shortcodesDir) {
+			names[filepath.Base(path)] = path
+		}
+	}
+	return names
+}
+
+// listDataFiles returns the data files in the data directory, keyed by their
+// data key.
+func listDataFiles(dataDir string) (map[string]string, error) {
+	files := make(map[string]string)
+	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
+		return files, nil
+	}
+	err := filepath.Walk(dataDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !data.IsDataFile(path) {
+			return nil
+		}
+		key, err := data.Key(dataDir, path)
+		if err != nil {
+			return err
+		}
+		files[key] = path
+		return nil
+	})
+	return files, err
+}
+
+// getLayouts returns the layouts the given content file is rendered with.
+func getLayouts(path, contentDir string, graph *Graph) []string {
+	name := filepath.Base(path)
+	if name == "_layout.html" || name == "!layout.html" {
+		return nil
+	}
+
+	var layouts []string
+	dir := filepath.Dir(path)
+	if override := filepath.Join(dir, "!layout.html"); graph.Nodes[override] != nil {
+		return []string{override}
+	}
+	for {
+		if layout := filepath.Join(dir, "_layout.html"); graph.Nodes[layout] != nil {
+			layouts = append(layouts, layout)
+		}
+		if dir == contentDir || dir == "." || dir == "/" {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	return layouts
+}
+
+// getDataDependencies returns the data files referenced by .Site.Data in the
+// given content.
+func getDataDependencies(content []byte, dataFiles map[string]string) []string {
+	if len(dataFiles) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var dependencies []string
+	for _, match := range dataRegexp.FindAllSubmatch(content, -1) {
+		ref := strings.ReplaceAll(strings.TrimPrefix(string(match[1]), "."), ".", "/")
+		for _, path := range matchDataFiles(ref, dataFiles) {
+			if !seen[path] {
+				seen[path] = true
+				dependencies = append(dependencies, path)
+			}
+		}
+	}
+	return dependencies
+}
+
+// matchDataFiles returns the data files holding the data under the slash
+// separated key. A nested key matches the file holding it, a directory
+// matches every file within it and an empty key matches all files.
+func matchDataFiles(ref string, dataFiles map[string]string) []string {
+	var matches []string
+	for key, path := range dataFiles {
+		if ref == "" || key == ref || strings.HasPrefix(ref, key+"/") || strings.HasPrefix(key, ref+"/") {
+			matches = append(matches, path)
+		}
+	}
+	return matches
+}
+
+// dataRegexp matches references to .Site.Data and the keys following it.
+var dataRegexp = regexp.MustCompile(`\.Site\.Data((?:\.\w+)*)`)
+
+// partialRegexp matches the partials included with the partial function.
+var partialRegexp = regexp.MustCompile(`{{\s*partial\s+"([^"]+)"\s*}}`)
+
+// templateRegexp matches the templates included with the template action,
+// which are partials when they are named after a file in the partials
+// directory.
+var templateRegexp = regexp.MustCompile(`{{-?\s*template\s+"([^"]+)"`)
+
 // getDependencies returns the dependencies for the given file
-func getDependencies(path, partialsDir string) ([]string, error) {
+func getDependencies(path, partialsDir string, partialNames, dataFiles map[string]string) ([]string, error) {
 	content, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	r := regexp.MustCompile(`{{\s*partial\s+"([^"]+)"\s*}}`)
-	matches := r.FindAllStringSubmatch(string(content), -1)
-
 	var dependencies []string
-	for _, match := range matches {
+	for _, match := range partialRegexp.FindAllStringSubmatch(string(content), -1) {
 		dependencies = append(dependencies, filepath.Join(partialsDir, match[1]))
 	}
+	for _, match := range templateRegexp.FindAllStringSubmatch(string(content), -1) {
+		if partial, ok := partialNames[match[1]]; ok {
+			dependencies = append(dependencies, partial)
+		}
+	}
+
+	// Markdown files depend on the templates of the shortcodes they use
+	if filepath.Ext(path) == ".md" {
+		for _, name := range shortcodes.Names(content) {
+			dependencies = append(dependencies, filepath.Join(partialsDir, "shortcodes", filepath.FromSlash(name)+".html"))
+		}
+	}
+
+	dependencies = append(dependencies, getDataDependencies(content, dataFiles)...)
+
+	// Generators depend on their data source and the layout of their pages
+	if filepath.Base(path) == generate.FileName {
+		g, err := generate.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, matchDataFiles(g.Data, dataFiles)...)
+		dependencies = append(dependencies, g.LayoutPath())
+	}
 
 	return dependencies, nil
 }
@@ -104,6 +274,26 @@ func (g *Graph) GetDependents(node *Node) []*Node {
 	return dependents
 }
 
+// GetAllDependents returns the direct and indirect dependents of the given
+// node, such as the pages rendered with a layout that uses a data file.
+func (g *Graph) GetAllDependents(node *Node) []*Node {
+	seen := map[*Node]bool{node: true}
+	var dependents []*Node
+	queue := []*Node{node}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, d := range n.Dependents {
+			if !seen[d] {
+				seen[d] = true
+				dependents = append(dependents, d)
+				queue = append(queue, d)
+			}
+		}
+	}
+	return dependents
+}
+
 // String returns a string representation of the graph
 func (g *Graph) String() string {
 	var b strings.Builder
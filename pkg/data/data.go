@@ -0,0 +1,148 @@
+// Package data loads the files in the data directory so they can be used
+// from templates as .Site.Data.
+package data
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// decoders are the supported data file formats, by extension.
+var decoders = map[string]func([]byte) (any, error){
+	".yaml": decodeYAML,
+	".yml":  decodeYAML,
+	".json": decodeJSON,
+	".toml": decodeTOML,
+	".csv":  decodeCSV,
+}
+
+// IsDataFile reports whether the file at path is in a supported format.
+func IsDataFile(path string) bool {
+	_, ok := decoders[filepath.Ext(path)]
+	return ok
+}
+
+// Key returns the slash separated key under which the data file at path,
+// relative to dir, is stored, e.g. data/team/members.yaml is team/members.
+func Key(dir, path string) (string, error) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel))), nil
+}
+
+// Load reads every data file in dir into a nested map keyed by path, so that
+// data/team/members.yaml is available as .Site.Data.team.members.
+func Load(dir string) (map[string]any, error) {
+	root := make(map[string]any)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return root, nil
+	}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !IsDataFile(path) {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		value, err := decoders[filepath.Ext(path)](content)
+		if err != nil {
+			return fmt.Errorf("error decoding data file %s: %w", path, err)
+		}
+
+		key, err := Key(dir, path)
+		if err != nil {
+			return err
+		}
+		return set(root, strings.Split(key, "/"), value, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+// set stores value in the nested map under the given key parts. A data file
+// whose top level is a map can share its key with a directory, in which case
+// both are merged.
+func set(m map[string]any, parts []string, value any, path string) error {
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := m[part]
+		if !ok {
+			child = make(map[string]any)
+			m[part] = child
+		}
+		childMap, ok := child.(map[string]any)
+		if !ok {
+			return fmt.Errorf("data file %s conflicts with the data stored under %q", path, part)
+		}
+		m = childMap
+	}
+
+	last := parts[len(parts)-1]
+	existing, ok := m[last]
+	if !ok {
+		m[last] = value
+		return nil
+	}
+	existingMap, ok1 := existing.(map[string]any)
+	valueMap, ok2 := value.(map[string]any)
+	if !ok1 || !ok2 {
+		return fmt.Errorf("data file %s conflicts with the data stored under %q", path, last)
+	}
+	for k, v := range valueMap {
+		if _, ok := existingMap[k]; ok {
+			return fmt.Errorf("data file %s conflicts with the data stored under %q", path, last+"."+k)
+		}
+		existingMap[k] = v
+	}
+	return nil
+}
+
+// decodeYAML decodes a YAML data file.
+func decodeYAML(content []byte) (any, error) {
+	var v any
+	if err := yaml.Unmarshal(content, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// decodeJSON decodes a JSON data file.
+func decodeJSON(content []byte) (any, error) {
+	var v any
+	if err := json.Unmarshal(content, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// decodeTOML decodes a TOML data file.
+func decodeTOML(content []byte) (any, error) {
+	var v map[string]any
+	if _, err := toml.NewDecoder(bytes.NewReader(content)).Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// decodeCSV decodes a CSV data file into its rows.
+func decodeCSV(content []byte) (any, error) {
+	return csv.NewReader(bytes.NewReader(content)).ReadAll()
+}
@@ -0,0 +1,53 @@
+package data_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitlatte/evoke/pkg/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_NestsDataByPath(t *testing.T) {
+	// Arrange
+	dir, err := os.MkdirTemp("", "data-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "team"), 0755)
+	os.WriteFile(filepath.Join(dir, "team", "members.yaml"), []byte("- name: Ada\n- name: Linus\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "products.json"), []byte(`{"count": 2}`), 0644)
+	os.WriteFile(filepath.Join(dir, "menu.toml"), []byte("[main]\nhome = \"/\"\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "matrix.csv"), []byte("a,b\n1,2\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0644)
+
+	// Act
+	d, err := data.Load(dir)
+
+	// Assert
+	assert.NoError(t, err)
+	team := d["team"].(map[string]any)
+	assert.Equal(t, []any{map[string]any{"name": "Ada"}, map[string]any{"name": "Linus"}}, team["members"])
+	assert.Equal(t, map[string]any{"count": float64(2)}, d["products"])
+	assert.Equal(t, map[string]any{"main": map[string]any{"home": "/"}}, d["menu"])
+	assert.Equal(t, [][]string{{"a", "b"}, {"1", "2"}}, d["matrix"])
+	assert.NotContains(t, d, "notes")
+}
+
+func TestLoad_ReportsConflicts(t *testing.T) {
+	// Arrange
+	dir, err := os.MkdirTemp("", "data-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "team"), 0755)
+	os.WriteFile(filepath.Join(dir, "team", "members.yaml"), []byte("[]"), 0644)
+	os.WriteFile(filepath.Join(dir, "team.json"), []byte(`{"members": 1}`), 0644)
+
+	// Act
+	_, err = data.Load(dir)
+
+	// Assert
+	assert.ErrorContains(t, err, "conflicts")
+}
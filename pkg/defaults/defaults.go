@@ -3,7 +3,7 @@ package defaults
 
 // Layout is the default layout.html content.
 var Layout = `<!DOCTYPE html>
-<html>
+<html{{ with .Page.Language }} lang="{{ . }}"{{ end }}>
 <head>
 	<link rel="icon" href="data:image/svg+xml,<svg xmlns=%22http://www.w3.org/2000/svg%22 viewBox=%220 0 100 100%22><text y=%22.9em%22 font-size=%2290%22>✨</text></svg>">
 	<title>{{ .Site.Name }}</title>
@@ -12,3 +12,91 @@ var Layout = `<!DOCTYPE html>
 	{{ .Content }}
 </body>
 </html>`
+
+// SearchPartial is the search widget partial. It searches the search index
+// written by the build, loading it when the search box is first used.
+var SearchPartial = `<div class="search" data-search-ignore>
+	<input type="search" placeholder="Search" aria-label="Search" autocomplete="off">
+	<ul class="search-results" hidden></ul>
+</div>
+<script>
+(() => {
+	const root = document.currentScript.previousElementSibling;
+	const input = root.querySelector("input");
+	const list = root.querySelector("ul");
+	let documents = [];
+	let loading;
+
+	// Load the index, searching the shards of a sharded index as they arrive
+	const load = () => loading ??= fetch("/search.json")
+		.then((response) => response.json())
+		.then((index) => {
+			documents.push(...(index.documents || []));
+			render();
+			for (const url of index.shards || []) {
+				fetch(url)
+					.then((response) => response.json())
+					.then((shard) => { documents.push(...shard); render(); });
+			}
+		});
+
+	const snippet = (text, term) => {
+		const i = text.toLowerCase().indexOf(term);
+		if (i < 0) return text.slice(0, 120);
+		const start = Math.max(0, i - 50);
+		return (start > 0 ? "…" : "") + text.slice(start, i + 70) + "…";
+	};
+
+	const render = () => {
+		const terms = input.value.toLowerCase().split(/\s+/).filter(Boolean);
+		list.replaceChildren();
+		list.hidden = terms.length === 0;
+		if (terms.length === 0) return;
+
+		// On multilingual sites, only the pages in the language of the
+		// current page are searched
+		const lang = document.documentElement.lang;
+		const results = [];
+		for (const doc of documents) {
+			if (lang && doc.lang && doc.lang !== lang) continue;
+			const title = doc.title.toLowerCase();
+			const text = doc.text.toLowerCase();
+			const headings = doc.headings || [];
+			let score = 0;
+			let heading;
+			for (const term of terms) {
+				const match = headings.find((h) => h.text.toLowerCase().includes(term));
+				if (title.includes(term)) score += 10;
+				else if (match) score += 5;
+				else if (text.includes(term)) score += 1;
+				else { score = 0; break; }
+				heading ??= match;
+			}
+			if (score > 0) results.push({ doc, score, heading });
+		}
+		results.sort((a, b) => b.score - a.score);
+
+		for (const { doc, heading } of results.slice(0, 10)) {
+			const item = document.createElement("li");
+			const link = document.createElement("a");
+			link.href = heading && heading.id ? doc.url + "#" + heading.id : doc.url;
+			link.textContent = doc.title || doc.url;
+			const excerpt = document.createElement("p");
+			excerpt.textContent = snippet(doc.text, terms[0]);
+			item.append(link, excerpt);
+			list.append(item);
+		}
+		if (results.length === 0) {
+			const item = document.createElement("li");
+			item.textContent = "No results";
+			list.append(item);
+		}
+	};
+
+	input.addEventListener("focus", load, { once: true });
+	input.addEventListener("input", () => { load(); render(); });
+	input.addEventListener("keydown", (e) => {
+		if (e.key === "Escape") { input.value = ""; render(); }
+	});
+})();
+</script>`
@@ -0,0 +1,193 @@
+// Package feeds writes the RSS and Atom feeds of the generated site, which
+// list its newest pages for feed readers.
+package feeds
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Bitlatte/evoke/pkg/pages"
+)
+
+// RSSFile is the name of the RSS feed in the home of the site, or of each
+// language of a multilingual site.
+const RSSFile = "feed.xml"
+
+// AtomFile is the name of the Atom feed in the home of the site, or of each
+// language of a multilingual site.
+const AtomFile = "atom.xml"
+
+// DefaultLimit is the number of pages in a feed.
+const DefaultLimit = 20
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+// Feed is a feed of the pages of a site, or of the pages in one of its
+// languages.
+type Feed struct {
+	// Title is the title of the feed.
+	Title string
+	// BaseURL is the URL of the site, e.g. https://example.com, which the
+	// URLs of the feed are made absolute with.
+	BaseURL string
+	// Home is the URL of the home of the feed, relative to the site root,
+	// e.g. / or /de/. The feeds are written there.
+	Home string
+	// Language is the code of the language of the pages on multilingual
+	// sites.
+	Language string
+	// Pages are the pages of the feed, newest first.
+	Pages []*pages.Page
+}
+
+// link is a link of an Atom feed, or of an RSS feed in the Atom namespace.
+type link struct {
+	Rel      string `xml:"rel,attr,omitempty"`
+	Type     string `xml:"type,attr,omitempty"`
+	Hreflang string `xml:"hreflang,attr,omitempty"`
+	Href     string `xml:"href,attr"`
+}
+
+// rss is an RSS 2.0 feed.
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// rssChannel is the channel of an RSS feed.
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Language    string    `xml:"language,omitempty"`
+	Self        link      `xml:"atom:link"`
+	Items       []rssItem `xml:"item"`
+}
+
+// rssItem is a page of an RSS feed.
+type rssItem struct {
+	Title        string `xml:"title"`
+	Link         string `xml:"link"`
+	GUID         string `xml:"guid"`
+	PubDate      string `xml:"pubDate"`
+	Description  string `xml:"description,omitempty"`
+	Translations []link `xml:"atom:link"`
+}
+
+// atomFeed is an Atom feed.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	Lang    string      `xml:"xml:lang,attr,omitempty"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []link      `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// atomEntry is a page of an Atom feed.
+type atomEntry struct {
+	ID      string `xml:"id"`
+	Title   string `xml:"title"`
+	Updated string `xml:"updated"`
+	Links   []link `xml:"link"`
+	Summary string `xml:"summary,omitempty"`
+}
+
+// WriteRSS writes the feed as RSS to the file at path. Pages with
+// translations link to them as hreflang alternates.
+func (f *Feed) WriteRSS(path string) error {
+	feed := rss{
+		Version: "2.0",
+		Atom:    atomNamespace,
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        f.absolute(f.Home),
+			Description: f.Title,
+			Language:    f.Language,
+			Self:        link{Rel: "self", Type: "application/rss+xml", Href: f.absolute(f.Home + RSSFile)},
+		},
+	}
+	for _, page := range f.Pages {
+		u := f.absolute(page.URL)
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:        page.Title(),
+			Link:         u,
+			GUID:         u,
+			PubDate:      page.PublishDate().Format(time.RFC1123Z),
+			Description:  description(page),
+			Translations: f.translations(page),
+		})
+	}
+	return writeXML(path, feed)
+}
+
+// WriteAtom writes the feed as Atom to the file at path. Pages with
+// translations link to them as hreflang alternates.
+func (f *Feed) WriteAtom(path string) error {
+	feed := atomFeed{
+		XMLNS: atomNamespace,
+		Lang:  f.Language,
+		ID:    f.absolute(f.Home),
+		Title: f.Title,
+		Links: []link{
+			{Rel: "self", Type: "application/atom+xml", Href: f.absolute(f.Home + AtomFile)},
+			{Rel: "alternate", Href: f.absolute(f.Home)},
+		},
+	}
+	// The feed is updated along with its newest page
+	if len(f.Pages) > 0 {
+		feed.Updated = f.Pages[0].PublishDate().Format(time.RFC3339)
+	} else {
+		feed.Updated = time.Unix(0, 0).UTC().Format(time.RFC3339)
+	}
+	for _, page := range f.Pages {
+		u := f.absolute(page.URL)
+		entry := atomEntry{
+			ID:      u,
+			Title:   page.Title(),
+			Updated: page.PublishDate().Format(time.RFC3339),
+			Links:   []link{{Rel: "alternate", Hreflang: page.Language, Href: u}},
+			Summary: description(page),
+		}
+		entry.Links = append(entry.Links, f.translations(page)...)
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return writeXML(path, feed)
+}
+
+// translations returns the links to the translations of the page.
+func (f *Feed) translations(page *pages.Page) []link {
+	var links []link
+	for _, translation := range page.Translations {
+		links = append(links, link{Rel: "alternate", Hreflang: translation.Language, Href: f.absolute(translation.URL)})
+	}
+	return links
+}
+
+// absolute returns the URL, relative to the site root, made absolute with
+// the base URL of the feed.
+func (f *Feed) absolute(u string) string {
+	return strings.TrimSuffix(f.BaseURL, "/") + u
+}
+
+// description returns the description of the page set by its front matter.
+func description(page *pages.Page) string {
+	d, _ := page.Params["description"].(string)
+	return d
+}
+
+// writeXML writes v to path as indented XML.
+func writeXML(path string, v any) error {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding feed: %w", err)
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
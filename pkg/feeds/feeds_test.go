@@ -0,0 +1,70 @@
+package feeds_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitlatte/evoke/pkg/feeds"
+	"github.com/Bitlatte/evoke/pkg/pages"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFeed() *feeds.Feed {
+	post := &pages.Page{URL: "/de/post.html", Language: "de", Params: map[string]any{"title": "Beitrag", "date": "2024-03-01", "description": "Neu"}}
+	post.Translations = []*pages.Page{{URL: "/post.html", Language: "en"}}
+	return &feeds.Feed{Title: "Blog", BaseURL: "https://example.com/", Home: "/de/", Language: "de", Pages: []*pages.Page{post}}
+}
+
+func TestFeed_WriteRSS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), feeds.RSSFile)
+	require.NoError(t, newFeed().WriteRSS(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+  <channel>
+    <title>Blog</title>
+    <link>https://example.com/de/</link>
+    <description>Blog</description>
+    <language>de</language>
+    <atom:link rel="self" type="application/rss+xml" href="https://example.com/de/feed.xml"></atom:link>
+    <item>
+      <title>Beitrag</title>
+      <link>https://example.com/de/post.html</link>
+      <guid>https://example.com/de/post.html</guid>
+      <pubDate>Fri, 01 Mar 2024 00:00:00 +0000</pubDate>
+      <description>Neu</description>
+      <atom:link rel="alternate" hreflang="en" href="https://example.com/post.html"></atom:link>
+    </item>
+  </channel>
+</rss>
+`, string(data))
+}
+
+func TestFeed_WriteAtom(t *testing.T) {
+	path := filepath.Join(t.TempDir(), feeds.AtomFile)
+	require.NoError(t, newFeed().WriteAtom(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xml:lang="de">
+  <id>https://example.com/de/</id>
+  <title>Blog</title>
+  <updated>2024-03-01T00:00:00Z</updated>
+  <link rel="self" type="application/atom+xml" href="https://example.com/de/atom.xml"></link>
+  <link rel="alternate" href="https://example.com/de/"></link>
+  <entry>
+    <id>https://example.com/de/post.html</id>
+    <title>Beitrag</title>
+    <updated>2024-03-01T00:00:00Z</updated>
+    <link rel="alternate" hreflang="de" href="https://example.com/de/post.html"></link>
+    <link rel="alternate" hreflang="en" href="https://example.com/post.html"></link>
+    <summary>Neu</summary>
+  </entry>
+</feed>
+`, string(data))
+}
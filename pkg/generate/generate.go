@@ -0,0 +1,212 @@
+// Package generate provides content adapters that generate pages from data
+// files.
+//
+// A _generate.yaml file in a content directory names a data source, a URL
+// pattern and a layout:
+//
+//	data: products
+//	path: "{{ .slug }}"
+//	title: "{{ .name }}"
+//	layout: _product.html
+//
+// One page is generated for every item of the data source. The page is
+// rendered with the named layout, followed by the regular layouts of the
+// directory, and has the item as its front matter.
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Bitlatte/evoke/pkg/pages"
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the files that configure a generator.
+const FileName = "_generate.yaml"
+
+// Generator generates pages from the items of a data source.
+type Generator struct {
+	// Path is the path of the _generate.yaml file.
+	Path string `yaml:"-"`
+	// ContentDir is the content directory the generator was found in, which
+	// the pages must stay inside. It defaults to the directory of the
+	// generator.
+	ContentDir string `yaml:"-"`
+	// Data is the key of the data source, e.g. products for
+	// data/products.json.
+	Data string `yaml:"data"`
+	// URL is the template of the path of each page, relative to the
+	// directory of the generator.
+	URL string `yaml:"path"`
+	// Title is an optional template of the title of each page.
+	Title string `yaml:"title"`
+	// Layout is the layout each page is rendered with, relative to the
+	// directory of the generator.
+	Layout string `yaml:"layout"`
+}
+
+// Load reads the generator configured by the file at path.
+func Load(path string) (*Generator, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Generator{Path: path}
+	if err := yaml.Unmarshal(content, g); err != nil {
+		return nil, fmt.Errorf("error parsing generator %s: %w", path, err)
+	}
+	if g.Data == "" || g.URL == "" || g.Layout == "" {
+		return nil, fmt.Errorf("generator %s must set data, path and layout", path)
+	}
+	g.Data = strings.Trim(strings.ReplaceAll(g.Data, ".", "/"), "/")
+	return g, nil
+}
+
+// Find loads every generator in the content directory.
+func Find(contentDir string) ([]*Generator, error) {
+	var generators []*Generator
+	if _, err := os.Stat(contentDir); os.IsNotExist(err) {
+		return generators, nil
+	}
+
+	err := filepath.Walk(contentDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != FileName {
+			return nil
+		}
+		g, err := Load(path)
+		if err != nil {
+			return err
+		}
+		g.ContentDir = contentDir
+		generators = append(generators, g)
+		return nil
+	})
+	return generators, err
+}
+
+// LayoutPath returns the path of the layout the pages are rendered with.
+func (g *Generator) LayoutPath() string {
+	return filepath.Join(filepath.Dir(g.Path), filepath.FromSlash(g.Layout))
+}
+
+// Pages returns one page for every item of the data source. Lists generate a
+// page per element, maps a page per value in key order.
+func (g *Generator) Pages(siteData map[string]any) ([]*pages.Page, error) {
+	source, err := lookup(siteData, g.Data)
+	if err != nil {
+		return nil, fmt.Errorf("generator %s: %w", g.Path, err)
+	}
+
+	urlTemplate, err := template.New("path").Option("missingkey=error").Parse(g.URL)
+	if err != nil {
+		return nil, fmt.Errorf("generator %s: error parsing path: %w", g.Path, err)
+	}
+	var titleTemplate *template.Template
+	if g.Title != "" {
+		if titleTemplate, err = template.New("title").Parse(g.Title); err != nil {
+			return nil, fmt.Errorf("generator %s: error parsing title: %w", g.Path, err)
+		}
+	}
+
+	contentDir := g.ContentDir
+	if contentDir == "" {
+		contentDir = filepath.Dir(g.Path)
+	}
+
+	var generated []*pages.Page
+	seen := make(map[string]bool)
+	for _, item := range items(source) {
+		params := make(map[string]any, len(item)+1)
+		for k, v := range item {
+			params[k] = v
+		}
+
+		rel, err := execute(urlTemplate, item)
+		if err != nil {
+			return nil, fmt.Errorf("generator %s: error executing path: %w", g.Path, err)
+		}
+		rel = strings.Trim(rel, "/")
+		if rel == "" {
+			return nil, fmt.Errorf("generator %s: empty path for item %v", g.Path, item)
+		}
+		if filepath.Ext(rel) != ".html" {
+			rel += ".html"
+		}
+		path := filepath.Join(filepath.Dir(g.Path), filepath.FromSlash(rel))
+		if inside, err := filepath.Rel(contentDir, path); err != nil || inside == ".." || strings.HasPrefix(inside, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("generator %s: page %s is outside of the content directory", g.Path, path)
+		}
+		if seen[path] {
+			return nil, fmt.Errorf("generator %s: duplicate page %s", g.Path, path)
+		}
+		seen[path] = true
+
+		if titleTemplate != nil {
+			if params["title"], err = execute(titleTemplate, item); err != nil {
+				return nil, fmt.Errorf("generator %s: error executing title: %w", g.Path, err)
+			}
+		}
+
+		generated = append(generated, pages.New(path, params))
+	}
+	return generated, nil
+}
+
+// lookup returns the data stored under the slash separated key.
+func lookup(siteData map[string]any, key string) (any, error) {
+	var current any = siteData
+	for _, part := range strings.Split(key, "/") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("data %q not found", key)
+		}
+		if current, ok = m[part]; !ok {
+			return nil, fmt.Errorf("data %q not found", key)
+		}
+	}
+	return current, nil
+}
+
+// items returns the items of a data source that are maps.
+func items(source any) []map[string]any {
+	var result []map[string]any
+	switch s := source.(type) {
+	case []any:
+		for _, v := range s {
+			if item, ok := v.(map[string]any); ok {
+				result = append(result, item)
+			}
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(s))
+		for k := range s {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if item, ok := s[k].(map[string]any); ok {
+				result = append(result, item)
+			}
+		}
+	}
+	return result
+}
+
+// execute executes the template with the given item.
+func execute(t *template.Template, item map[string]any) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, item); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
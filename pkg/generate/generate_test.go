@@ -0,0 +1,109 @@
+package generate_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitlatte/evoke/pkg/generate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPages_GeneratesOnePagePerItem(t *testing.T) {
+	// Arrange
+	g := &generate.Generator{
+		Path:   filepath.Join("content", "products", generate.FileName),
+		Data:   "shop/products",
+		URL:    "{{ .slug }}",
+		Title:  "{{ .name }}",
+		Layout: "_product.html",
+	}
+	siteData := map[string]any{
+		"shop": map[string]any{
+			"products": []any{
+				map[string]any{"slug": "tea", "name": "Tea"},
+				map[string]any{"slug": "coffee", "name": "Coffee"},
+			},
+		},
+	}
+
+	// Act
+	pages, err := g.Pages(siteData)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, pages, 2)
+	assert.Equal(t, "/products/tea.html", pages[0].URL)
+	assert.Equal(t, "Tea", pages[0].Title())
+	assert.Equal(t, "coffee", pages[1].Params["slug"])
+	assert.Equal(t, filepath.Join("content", "products", "_product.html"), g.LayoutPath())
+}
+
+func TestPages_ReportsErrors(t *testing.T) {
+	siteData := map[string]any{
+		"products": []any{
+			map[string]any{"slug": "tea"},
+			map[string]any{"slug": "tea"},
+		},
+	}
+
+	// Missing data source
+	g := &generate.Generator{Path: generate.FileName, Data: "missing", URL: "{{ .slug }}", Layout: "_p.html"}
+	_, err := g.Pages(siteData)
+	assert.Error(t, err)
+
+	// Missing key in the path
+	g = &generate.Generator{Path: generate.FileName, Data: "products", URL: "{{ .id }}", Layout: "_p.html"}
+	_, err = g.Pages(siteData)
+	assert.Error(t, err)
+
+	// Duplicate pages
+	g = &generate.Generator{Path: generate.FileName, Data: "products", URL: "{{ .slug }}", Layout: "_p.html"}
+	_, err = g.Pages(siteData)
+	assert.Error(t, err)
+}
+
+func TestPages_StaysInsideTheContentDirectory(t *testing.T) {
+	siteData := map[string]any{
+		"products": []any{map[string]any{"slug": "../../x"}},
+	}
+	g := &generate.Generator{
+		Path:       filepath.Join("content", "products", generate.FileName),
+		ContentDir: "content",
+		Data:       "products",
+		URL:        "{{ .slug }}",
+		Layout:     "_p.html",
+	}
+	_, err := g.Pages(siteData)
+	assert.ErrorContains(t, err, "outside of the content directory")
+
+	// Pages may leave the directory of the generator for another one of the
+	// content directory
+	siteData["products"] = []any{map[string]any{"slug": "../x"}}
+	pages, err := g.Pages(siteData)
+	assert.NoError(t, err)
+	assert.Equal(t, "/x.html", pages[0].URL)
+}
+
+func TestLoad_RequiresDataPathAndLayout(t *testing.T) {
+	// Arrange
+	dir, err := os.MkdirTemp("", "generate-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	valid := filepath.Join(dir, "valid", generate.FileName)
+	invalid := filepath.Join(dir, "invalid", generate.FileName)
+	os.MkdirAll(filepath.Dir(valid), 0755)
+	os.MkdirAll(filepath.Dir(invalid), 0755)
+	os.WriteFile(valid, []byte("data: shop.products\npath: \"{{ .slug }}\"\nlayout: _product.html\n"), 0644)
+	os.WriteFile(invalid, []byte("data: products\n"), 0644)
+
+	// Act
+	g, err := generate.Load(valid)
+	_, invalidErr := generate.Load(invalid)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "shop/products", g.Data)
+	assert.Error(t, invalidErr)
+}
@@ -0,0 +1,468 @@
+// Package i18n provides the languages of multilingual sites: the language
+// each page is written in, the URL it's published at and its translations,
+// along with the strings of the i18n directory that templates translate.
+package i18n
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Bitlatte/evoke/pkg/config"
+	"github.com/Bitlatte/evoke/pkg/pages"
+	"github.com/Bitlatte/evoke/pkg/util"
+	"gopkg.in/yaml.v3"
+)
+
+// Dir is the directory holding the strings of each language, e.g.
+// i18n/de.yaml.
+const Dir = "i18n"
+
+// Language is a language of the site.
+type Language struct {
+	// Code is the code of the language, e.g. de.
+	Code string
+	// Name is the name of the language, e.g. Deutsch. It defaults to the
+	// code.
+	Name string
+	// Dir is the directory, relative to the content directory, holding the
+	// pages in the language, if any.
+	Dir string
+	// Default reports whether the language is the default one, whose pages
+	// are published at the root of the site.
+	Default bool
+}
+
+// String returns the code of the language, so that templates can print it.
+func (l *Language) String() string {
+	return l.Code
+}
+
+// URL returns the URL of the home of the language: / for the default
+// language and e.g. /de/ for the others.
+func (l *Language) URL() string {
+	if l.Default {
+		return "/"
+	}
+	return "/" + l.Code + "/"
+}
+
+// Languages are the languages of a multilingual site. A nil *Languages is a
+// site in a single language: pages are published where the content
+// directory puts them and have no translations.
+type Languages struct {
+	list    []*Language
+	byCode  map[string]*Language
+	strings map[string]map[string]string
+
+	// byPath are the published pages by path, once indexed.
+	byPath map[string]*pages.Page
+	// translated lists the pages that have translations, to hash them.
+	translated []string
+
+	mu    sync.Mutex
+	sites map[string]map[string]any
+}
+
+// New returns the languages configured by the languages section of the
+// configuration, along with their strings read from the i18n directory. It
+// returns nil if no languages are configured.
+func New(cfgs []config.Language) (*Languages, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	l := &Languages{
+		byCode:  make(map[string]*Language, len(cfgs)),
+		strings: make(map[string]map[string]string),
+		sites:   make(map[string]map[string]any),
+	}
+	dirs := make(map[string]string)
+	for i, cfg := range cfgs {
+		if cfg.Code == "" || strings.ContainsAny(cfg.Code, `/\.`) {
+			return nil, fmt.Errorf("invalid language code %q", cfg.Code)
+		}
+		if _, ok := l.byCode[cfg.Code]; ok {
+			return nil, fmt.Errorf("language %s is listed twice", cfg.Code)
+		}
+		lang := &Language{Code: cfg.Code, Name: cfg.Name, Default: i == 0}
+		if lang.Name == "" {
+			lang.Name = lang.Code
+		}
+		if cfg.Dir != "" {
+			lang.Dir = filepath.Clean(filepath.FromSlash(cfg.Dir))
+			if other, ok := dirs[lang.Dir]; ok {
+				return nil, fmt.Errorf("languages %s and %s share the directory %s", other, lang.Code, cfg.Dir)
+			}
+			dirs[lang.Dir] = lang.Code
+		}
+		l.list = append(l.list, lang)
+		l.byCode[lang.Code] = lang
+	}
+	if err := l.loadStrings(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// loadStrings reads the strings of each language from the i18n directory.
+func (l *Languages) loadStrings() error {
+	entries, err := os.ReadDir(Dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s directory: %w", Dir, err)
+	}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		path := filepath.Join(Dir, entry.Name())
+		code := strings.TrimSuffix(entry.Name(), ext)
+		if _, ok := l.byCode[code]; !ok {
+			return fmt.Errorf("%s: %s isn't one of the languages of the site", path, code)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var table map[string]string
+		if err := yaml.Unmarshal(data, &table); err != nil {
+			return fmt.Errorf("error parsing %s: %w", path, err)
+		}
+		l.strings[code] = table
+	}
+	return nil
+}
+
+// List returns the languages, the default one first.
+func (l *Languages) List() []*Language {
+	if l == nil {
+		return nil
+	}
+	return l.list
+}
+
+// Language returns the language with the given code.
+func (l *Languages) Language(code string) (*Language, error) {
+	if l == nil {
+		return nil, fmt.Errorf("no languages are configured")
+	}
+	lang, ok := l.byCode[code]
+	if !ok {
+		return nil, fmt.Errorf("unknown language %s", code)
+	}
+	return lang, nil
+}
+
+// Of returns the language of the content file at path, or nil on a site in
+// a single language.
+func (l *Languages) Of(path string) *Language {
+	if l == nil {
+		return nil
+	}
+	lang, _ := l.split(path)
+	return lang
+}
+
+// split returns the language of the content file at path and its path
+// relative to the content directory without the language, e.g. guide.md for
+// both content/de/guide.md and content/guide.de.md.
+func (l *Languages) split(path string) (*Language, string) {
+	rel := strings.TrimPrefix(filepath.Clean(path), "content"+string(filepath.Separator))
+
+	// Pages in the directory of a language
+	for _, lang := range l.list {
+		if lang.Dir != "" && strings.HasPrefix(rel, lang.Dir+string(filepath.Separator)) {
+			rel = rel[len(lang.Dir)+1:]
+			if code, stripped := suffix(rel); code == lang.Code {
+				rel = stripped
+			}
+			return lang, rel
+		}
+	}
+	// Pages whose name ends with the code of a language
+	if code, stripped := suffix(rel); code != "" {
+		if lang, ok := l.byCode[code]; ok {
+			return lang, stripped
+		}
+	}
+	return l.list[0], rel
+}
+
+// suffix returns the language code the file name at path ends with, e.g. de
+// for guide.de.md, along with the path without it.
+func suffix(path string) (string, string) {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	code := filepath.Ext(stem)
+	if code == "" {
+		return "", path
+	}
+	return code[1:], strings.TrimSuffix(stem, code) + ext
+}
+
+// OutputPath returns the path of the output of the content file at path,
+// relative to the output directory. Files in other languages than the
+// default one are written under the code of their language.
+func (l *Languages) OutputPath(path string) string {
+	if l == nil {
+		return util.ToOutputPath(path)
+	}
+	lang, rel := l.split(path)
+	output := util.ToOutputPath(filepath.Join("content", rel))
+	if !lang.Default {
+		output = filepath.Join(lang.Code, output)
+	}
+	return output
+}
+
+// URL returns the URL of the page generated from the content file at path.
+func (l *Languages) URL(path string) string {
+	if l == nil {
+		return pages.URL(path)
+	}
+	if ext := filepath.Ext(path); ext == ".md" {
+		path = strings.TrimSuffix(path, ext) + ".html"
+	}
+	return "/" + filepath.ToSlash(l.OutputPath(path))
+}
+
+// Localize sets the language of the page and publishes it under the code of
+// its language.
+func (l *Languages) Localize(page *pages.Page) {
+	if l == nil {
+		return
+	}
+	page.Language = l.Of(page.Path).Code
+	page.URL = l.URL(page.Path)
+}
+
+// Index links the published pages to their translations, the pages that
+// have the same path once their language is left out. It fails if two
+// pages are published at the same URL.
+func (l *Languages) Index(published []*pages.Page) error {
+	if l == nil {
+		return nil
+	}
+	byURL := make(map[string]*pages.Page, len(published))
+	byKey := make(map[string][]*pages.Page)
+	var keys []string
+	l.byPath = make(map[string]*pages.Page, len(published))
+	for _, page := range published {
+		if other, ok := byURL[page.URL]; ok {
+			return fmt.Errorf("pages %s and %s are both published at %s", other.Path, page.Path, page.URL)
+		}
+		byURL[page.URL] = page
+		if _, ok := l.byPath[page.Path]; !ok {
+			l.byPath[page.Path] = page
+		}
+		_, rel := l.split(page.Path)
+		key := pages.URL(filepath.Join("content", rel))
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], page)
+	}
+
+	order := make(map[string]int, len(l.list))
+	for i, lang := range l.list {
+		order[lang.Code] = i
+	}
+	l.translated = nil
+	sort.Strings(keys)
+	for _, key := range keys {
+		group := byKey[key]
+		sort.SliceStable(group, func(i, j int) bool {
+			return order[group[i].Language] < order[group[j].Language]
+		})
+		for _, page := range group {
+			page.Translations = nil
+			for _, other := range group {
+				if other != page {
+					page.Translations = append(page.Translations, other)
+				}
+			}
+			if len(group) > 1 {
+				l.translated = append(l.translated, page.Language+" "+page.URL+" "+key)
+			}
+		}
+	}
+	return nil
+}
+
+// Params returns the front matter of the page generated from the content
+// file at path as seen by layouts, along with its Language and
+// Translations.
+func (l *Languages) Params(path string, params map[string]any) map[string]any {
+	if l == nil {
+		return params
+	}
+	result := make(map[string]any, len(params)+2)
+	for k, v := range params {
+		result[k] = v
+	}
+	result["Language"] = l.Of(path)
+	if page, ok := l.byPath[path]; ok {
+		result["Translations"] = page.Translations
+	}
+	return result
+}
+
+// Site returns the site as seen by the page generated from the content file
+// at path: its Pages are the pages in the language of the page, AllPages
+// are the pages in every language, Language is the language of the page and
+// Languages lists the languages of the site. Sites are localized once per
+// language, so site must be the same for every page of a build.
+func (l *Languages) Site(site map[string]any, path string) map[string]any {
+	if l == nil {
+		return site
+	}
+	lang := l.Of(path)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if localized, ok := l.sites[lang.Code]; ok {
+		return localized
+	}
+	localized := make(map[string]any, len(site)+3)
+	for k, v := range site {
+		localized[k] = v
+	}
+	all, _ := site["Pages"].([]*pages.Page)
+	var inLanguage []*pages.Page
+	for _, page := range all {
+		if page.Language == lang.Code {
+			inLanguage = append(inLanguage, page)
+		}
+	}
+	localized["Pages"] = inLanguage
+	localized["AllPages"] = all
+	localized["Language"] = lang
+	localized["Languages"] = l.list
+	l.sites[lang.Code] = localized
+	return localized
+}
+
+// Translation returns the path of the translation of the content file at
+// path into the language with the given code, if it exists.
+func (l *Languages) Translation(path, code string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+	target, ok := l.byCode[code]
+	if !ok {
+		return "", false
+	}
+	lang, rel := l.split(path)
+	if lang == target {
+		return path, true
+	}
+	var candidates []string
+	if target.Dir != "" {
+		candidates = append(candidates, filepath.Join("content", target.Dir, rel))
+	}
+	if target.Default {
+		candidates = append(candidates, filepath.Join("content", rel))
+	} else {
+		ext := filepath.Ext(rel)
+		candidates = append(candidates, filepath.Join("content", strings.TrimSuffix(rel, ext)+"."+code+ext))
+	}
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// Hash returns a hash of the languages, their strings and the translations
+// of the indexed pages, which changes whenever pages must be rendered again
+// to reflect them.
+func (l *Languages) Hash() string {
+	if l == nil {
+		return ""
+	}
+	h := sha256.New()
+	for _, lang := range l.list {
+		fmt.Fprintf(h, "language %s %s %s\n", lang.Code, lang.Name, lang.Dir)
+		table := l.strings[lang.Code]
+		keys := make([]string, 0, len(table))
+		for key := range table {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(h, "string %q %q\n", key, table[key])
+		}
+	}
+	for _, t := range l.translated {
+		fmt.Fprintf(h, "translation %s\n", t)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Funcs returns the template functions of multilingual sites: i18n returns
+// the string with the given key in the default language, formatted with the
+// arguments if any, and language returns the language with the given code.
+// Layouts and shortcodes get the version of i18n in the language of their
+// page instead.
+func (l *Languages) Funcs() template.FuncMap {
+	var lang *Language
+	if l != nil {
+		lang = l.list[0]
+	}
+	return template.FuncMap{
+		"i18n":     l.translator(lang),
+		"language": l.Language,
+	}
+}
+
+// PageFuncs returns the template functions of the layouts of the page
+// generated from the content file at path: i18n returns the strings in the
+// language of the page.
+func (l *Languages) PageFuncs(path string) template.FuncMap {
+	if l == nil {
+		return nil
+	}
+	return l.LanguageFuncs(l.Of(path))
+}
+
+// LanguageFuncs returns the template functions of the pages in the language:
+// i18n returns the strings in the language.
+func (l *Languages) LanguageFuncs(lang *Language) template.FuncMap {
+	if l == nil {
+		return nil
+	}
+	return template.FuncMap{
+		"i18n": l.translator(lang),
+	}
+}
+
+// translator returns the i18n template function of the language. Strings
+// missing from the language fall back to the default language.
+func (l *Languages) translator(lang *Language) func(key string, args ...any) (string, error) {
+	return func(key string, args ...any) (string, error) {
+		if l == nil {
+			return "", fmt.Errorf("no languages are configured")
+		}
+		s, ok := l.strings[lang.Code][key]
+		if !ok {
+			s, ok = l.strings[l.list[0].Code][key]
+		}
+		if !ok {
+			return "", fmt.Errorf("no string %s in %s", key, filepath.Join(Dir, lang.Code+".yaml"))
+		}
+		if len(args) > 0 {
+			s = fmt.Sprintf(s, args...)
+		}
+		return s, nil
+	}
+}
@@ -0,0 +1,124 @@
+package i18n_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitlatte/evoke/pkg/config"
+	"github.com/Bitlatte/evoke/pkg/i18n"
+	"github.com/Bitlatte/evoke/pkg/pages"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chdir changes to a temporary directory for the duration of the test.
+func chdir(t *testing.T) {
+	originalWd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(originalWd) })
+}
+
+func TestNew(t *testing.T) {
+	chdir(t)
+
+	languages, err := i18n.New(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, languages)
+
+	_, err = i18n.New([]config.Language{{Code: "en"}, {Code: "en"}})
+	assert.Error(t, err)
+	_, err = i18n.New([]config.Language{{Code: "en"}, {Code: ""}})
+	assert.Error(t, err)
+	_, err = i18n.New([]config.Language{{Code: "en", Dir: "docs"}, {Code: "de", Dir: "docs/"}})
+	assert.Error(t, err)
+
+	// Strings of languages that aren't configured are an error
+	require.NoError(t, os.Mkdir(i18n.Dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(i18n.Dir, "fr.yaml"), []byte("hello: Bonjour\n"), 0644))
+	_, err = i18n.New([]config.Language{{Code: "en"}})
+	assert.Error(t, err)
+}
+
+func TestLanguages_URL(t *testing.T) {
+	chdir(t)
+	languages, err := i18n.New([]config.Language{{Code: "en"}, {Code: "de"}, {Code: "ja", Dir: "ja"}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		path string
+		lang string
+		url  string
+	}{
+		{"content/guide.md", "en", "/guide.html"},
+		{"content/(docs)/guide.de.md", "de", "/de/guide.html"},
+		{"content/blog/post.ja.html", "ja", "/ja/blog/post.html"},
+		{"content/ja/guide.md", "ja", "/ja/guide.html"},
+		{"content/ja/guide.ja.md", "ja", "/ja/guide.html"},
+		{"content/guide.fr.md", "en", "/guide.fr.html"},
+		{"content/v1.2/guide.md", "en", "/v1.2/guide.html"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.lang, languages.Of(filepath.FromSlash(tt.path)).Code, tt.path)
+		assert.Equal(t, tt.url, languages.URL(filepath.FromSlash(tt.path)), tt.path)
+	}
+
+	// Sites in a single language are published where the content directory
+	// puts the pages
+	var monolingual *i18n.Languages
+	assert.Equal(t, "/guide.de.html", monolingual.URL(filepath.FromSlash("content/guide.de.md")))
+}
+
+func TestLanguages_Index(t *testing.T) {
+	chdir(t)
+	languages, err := i18n.New([]config.Language{{Code: "en"}, {Code: "de"}, {Code: "ja", Dir: "ja"}})
+	require.NoError(t, err)
+
+	ja := pages.New(filepath.FromSlash("content/ja/guide.md"), nil)
+	de := pages.New(filepath.FromSlash("content/guide.de.md"), nil)
+	en := pages.New(filepath.FromSlash("content/guide.md"), nil)
+	other := pages.New(filepath.FromSlash("content/about.md"), nil)
+	published := []*pages.Page{ja, de, en, other}
+	for _, page := range published {
+		languages.Localize(page)
+	}
+	require.NoError(t, languages.Index(published))
+
+	assert.Equal(t, []*pages.Page{de, ja}, en.Translations)
+	assert.Equal(t, []*pages.Page{en, ja}, de.Translations)
+	assert.Equal(t, []*pages.Page{en, de}, ja.Translations)
+	assert.Empty(t, other.Translations)
+
+	// Pages published at the same URL are an error
+	duplicate := pages.New(filepath.FromSlash("content/ja/guide.ja.md"), nil)
+	languages.Localize(duplicate)
+	assert.Error(t, languages.Index(append(published, duplicate)))
+}
+
+func TestLanguages_Funcs(t *testing.T) {
+	chdir(t)
+	require.NoError(t, os.Mkdir(i18n.Dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(i18n.Dir, "en.yaml"), []byte("hello: Hello\npages: \"%d pages\"\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(i18n.Dir, "de.yaml"), []byte("hello: Hallo\n"), 0644))
+	languages, err := i18n.New([]config.Language{{Code: "en"}, {Code: "de"}})
+	require.NoError(t, err)
+
+	translate := languages.Funcs()["i18n"].(func(string, ...any) (string, error))
+	s, err := translate("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", s)
+
+	translate = languages.PageFuncs(filepath.FromSlash("content/guide.de.md"))["i18n"].(func(string, ...any) (string, error))
+	s, err = translate("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hallo", s)
+
+	// Missing strings fall back to the default language
+	s, err = translate("pages", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "3 pages", s)
+
+	_, err = translate("missing")
+	assert.Error(t, err)
+}
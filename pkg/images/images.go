@@ -0,0 +1,664 @@
+// Package images resizes and converts the images of the site and builds the
+// srcset of responsive images. Images are decoded and encoded in pure Go,
+// and the processed images are cached between builds.
+package images
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Bitlatte/evoke/pkg/config"
+	"github.com/Bitlatte/evoke/pkg/util"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// CacheDir is the directory, in the project directory, where the processed
+// images are cached between builds. It is kept out of the output directory,
+// so that the cache is neither deployed nor mistaken for part of the site.
+const CacheDir = ".evoke/images"
+
+// indexFile is the file in the cache directory recording the images used by
+// the previous build, along with the hash of their content.
+const indexFile = "index.json"
+
+// Dirs are the directories images are looked up in, in order. Images in the
+// assets directory are only published when a template uses them.
+var Dirs = []string{"assets", "public"}
+
+// DefaultWidths are the widths of the images in a srcset.
+var DefaultWidths = []int{480, 960, 1440}
+
+// DefaultQuality is the quality of JPEG images.
+const DefaultQuality = 85
+
+// extensions maps the extensions of the images that can be processed to
+// their format.
+var extensions = map[string]string{
+	".jpg":  "jpeg",
+	".jpeg": "jpeg",
+	".png":  "png",
+	".gif":  "gif",
+	".webp": "webp",
+}
+
+// encoders maps the formats images can be converted to, as named in specs,
+// to their format.
+var encoders = map[string]string{
+	"jpg":  "jpeg",
+	"jpeg": "jpeg",
+	"png":  "png",
+	"gif":  "gif",
+}
+
+// outputExtensions maps the formats images are encoded to to the extension
+// of their files.
+var outputExtensions = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+	"gif":  ".gif",
+}
+
+// Options are the options images are processed with.
+type Options struct {
+	// Widths are the widths of the images in a srcset.
+	Widths []int
+	// Quality is the quality of JPEG images, from 1 to 100.
+	Quality int
+	// Markdown turns the images of markdown pages into responsive images.
+	Markdown bool
+}
+
+// NewOptions returns the options configured by the images section of the
+// configuration.
+func NewOptions(cfg config.Images) (Options, error) {
+	opts := Options{
+		Widths:   DefaultWidths,
+		Quality:  DefaultQuality,
+		Markdown: cfg.Markdown == nil || *cfg.Markdown,
+	}
+	if len(cfg.Widths) > 0 {
+		opts.Widths = append([]int(nil), cfg.Widths...)
+		sort.Ints(opts.Widths)
+		if opts.Widths[0] <= 0 {
+			return Options{}, fmt.Errorf("invalid image width %d", opts.Widths[0])
+		}
+	}
+	if cfg.Quality != 0 {
+		if cfg.Quality < 1 || cfg.Quality > 100 {
+			return Options{}, fmt.Errorf("invalid image quality %d, it must be between 1 and 100", cfg.Quality)
+		}
+		opts.Quality = cfg.Quality
+	}
+	return opts, nil
+}
+
+// source is an image of the assets or public directory.
+type source struct {
+	// name is the path of the image relative to its directory, e.g.
+	// img/hero.jpg.
+	name string
+	// path is the path of the file.
+	path string
+	// public reports whether the image is in the public directory, and so
+	// is published as is.
+	public bool
+	// hash is the hash of the content of the file.
+	hash string
+	// format is the format of the image, e.g. jpeg.
+	format string
+	// opaque reports whether the image has no transparent pixels, as far as
+	// its color model tells.
+	opaque bool
+	// orientation is the EXIF orientation of the image.
+	orientation int
+	// width and height are the dimensions of the upright image.
+	width, height int
+}
+
+// Processor processes the images of a build. Each image is processed once
+// per build, and its result is cached between builds.
+type Processor struct {
+	outputDir string
+	cacheDir  string
+	opts      Options
+
+	mu       sync.Mutex
+	sources  map[string]*once[*source]
+	images   map[string]*once[*Image]
+	previous map[string]string
+}
+
+// once holds the result of a computation done once.
+type once[T any] struct {
+	once   sync.Once
+	result T
+	err    error
+}
+
+// do computes the result with fn, unless it already was.
+func (o *once[T]) do(fn func() (T, error)) (T, error) {
+	o.once.Do(func() { o.result, o.err = fn() })
+	return o.result, o.err
+}
+
+// New returns a Processor writing to the output directory.
+func New(outputDir string, opts Options) (*Processor, error) {
+	p := &Processor{
+		outputDir: outputDir,
+		cacheDir:  filepath.FromSlash(CacheDir),
+		opts:      opts,
+		sources:   make(map[string]*once[*source]),
+		images:    make(map[string]*once[*Image]),
+		previous:  make(map[string]string),
+	}
+	data, err := os.ReadFile(filepath.Join(p.cacheDir, indexFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error reading image cache: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &p.previous); err != nil {
+			return nil, fmt.Errorf("error parsing image cache: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// Hash returns a hash of the current content of the images used by the
+// previous build, which changes whenever one of them does.
+func (p *Processor) Hash() string {
+	names := make([]string, 0, len(p.previous))
+	for name := range p.previous {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		hash := "missing"
+		if path, _, err := lookup(name); err == nil {
+			if data, err := os.ReadFile(path); err == nil {
+				hash = hashBytes(data)
+			}
+		}
+		fmt.Fprintf(h, "%s %s\n", name, hash)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Finish records the images used by the build, along with the ones of the
+// previous build that still exist, since pages that weren't rendered again
+// still use them.
+func (p *Processor) Finish() error {
+	index := make(map[string]string)
+	for name := range p.previous {
+		if path, _, err := lookup(name); err == nil {
+			if data, err := os.ReadFile(path); err == nil {
+				index[name] = hashBytes(data)
+			}
+		}
+	}
+	p.mu.Lock()
+	for name, o := range p.sources {
+		if o.err == nil && o.result != nil {
+			index[name] = o.result.hash
+		}
+	}
+	p.mu.Unlock()
+
+	if len(index) == 0 {
+		if err := os.Remove(filepath.Join(p.cacheDir, indexFile)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing image cache index: %w", err)
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding image cache index: %w", err)
+	}
+	if err := os.MkdirAll(p.cacheDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(p.cacheDir, indexFile), data, 0644); err != nil {
+		return fmt.Errorf("error writing image cache index: %w", err)
+	}
+	return nil
+}
+
+// Markdown reports whether the images of markdown pages are turned into
+// responsive images.
+func (p *Processor) Markdown() bool {
+	return p.opts.Markdown
+}
+
+// Funcs returns the template functions processing images: image returns the
+// image at a path relative to the assets or public directory.
+func (p *Processor) Funcs() template.FuncMap {
+	return template.FuncMap{
+		"image": p.Image,
+	}
+}
+
+// lookup returns the path of the file of the image with the given name and
+// whether it's in the public directory.
+func lookup(name string) (string, bool, error) {
+	for _, dir := range Dirs {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, dir == "public", nil
+		}
+	}
+	return "", false, fmt.Errorf("image %s not found in the %s directories", name, strings.Join(Dirs, " or "))
+}
+
+// cleanName returns the name of an image as a slash separated path relative
+// to its directory.
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+// Image returns the image with the given name, a path relative to the assets
+// or public directory such as img/hero.jpg.
+func (p *Processor) Image(name string) (*Image, error) {
+	src, err := p.source(cleanName(name))
+	if err != nil {
+		return nil, err
+	}
+	return p.original(src)
+}
+
+// Find returns the image with the given name if it exists and can be
+// processed, or nil.
+func (p *Processor) Find(name string) (*Image, error) {
+	name = cleanName(name)
+	if _, ok := extensions[strings.ToLower(path.Ext(name))]; !ok {
+		return nil, nil
+	}
+	if _, _, err := lookup(name); err != nil {
+		return nil, nil
+	}
+	return p.Image(name)
+}
+
+// source reads the format, dimensions and orientation of the image with the
+// given name.
+func (p *Processor) source(name string) (*source, error) {
+	p.mu.Lock()
+	o, ok := p.sources[name]
+	if !ok {
+		o = &once[*source]{}
+		p.sources[name] = o
+	}
+	p.mu.Unlock()
+
+	return o.do(func() (*source, error) {
+		format, ok := extensions[strings.ToLower(path.Ext(name))]
+		if !ok {
+			return nil, fmt.Errorf("can't process image %s, images must be JPEG, PNG, GIF or WebP files", name)
+		}
+		path, public, err := lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading image %s: %w", name, err)
+		}
+		cfg, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("error decoding image %s: %w", name, err)
+		}
+		if decoded != format {
+			return nil, fmt.Errorf("error decoding image %s: it's a %s image", name, decoded)
+		}
+		src := &source{
+			name:        name,
+			path:        path,
+			public:      public,
+			hash:        hashBytes(data),
+			format:      format,
+			opaque:      cfg.ColorModel == color.YCbCrModel || cfg.ColorModel == color.GrayModel,
+			orientation: 1,
+			width:       cfg.Width,
+			height:      cfg.Height,
+		}
+		if format == "jpeg" {
+			src.orientation = orientation(data)
+			if swapsDimensions(src.orientation) {
+				src.width, src.height = src.height, src.width
+			}
+		}
+		return src, nil
+	})
+}
+
+// original returns the image as it is. Images of the assets directory are
+// copied to the output directory, the ones of the public directory already
+// are.
+func (p *Processor) original(src *source) (*Image, error) {
+	key := "original " + src.name
+	p.mu.Lock()
+	o, ok := p.images[key]
+	if !ok {
+		o = &once[*Image]{}
+		p.images[key] = o
+	}
+	p.mu.Unlock()
+
+	return o.do(func() (*Image, error) {
+		if !src.public {
+			output := filepath.Join(p.outputDir, filepath.FromSlash(src.name))
+			if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+				return nil, err
+			}
+			if err := util.CopyFile(src.path, output); err != nil {
+				return nil, fmt.Errorf("error copying image %s: %w", src.name, err)
+			}
+		}
+		return &Image{
+			p:      p,
+			src:    src,
+			format: outputFormat(src),
+			URL:    "/" + src.name,
+			Width:  src.width,
+			Height: src.height,
+		}, nil
+	})
+}
+
+// outputFormat returns the format images processed from the source are
+// encoded to by default. WebP images can't be encoded, so they are converted
+// to JPEG, or PNG if they may be transparent.
+func outputFormat(src *source) string {
+	if src.format != "webp" {
+		return src.format
+	}
+	if src.opaque {
+		return "jpeg"
+	}
+	return "png"
+}
+
+// Image is an image of the site, as it is or processed.
+type Image struct {
+	p      *Processor
+	src    *source
+	format string
+	// URL is the URL of the image.
+	URL string
+	// Width and Height are the dimensions of the image in pixels.
+	Width  int
+	Height int
+}
+
+// String returns the URL of the image, so that templates can print it.
+func (i *Image) String() string {
+	return i.URL
+}
+
+// Resize returns the image resized as described by the spec, e.g. 800x to
+// make it 800 pixels wide, x600 to make it 600 pixels high, or 800x600 to
+// stretch it to these dimensions. The spec can also name the format to
+// convert the image to, jpg, png or gif, and the quality of a JPEG image,
+// e.g. "800x png" or "800x q70".
+func (i *Image) Resize(spec string) (*Image, error) {
+	s, err := i.parseSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	w, h := s.width, s.height
+	switch {
+	case w == 0 && h == 0:
+		w, h = i.src.width, i.src.height
+	case h == 0:
+		h = scale(i.src.height, w, i.src.width)
+	case w == 0:
+		w = scale(i.src.width, h, i.src.height)
+	}
+	return i.p.process(i.src, w, h, s.format, s.quality)
+}
+
+// Fit returns the image scaled down to fit in the dimensions of the spec,
+// e.g. 800x600, keeping its aspect ratio. Like with Resize, the spec can
+// name a format and a quality.
+func (i *Image) Fit(spec string) (*Image, error) {
+	s, err := i.parseSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	if s.width == 0 || s.height == 0 {
+		return nil, fmt.Errorf("invalid image spec %q, Fit needs a width and a height", spec)
+	}
+	w, h := i.src.width, i.src.height
+	if w > s.width {
+		w, h = s.width, scale(h, s.width, w)
+	}
+	if h > s.height {
+		w, h = scale(w, s.height, h), s.height
+	}
+	return i.p.process(i.src, w, h, s.format, s.quality)
+}
+
+// Srcset returns the srcset of the image, with a version of the image for
+// each of the widths narrower than the image, or the configured widths if
+// none are given. The image itself is included if a width is at least as
+// wide.
+func (i *Image) Srcset(widths ...int) (template.Srcset, error) {
+	variants, err := i.variants(widths)
+	if err != nil {
+		return "", err
+	}
+	candidates := make([]string, len(variants))
+	for j, v := range variants {
+		candidates[j] = fmt.Sprintf("%s %dw", v.URL, v.Width)
+	}
+	return template.Srcset(strings.Join(candidates, ", ")), nil
+}
+
+// variants returns the versions of the image in a srcset, narrowest first.
+func (i *Image) variants(widths []int) ([]*Image, error) {
+	if len(widths) == 0 {
+		widths = i.p.opts.Widths
+	}
+	widths = append([]int(nil), widths...)
+	sort.Ints(widths)
+
+	var result []*Image
+	for _, w := range widths {
+		if w >= i.src.width {
+			w = i.src.width
+		}
+		if len(result) > 0 && result[len(result)-1].Width == w {
+			break
+		}
+		v, err := i.p.process(i.src, w, scale(i.src.height, w, i.src.width), i.format, 0)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+		if w == i.src.width {
+			break
+		}
+	}
+	return result, nil
+}
+
+// spec describes how to process an image.
+type spec struct {
+	width, height int
+	format        string
+	quality       int
+}
+
+// parseSpec parses a spec such as "800x600 png q80". The format defaults to
+// the one of the image.
+func (i *Image) parseSpec(s string) (spec, error) {
+	result := spec{format: i.format}
+	for _, field := range strings.Fields(strings.ToLower(s)) {
+		if format, ok := encoders[field]; ok {
+			result.format = format
+			continue
+		}
+		if field == "webp" {
+			return spec{}, fmt.Errorf("invalid image spec %q, WebP images can't be encoded, convert them to jpg or png", s)
+		}
+		if q, ok := strings.CutPrefix(field, "q"); ok {
+			quality, err := strconv.Atoi(q)
+			if err != nil || quality < 1 || quality > 100 {
+				return spec{}, fmt.Errorf("invalid image spec %q, the quality must be between q1 and q100", s)
+			}
+			result.quality = quality
+			continue
+		}
+		w, h, ok := strings.Cut(field, "x")
+		if !ok {
+			return spec{}, fmt.Errorf("invalid image spec %q", s)
+		}
+		var err error
+		if w != "" {
+			if result.width, err = strconv.Atoi(w); err != nil || result.width <= 0 {
+				return spec{}, fmt.Errorf("invalid image spec %q", s)
+			}
+		}
+		if h != "" {
+			if result.height, err = strconv.Atoi(h); err != nil || result.height <= 0 {
+				return spec{}, fmt.Errorf("invalid image spec %q", s)
+			}
+		}
+	}
+	return result, nil
+}
+
+// scale returns n scaled by the ratio of to to from, rounded and at least 1.
+func scale(n, to, from int) int {
+	scaled := (n*to + from/2) / from
+	if scaled < 1 {
+		return 1
+	}
+	return scaled
+}
+
+// process returns the image resized to the given upright dimensions and
+// encoded in the given format. The result is taken from the cache if the
+// image was processed the same way by a previous build.
+func (p *Processor) process(src *source, width, height int, format string, quality int) (*Image, error) {
+	if format != "jpeg" {
+		quality = 0
+	} else if quality == 0 {
+		quality = p.opts.Quality
+	}
+	ext := outputExtensions[format]
+
+	key := hashBytes([]byte(fmt.Sprintf("%s %dx%d %s %d", src.hash, width, height, format, quality)))
+	name := fmt.Sprintf("%s.%dx%d.%s%s", strings.TrimSuffix(src.name, path.Ext(src.name)), width, height, key[:8], ext)
+
+	p.mu.Lock()
+	o, ok := p.images[key]
+	if !ok {
+		o = &once[*Image]{}
+		p.images[key] = o
+	}
+	p.mu.Unlock()
+
+	return o.do(func() (*Image, error) {
+		img := &Image{p: p, src: src, format: format, URL: "/" + name, Width: width, Height: height}
+		output := filepath.Join(p.outputDir, filepath.FromSlash(name))
+		if _, err := os.Stat(output); err == nil {
+			return img, nil
+		}
+		cached := filepath.Join(p.cacheDir, key+ext)
+		if _, err := os.Stat(cached); err != nil {
+			if err := p.encode(src, width, height, format, quality, cached); err != nil {
+				return nil, fmt.Errorf("error processing image %s: %w", src.name, err)
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+			return nil, err
+		}
+		if err := util.CopyFile(cached, output); err != nil {
+			return nil, fmt.Errorf("error copying image %s: %w", name, err)
+		}
+		return img, nil
+	})
+}
+
+// encode decodes the source image, resizes it, turns it upright and writes
+// it to path in the given format.
+func (p *Processor) encode(src *source, width, height int, format string, quality int, path string) error {
+	file, err := os.Open(src.path)
+	if err != nil {
+		return err
+	}
+	decoded, _, err := image.Decode(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	// Resize the image as stored, then turn it upright
+	w, h := width, height
+	if swapsDimensions(src.orientation) {
+		w, h = h, w
+	}
+	var img image.Image = decoded
+	if b := decoded.Bounds(); b.Dx() != w || b.Dy() != h {
+		resized := image.NewNRGBA(image.Rect(0, 0, w, h))
+		xdraw.CatmullRom.Scale(resized, resized.Bounds(), decoded, b, xdraw.Src, nil)
+		img = resized
+	}
+	img = orient(img, src.orientation)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	switch format {
+	case "jpeg":
+		// JPEG images have no transparency, so transparent pixels turn
+		// white rather than black
+		flat := image.NewRGBA(img.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		err = jpeg.Encode(tmp, flat, &jpeg.Options{Quality: quality})
+	case "png":
+		err = png.Encode(tmp, img)
+	case "gif":
+		err = gif.Encode(tmp, img, nil)
+	default:
+		err = fmt.Errorf("can't encode %s images", format)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// hashBytes returns the hex encoded SHA-256 hash of the data.
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,233 @@
+package images_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Bitlatte/evoke/pkg/config"
+	"github.com/Bitlatte/evoke/pkg/images"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chdir changes to a temporary directory for the duration of the test.
+func chdir(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(tmpDir))
+	t.Cleanup(func() { os.Chdir(originalWd) })
+}
+
+// writeImage writes a PNG or JPEG image whose left half is red and right
+// half is blue.
+func writeImage(t *testing.T, path string, width, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{R: 255, A: 255}
+			if x >= width/2 {
+				c = color.NRGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	buf := new(bytes.Buffer)
+	if filepath.Ext(path) == ".png" {
+		require.NoError(t, png.Encode(buf, img))
+	} else {
+		require.NoError(t, jpeg.Encode(buf, img, &jpeg.Options{Quality: 95}))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	return buf.Bytes()
+}
+
+// withOrientation returns the JPEG image with an EXIF segment holding the
+// given orientation.
+func withOrientation(data []byte, orientation uint16) []byte {
+	tiff := new(bytes.Buffer)
+	tiff.WriteString("MM\x00*")
+	binary.Write(tiff, binary.BigEndian, uint32(8))
+	binary.Write(tiff, binary.BigEndian, uint16(1))
+	binary.Write(tiff, binary.BigEndian, []uint16{0x0112, 3})
+	binary.Write(tiff, binary.BigEndian, uint32(1))
+	binary.Write(tiff, binary.BigEndian, []uint16{orientation, 0})
+	binary.Write(tiff, binary.BigEndian, uint32(0))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	result := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	result = binary.BigEndian.AppendUint16(result, uint16(len(segment)+2))
+	result = append(result, segment...)
+	return append(result, data[2:]...)
+}
+
+// newProcessor returns a Processor writing to dist with the default options.
+func newProcessor(t *testing.T) *images.Processor {
+	opts, err := images.NewOptions(config.Images{})
+	require.NoError(t, err)
+	p, err := images.New("dist", opts)
+	require.NoError(t, err)
+	return p
+}
+
+func TestImage_Resize(t *testing.T) {
+	chdir(t)
+	writeImage(t, "public/img/hero.png", 400, 200)
+	p := newProcessor(t)
+
+	original, err := p.Image("img/hero.png")
+	require.NoError(t, err)
+	assert.Equal(t, "/img/hero.png", original.String())
+	assert.Equal(t, 400, original.Width)
+	assert.Equal(t, 200, original.Height)
+
+	tests := []struct {
+		spec          string
+		width, height int
+		ext           string
+	}{
+		{"100x", 100, 50, ".png"},
+		{"x50", 100, 50, ".png"},
+		{"100x100", 100, 100, ".png"},
+		{"100x jpg q60", 100, 50, ".jpg"},
+		{"100x gif", 100, 50, ".gif"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			img, err := original.Resize(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.width, img.Width)
+			assert.Equal(t, tt.height, img.Height)
+			assert.Regexp(t, `^/img/hero\.\d+x\d+\.[0-9a-f]{8}\`+tt.ext+`$`, img.URL)
+
+			file, err := os.Open(filepath.Join("dist", img.URL))
+			require.NoError(t, err)
+			defer file.Close()
+			cfg, _, err := image.DecodeConfig(file)
+			require.NoError(t, err)
+			assert.Equal(t, tt.width, cfg.Width)
+			assert.Equal(t, tt.height, cfg.Height)
+		})
+	}
+
+	img, err := original.Fit("100x100")
+	require.NoError(t, err)
+	assert.Equal(t, 100, img.Width)
+	assert.Equal(t, 50, img.Height)
+
+	for _, spec := range []string{"big", "100x webp", "100x q0", "-1x"} {
+		_, err := original.Resize(spec)
+		assert.Error(t, err, spec)
+	}
+	_, err = original.Fit("100x")
+	assert.ErrorContains(t, err, "Fit needs a width and a height")
+	_, err = p.Image("img/missing.png")
+	assert.ErrorContains(t, err, "image img/missing.png not found")
+}
+
+func TestImage_Orientation(t *testing.T) {
+	chdir(t)
+	// The image is stored turned by 90° counterclockwise, and needs to be
+	// turned clockwise to be upright
+	data := writeImage(t, "assets/photo.jpg", 40, 20)
+	require.NoError(t, os.WriteFile("assets/photo.jpg", withOrientation(data, 6), 0644))
+	p := newProcessor(t)
+
+	original, err := p.Image("photo.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, 20, original.Width)
+	assert.Equal(t, 40, original.Height)
+	// Images of the assets directory are published when they are used
+	assert.FileExists(t, "dist/photo.jpg")
+
+	img, err := original.Resize("10x")
+	require.NoError(t, err)
+	assert.Equal(t, 20, img.Height)
+
+	file, err := os.Open(filepath.Join("dist", img.URL))
+	require.NoError(t, err)
+	defer file.Close()
+	decoded, _, err := image.Decode(file)
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 10, 20), decoded.Bounds())
+	// The left half, red, is now on top
+	r, _, b, _ := decoded.At(5, 2).RGBA()
+	assert.Greater(t, r, b)
+	r, _, b, _ = decoded.At(5, 17).RGBA()
+	assert.Greater(t, b, r)
+}
+
+func TestImage_Srcset(t *testing.T) {
+	chdir(t)
+	writeImage(t, "public/wide.jpg", 2000, 1000)
+	writeImage(t, "public/narrow.jpg", 1000, 500)
+	p := newProcessor(t)
+
+	wide, err := p.Image("wide.jpg")
+	require.NoError(t, err)
+	srcset, err := wide.Srcset()
+	require.NoError(t, err)
+	assert.Regexp(t, `^/wide\.480x240\.\w+\.jpg 480w, /wide\.960x480\.\w+\.jpg 960w, /wide\.1440x720\.\w+\.jpg 1440w$`, string(srcset))
+
+	// Narrower images stop at their own width
+	narrow, err := p.Image("narrow.jpg")
+	require.NoError(t, err)
+	srcset, err = narrow.Srcset()
+	require.NoError(t, err)
+	assert.Regexp(t, `^/narrow\.480x240\.\w+\.jpg 480w, /narrow\.960x480\.\w+\.jpg 960w, /narrow\.1000x500\.\w+\.jpg 1000w$`, string(srcset))
+	srcset, err = narrow.Srcset(200)
+	require.NoError(t, err)
+	assert.Regexp(t, `^/narrow\.200x100\.\w+\.jpg 200w$`, string(srcset))
+}
+
+func TestProcessor_Cache(t *testing.T) {
+	chdir(t)
+	writeImage(t, "public/hero.png", 400, 200)
+	p := newProcessor(t)
+	original, err := p.Image("hero.png")
+	require.NoError(t, err)
+	first, err := original.Resize("100x")
+	require.NoError(t, err)
+	require.NoError(t, p.Finish())
+
+	// Images processed by a previous build are taken from the cache, so
+	// replace the cached image to tell
+	cached, err := filepath.Glob(filepath.Join(filepath.FromSlash(images.CacheDir), "*.png"))
+	require.NoError(t, err)
+	require.Len(t, cached, 1)
+	require.NoError(t, os.WriteFile(cached[0], []byte("cached"), 0644))
+	require.NoError(t, os.Remove(filepath.Join("dist", first.URL)))
+
+	p = newProcessor(t)
+	hash := p.Hash()
+	original, err = p.Image("hero.png")
+	require.NoError(t, err)
+	second, err := original.Resize("100x")
+	require.NoError(t, err)
+	assert.Equal(t, first.URL, second.URL)
+	content, err := os.ReadFile(filepath.Join("dist", second.URL))
+	require.NoError(t, err)
+	assert.Equal(t, "cached", string(content))
+
+	// The hash of the images used by the previous build changes with them
+	writeImage(t, "public/hero.png", 400, 100)
+	assert.NotEqual(t, hash, newProcessor(t).Hash())
+
+	// Changed images get a new URL
+	p = newProcessor(t)
+	original, err = p.Image("hero.png")
+	require.NoError(t, err)
+	third, err := original.Resize("100x")
+	require.NoError(t, err)
+	assert.NotEqual(t, first.URL, third.URL)
+	assert.True(t, strings.HasPrefix(third.URL, "/hero.100x25."))
+}
@@ -0,0 +1,104 @@
+package images
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/Bitlatte/evoke/pkg/pipelines"
+	"github.com/Bitlatte/evoke/pkg/util"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Transformer is a goldmark AST transformer that turns the images of a
+// markdown page into responsive images: the image is resized to the
+// configured widths and the img tag gets a srcset listing them. Images that
+// don't exist in the assets or public directory, GIF images, which may be
+// animated, and external images are left untouched.
+type Transformer struct {
+	p *Processor
+}
+
+// NewTransformer creates a new Transformer processing the images with p.
+func NewTransformer(p *Processor) *Transformer {
+	return &Transformer{p: p}
+}
+
+// Transform rewrites the images in the given document. Errors processing an
+// image are stored in the parser context under pipelines.ErrorKey.
+func (t *Transformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source, _ := pc.Get(pipelines.SourcePathKey).(string)
+
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		img, ok := n.(*ast.Image)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		name, ok := imageName(source, string(img.Destination))
+		if !ok {
+			return ast.WalkContinue, nil
+		}
+		if err := t.rewrite(img, name); err != nil {
+			pc.Set(pipelines.ErrorKey, err)
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// rewrite makes the image a responsive image, if the image with the given
+// name can be processed.
+func (t *Transformer) rewrite(img *ast.Image, name string) error {
+	original, err := t.p.Find(name)
+	if err != nil || original == nil {
+		return err
+	}
+	variants, err := original.variants(nil)
+	if err != nil {
+		return err
+	}
+	largest := variants[len(variants)-1]
+	candidates := make([]string, len(variants))
+	for i, v := range variants {
+		candidates[i] = fmt.Sprintf("%s %dw", v.URL, v.Width)
+	}
+
+	img.Destination = []byte(largest.URL)
+	img.SetAttributeString("srcset", strings.Join(candidates, ", "))
+	img.SetAttributeString("sizes", fmt.Sprintf("(max-width: %dpx) 100vw, %dpx", largest.Width, largest.Width))
+	img.SetAttributeString("width", strconv.Itoa(largest.Width))
+	img.SetAttributeString("height", strconv.Itoa(largest.Height))
+	img.SetAttributeString("loading", "lazy")
+	img.SetAttributeString("decoding", "async")
+	return nil
+}
+
+// imageName returns the name of the image a markdown page at source links
+// to, relative to the assets or public directory. It reports false for
+// external images and GIF images.
+func imageName(source, destination string) (string, bool) {
+	u, err := url.Parse(destination)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || u.RawQuery != "" {
+		return "", false
+	}
+	if strings.EqualFold(path.Ext(u.Path), ".gif") {
+		return "", false
+	}
+	if strings.HasPrefix(u.Path, "/") {
+		return cleanName(u.Path), true
+	}
+	// Relative images are relative to the URL of the page
+	if source == "" {
+		return "", false
+	}
+	dir := path.Dir(strings.ReplaceAll(util.ToOutputPath(source), "\\", "/"))
+	name := path.Join(dir, u.Path)
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return cleanName(name), true
+}
@@ -4,6 +4,7 @@ package init
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/Bitlatte/evoke/pkg/defaults"
@@ -56,8 +57,21 @@ func Run() error {
 		}
 	}
 
+	// Ask whether to add the search widget.
+	var addSearch bool
+	searchPrompt := &survey.Confirm{
+		Message: "Add a search box?",
+		Default: false,
+	}
+	if err := survey.AskOne(searchPrompt, &addSearch); err != nil {
+		return err
+	}
+
 	// Create evoke.yaml.
 	evokeYAML := []byte(fmt.Sprintf("site:\n  name: %s\n", projectName))
+	if addSearch {
+		evokeYAML = append(evokeYAML, "search:\n  enabled: true\n"...)
+	}
 	if err := os.WriteFile(fmt.Sprintf("%s/evoke.yaml", directory), evokeYAML, 0644); err != nil {
 		return err
 	}
@@ -69,10 +83,24 @@ func Run() error {
 	}
 
 	// Create content/_layout.html.
-	if err := os.WriteFile(fmt.Sprintf("%s/content/_layout.html", directory), []byte(defaults.Layout), 0644); err != nil {
+	layout := defaults.Layout
+	if addSearch {
+		layout = strings.Replace(layout, "<body>\n", "<body>\n\t{{ template \"search.html\" . }}\n", 1)
+	}
+	if err := os.WriteFile(fmt.Sprintf("%s/content/_layout.html", directory), []byte(layout), 0644); err != nil {
 		return err
 	}
 
+	// Create partials/search.html.
+	if addSearch {
+		if err := os.MkdirAll(fmt.Sprintf("%s/partials", directory), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.WriteFile(fmt.Sprintf("%s/partials/search.html", directory), []byte(defaults.SearchPartial), 0644); err != nil {
+			return err
+		}
+	}
+
 	fmt.Printf("Successfully created project in %s\n", directory)
 
 	return nil
@@ -0,0 +1,182 @@
+package links
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// BrokenLink is an internal link in the generated site that points to a page
+// or anchor that doesn't exist.
+type BrokenLink struct {
+	// Page is the output path of the page containing the link.
+	Page string
+	// Link is the link as written in the page.
+	Link string
+	// Reason describes why the link is broken.
+	Reason string
+}
+
+// String returns a human readable description of the broken link.
+func (b *BrokenLink) String() string {
+	return fmt.Sprintf("%s: %s (%s)", b.Page, b.Link, b.Reason)
+}
+
+// linkAttributes are the attributes that reference other files, by tag.
+var linkAttributes = map[string]string{
+	"a":      "href",
+	"link":   "href",
+	"img":    "src",
+	"script": "src",
+	"source": "src",
+	"iframe": "src",
+}
+
+// page holds the links and anchors found in a generated HTML page.
+type page struct {
+	links   []string
+	anchors map[string]bool
+}
+
+// Check walks the HTML files in the output directory and returns every
+// internal link that doesn't resolve to a generated file, or that points to
+// an anchor missing from the target page.
+func Check(outputDir string) ([]*BrokenLink, error) {
+	files := make(map[string]bool)
+	pages := make(map[string]*page)
+
+	err := filepath.Walk(outputDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(outputDir, p)
+		if err != nil {
+			return err
+		}
+		urlPath := "/" + filepath.ToSlash(rel)
+		files[urlPath] = true
+
+		if filepath.Ext(p) != ".html" {
+			return nil
+		}
+		pg, err := parsePage(p)
+		if err != nil {
+			return fmt.Errorf("error parsing %s: %w", p, err)
+		}
+		pages[urlPath] = pg
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var broken []*BrokenLink
+	for pagePath, pg := range pages {
+		for _, link := range pg.links {
+			if reason := checkLink(pagePath, link, files, pages); reason != "" {
+				broken = append(broken, &BrokenLink{
+					Page:   strings.TrimPrefix(pagePath, "/"),
+					Link:   link,
+					Reason: reason,
+				})
+			}
+		}
+	}
+	return broken, nil
+}
+
+// parsePage collects the links and anchors of an HTML file.
+func parsePage(p string) (*page, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pg := &page{anchors: make(map[string]bool)}
+	z := html.NewTokenizer(f)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			return pg, nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			linkAttr := linkAttributes[t.Data]
+			for _, attr := range t.Attr {
+				switch {
+				case attr.Key == "id", t.Data == "a" && attr.Key == "name":
+					pg.anchors[attr.Val] = true
+				case attr.Key == linkAttr:
+					pg.links = append(pg.links, attr.Val)
+				}
+			}
+		}
+	}
+}
+
+// checkLink returns the reason the link is broken, or an empty string if it
+// resolves or isn't an internal link.
+func checkLink(pagePath, link string, files map[string]bool, pages map[string]*page) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "invalid URL"
+	}
+	if u.Scheme != "" || u.Host != "" || u.Opaque != "" {
+		return ""
+	}
+
+	target := pagePath
+	if u.Path != "" {
+		if strings.HasPrefix(u.Path, "/") {
+			target = path.Clean(u.Path)
+		} else {
+			target = path.Join(path.Dir(pagePath), u.Path)
+		}
+		if strings.HasSuffix(u.Path, "/") {
+			target = path.Join(target, "index.html")
+		}
+		target = resolve(target, files)
+		if target == "" {
+			return "page not found"
+		}
+	}
+
+	if u.Fragment == "" {
+		return ""
+	}
+	pg, ok := pages[target]
+	if !ok {
+		return ""
+	}
+	if !pg.anchors[u.Fragment] {
+		return fmt.Sprintf("anchor #%s not found", u.Fragment)
+	}
+	return ""
+}
+
+// resolve returns the generated file served for the given URL path, or an
+// empty string if there is none.
+func resolve(p string, files map[string]bool) string {
+	candidates := []string{p}
+	if path.Ext(p) == "" {
+		candidates = append(candidates, p+".html", path.Join(p, "index.html"))
+	}
+	for _, c := range candidates {
+		if files[c] {
+			return c
+		}
+	}
+	return ""
+}
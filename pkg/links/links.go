@@ -0,0 +1,97 @@
+// Package links rewrites links between content files to their output URLs
+// and checks the generated site for broken internal links.
+package links
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Bitlatte/evoke/pkg/i18n"
+	"github.com/Bitlatte/evoke/pkg/pipelines"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Transformer is a goldmark AST transformer that rewrites relative links to
+// markdown and HTML content files, such as ../guide/setup.md, to the relative
+// URL of the page they produce. Links to files that don't exist in the
+// content directory are left untouched so the link checker can report them.
+// On multilingual sites, links point to the translation of the target in the
+// language of the page when there is one.
+type Transformer struct {
+	languages *i18n.Languages
+}
+
+// NewTransformer creates a new Transformer for a site in the given
+// languages, which is nil for a site in a single language.
+func NewTransformer(languages *i18n.Languages) *Transformer {
+	return &Transformer{languages: languages}
+}
+
+// Transform rewrites the links in the given document.
+func (t *Transformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source, ok := pc.Get(pipelines.SourcePathKey).(string)
+	if !ok || source == "" {
+		return
+	}
+
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if link, ok := n.(*ast.Link); ok {
+			if rewritten, ok := rewrite(t.languages, source, string(link.Destination)); ok {
+				link.Destination = []byte(rewritten)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// Rewrite returns the output URL for a link found in the given content file,
+// relative to the page the content file produces. It reports false if the
+// link does not point to a markdown or HTML content file.
+func Rewrite(source, link string) (string, bool) {
+	return rewrite(nil, source, link)
+}
+
+// rewrite is Rewrite on a site in the given languages.
+func rewrite(languages *i18n.Languages, source, link string) (string, bool) {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+		return "", false
+	}
+
+	ext := path.Ext(u.Path)
+	if ext != ".md" && ext != ".html" {
+		return "", false
+	}
+
+	target := filepath.Join(filepath.Dir(source), filepath.FromSlash(u.Path))
+	if !strings.HasPrefix(target, "content"+string(filepath.Separator)) {
+		return "", false
+	}
+	if info, err := os.Stat(target); err != nil || info.IsDir() {
+		return "", false
+	}
+
+	if lang := languages.Of(source); lang != nil {
+		if translation, ok := languages.Translation(target, lang.Code); ok {
+			target = translation
+		}
+	}
+
+	targetOutput := languages.OutputPath(strings.TrimSuffix(target, ext) + ".html")
+	sourceDir := filepath.Dir(languages.OutputPath(source))
+	rel, err := filepath.Rel(sourceDir, targetOutput)
+	if err != nil {
+		return "", false
+	}
+
+	u.Path = filepath.ToSlash(rel)
+	return u.String(), true
+}
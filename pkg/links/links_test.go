@@ -0,0 +1,81 @@
+package links_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitlatte/evoke/pkg/links"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewrite(t *testing.T) {
+	// Arrange
+	tmpDir, err := os.MkdirTemp("", "links-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	originalWd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(tmpDir))
+	defer os.Chdir(originalWd)
+
+	os.MkdirAll("content/(docs)/guide", 0755)
+	os.MkdirAll("content/blog", 0755)
+	os.WriteFile("content/(docs)/guide/setup.md", []byte("# Setup"), 0644)
+	os.WriteFile("content/(docs)/guide/intro.md", []byte("# Intro"), 0644)
+	os.WriteFile("content/blog/post.html", []byte("<h1>Post</h1>"), 0644)
+
+	tests := []struct {
+		source string
+		link   string
+		want   string
+		ok     bool
+	}{
+		{"content/(docs)/guide/intro.md", "setup.md", "setup.html", true},
+		{"content/(docs)/guide/intro.md", "setup.md#install", "setup.html#install", true},
+		{"content/(docs)/guide/intro.md", "../../blog/post.html", "../blog/post.html", true},
+		{"content/blog/post.md", "../(docs)/guide/setup.md", "../guide/setup.html", true},
+		{"content/(docs)/guide/intro.md", "missing.md", "", false},
+		{"content/(docs)/guide/intro.md", "https://example.com/a.md", "", false},
+		{"content/(docs)/guide/intro.md", "/guide/setup.md", "", false},
+		{"content/(docs)/guide/intro.md", "image.png", "", false},
+	}
+
+	for _, tt := range tests {
+		// Act
+		got, ok := links.Rewrite(filepath.FromSlash(tt.source), tt.link)
+
+		// Assert
+		assert.Equal(t, tt.ok, ok, tt.link)
+		assert.Equal(t, tt.want, got, tt.link)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	// Arrange
+	outputDir, err := os.MkdirTemp("", "links-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	os.MkdirAll(filepath.Join(outputDir, "guide"), 0755)
+	os.WriteFile(filepath.Join(outputDir, "index.html"), []byte(`<a href="guide/setup.html#install">Setup</a><a href="guide/">Guide</a><a href="https://example.com">Out</a><img src="logo.png"><a href="#top">Top</a>`), 0644)
+	os.WriteFile(filepath.Join(outputDir, "guide", "index.html"), []byte(`<a href="../missing.html">Missing</a><a href="setup.html#nope">Nope</a><a href="/index">Home</a>`), 0644)
+	os.WriteFile(filepath.Join(outputDir, "guide", "setup.html"), []byte(`<h2 id="install">Install</h2>`), 0644)
+
+	// Act
+	broken, err := links.Check(outputDir)
+
+	// Assert
+	assert.NoError(t, err)
+	var got []string
+	for _, b := range broken {
+		got = append(got, b.String())
+	}
+	assert.ElementsMatch(t, []string{
+		"index.html: logo.png (page not found)",
+		"index.html: #top (anchor #top not found)",
+		"guide/index.html: ../missing.html (page not found)",
+		"guide/index.html: setup.html#nope (anchor #nope not found)",
+	}, got)
+}
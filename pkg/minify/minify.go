@@ -0,0 +1,143 @@
+// Package minify minifies the HTML, CSS, JavaScript, SVG and JSON files
+// written to the output directory.
+package minify
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Bitlatte/evoke/pkg/config"
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/html"
+	"github.com/tdewolff/minify/v2/js"
+	"github.com/tdewolff/minify/v2/json"
+	"github.com/tdewolff/minify/v2/svg"
+)
+
+// Types of files that can be minified, as named in the minify section of the
+// configuration.
+const (
+	HTML = "html"
+	CSS  = "css"
+	JS   = "js"
+	SVG  = "svg"
+	JSON = "json"
+)
+
+// mediaTypes maps the extensions of the files that can be minified to their
+// type and media type.
+var mediaTypes = map[string][2]string{
+	".html": {HTML, "text/html"},
+	".htm":  {HTML, "text/html"},
+	".css":  {CSS, "text/css"},
+	".js":   {JS, "application/javascript"},
+	".mjs":  {JS, "application/javascript"},
+	".svg":  {SVG, "image/svg+xml"},
+	".json": {JSON, "application/json"},
+}
+
+// minifiedLineLength is the length of the first line above which a file is
+// considered already minified.
+const minifiedLineLength = 1024
+
+// Minifier minifies files before they are written to the output directory. A
+// nil Minifier leaves them unchanged.
+type Minifier struct {
+	m *minify.M
+	// types are the enabled types of files.
+	types map[string]bool
+}
+
+// New returns a Minifier for the configuration, or nil if minification is
+// disabled. The enabled flag turns minification on regardless of the
+// configuration, as the --minify flag does.
+func New(cfg config.Minify, enabled bool) *Minifier {
+	if !cfg.Enabled && !enabled {
+		return nil
+	}
+
+	m := minify.New()
+	m.Add("text/html", &html.Minifier{
+		KeepDocumentTags: true,
+		KeepEndTags:      true,
+		KeepQuotes:       true,
+	})
+	m.AddFunc("text/css", css.Minify)
+	m.AddFunc("application/javascript", js.Minify)
+	m.AddFunc("image/svg+xml", svg.Minify)
+	m.AddFunc("application/json", json.Minify)
+
+	return &Minifier{
+		m: m,
+		types: map[string]bool{
+			HTML: cfg.HTML == nil || *cfg.HTML,
+			CSS:  cfg.CSS == nil || *cfg.CSS,
+			JS:   cfg.JS == nil || *cfg.JS,
+			SVG:  cfg.SVG == nil || *cfg.SVG,
+			JSON: cfg.JSON == nil || *cfg.JSON,
+		},
+	}
+}
+
+// Handles reports whether files at path are minified.
+func (m *Minifier) Handles(path string) bool {
+	if m == nil {
+		return false
+	}
+	t, ok := mediaTypes[strings.ToLower(filepath.Ext(path))]
+	return ok && m.types[t[0]]
+}
+
+// Minify returns the minified content of the file at path. Files of other
+// types, and files that are already minified, are returned unchanged. Files
+// are considered minified if their name contains .min., e.g. app.min.js, and
+// stylesheets and scripts if their first line is very long.
+func (m *Minifier) Minify(path string, content []byte) ([]byte, error) {
+	if !m.Handles(path) {
+		return content, nil
+	}
+	t := mediaTypes[strings.ToLower(filepath.Ext(path))]
+	if isMinified(path, t[0], content) {
+		return content, nil
+	}
+	minified, err := m.m.Bytes(t[1], content)
+	if err != nil {
+		return nil, fmt.Errorf("error minifying %s: %w", path, err)
+	}
+	return minified, nil
+}
+
+// String describes the enabled types of files, e.g. css,html,js.
+func (m *Minifier) String() string {
+	if m == nil {
+		return "off"
+	}
+	var types []string
+	for t, enabled := range m.types {
+		if enabled {
+			types = append(types, t)
+		}
+	}
+	sort.Strings(types)
+	return strings.Join(types, ",")
+}
+
+// isMinified reports whether the file of the given type looks already
+// minified.
+func isMinified(path, t string, content []byte) bool {
+	if strings.Contains(filepath.Base(path), ".min.") {
+		return true
+	}
+	if t != CSS && t != JS {
+		return false
+	}
+	line := content
+	if i := bytes.IndexByte(content, '\n'); i >= 0 {
+		line = content[:i]
+	}
+	return len(line) > minifiedLineLength
+}
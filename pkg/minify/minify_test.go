@@ -0,0 +1,74 @@
+package minify_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Bitlatte/evoke/pkg/config"
+	"github.com/Bitlatte/evoke/pkg/minify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMinify(t *testing.T) {
+	m := minify.New(config.Minify{}, true)
+	require.NotNil(t, m)
+
+	tests := []struct {
+		path     string
+		content  string
+		expected string
+	}{
+		{"index.html", "<html>\n  <body>\n    <p class=\"a\">Hi</p>\n  </body>\n</html>\n", `<html><body><p class="a">Hi</p></body></html>`},
+		{"css/style.css", "body {\n  color: #ff0000;\n}\n", "body{color:red}"},
+		{"js/app.js", "function add(a, b) {\n  return a + b;\n}\n", "function add(e,t){return e+t}"},
+		{"logo.svg", "<svg xmlns=\"http://www.w3.org/2000/svg\">\n  <rect width=\"10\" height=\"10\"/>\n</svg>\n", `<svg xmlns="http://www.w3.org/2000/svg"><rect width="10" height="10"/></svg>`},
+		{"data.json", "{\n  \"a\": [1, 2]\n}\n", `{"a":[1,2]}`},
+		{"image.png", "not minified\n", "not minified\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			minified, err := m.Minify(tt.path, []byte(tt.content))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(minified))
+		})
+	}
+}
+
+func TestMinify_SkipsMinifiedFiles(t *testing.T) {
+	m := minify.New(config.Minify{}, true)
+
+	content := "body {\n  color: red;\n}\n"
+	minified, err := m.Minify("css/vendor.min.css", []byte(content))
+	require.NoError(t, err)
+	assert.Equal(t, content, string(minified))
+
+	// Scripts with a very long first line are bundles that were minified
+	// without being named so
+	content = "var a = 1;" + strings.Repeat(" ", 2048) + "\nvar b = 2;\n"
+	minified, err = m.Minify("js/bundle.js", []byte(content))
+	require.NoError(t, err)
+	assert.Equal(t, content, string(minified))
+}
+
+func TestNew(t *testing.T) {
+	// Minification is off unless the configuration or the flag turns it on
+	assert.Nil(t, minify.New(config.Minify{}, false))
+	assert.NotNil(t, minify.New(config.Minify{Enabled: true}, false))
+
+	var m *minify.Minifier
+	assert.False(t, m.Handles("index.html"))
+	assert.Equal(t, "off", m.String())
+
+	// Types can be turned off one by one
+	off := false
+	m = minify.New(config.Minify{Enabled: true, CSS: &off, JSON: &off}, false)
+	assert.True(t, m.Handles("index.html"))
+	assert.False(t, m.Handles("css/style.css"))
+	assert.Equal(t, "html,js,svg", m.String())
+
+	content := "body {\n  color: red;\n}\n"
+	minified, err := m.Minify("css/style.css", []byte(content))
+	require.NoError(t, err)
+	assert.Equal(t, content, string(minified))
+}
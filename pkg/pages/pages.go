@@ -0,0 +1,195 @@
+// Package pages provides the index of the pages in the content directory.
+package pages
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Bitlatte/evoke/pkg/pipelines"
+	"github.com/Bitlatte/evoke/pkg/util"
+)
+
+// dateLayouts are the layouts accepted for dates written as strings.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Page is a page of the site.
+type Page struct {
+	// Path is the path of the source file.
+	Path string
+	// URL is the URL of the generated page, relative to the site root.
+	URL string
+	// Params is the front matter of the page.
+	Params map[string]any
+	// Language is the code of the language of the page on multilingual
+	// sites, e.g. de.
+	Language string
+	// Translations are the published translations of the page into the
+	// other languages of a multilingual site.
+	Translations []*Page
+}
+
+// New creates a page for the source file at path with the given front matter.
+func New(path string, params map[string]any) *Page {
+	if params == nil {
+		params = make(map[string]any)
+	}
+	return &Page{
+		Path:   path,
+		URL:    URL(path),
+		Params: params,
+	}
+}
+
+// URL returns the URL of the page generated from the source file at path.
+func URL(path string) string {
+	if ext := filepath.Ext(path); ext == ".md" {
+		path = strings.TrimSuffix(path, ext) + ".html"
+	}
+	return "/" + filepath.ToSlash(util.ToOutputPath(path))
+}
+
+// Title returns the title of the page.
+func (p *Page) Title() string {
+	title, _ := p.Params["title"].(string)
+	return title
+}
+
+// Draft reports whether the page is marked as a draft.
+func (p *Page) Draft() bool {
+	draft, _ := p.Params["draft"].(bool)
+	return draft
+}
+
+// Date returns the date of the page.
+func (p *Page) Date() time.Time {
+	return p.time("date")
+}
+
+// PublishDate returns the date the page is published, falling back to its
+// date.
+func (p *Page) PublishDate() time.Time {
+	if t := p.time("publishDate"); !t.IsZero() {
+		return t
+	}
+	return p.Date()
+}
+
+// ExpiryDate returns the date the page is no longer published.
+func (p *Page) ExpiryDate() time.Time {
+	return p.time("expiryDate")
+}
+
+// time returns the front matter value under key as a time.
+func (p *Page) time(key string) time.Time {
+	switch v := p.Params[key].(type) {
+	case time.Time:
+		return v
+	case string:
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// Filter selects the pages that are published.
+type Filter struct {
+	// Drafts includes pages marked as drafts.
+	Drafts bool
+	// Future includes pages with a publish date in the future.
+	Future bool
+	// Expired includes pages with an expiry date in the past.
+	Expired bool
+	// Now is the time the publish and expiry dates are compared against.
+	Now time.Time
+}
+
+// Includes reports whether the page is published.
+func (f Filter) Includes(p *Page) bool {
+	if p.Draft() && !f.Drafts {
+		return false
+	}
+	if publish := p.PublishDate(); !f.Future && publish.After(f.Now) {
+		return false
+	}
+	if expiry := p.ExpiryDate(); !f.Expired && !expiry.IsZero() && !expiry.After(f.Now) {
+		return false
+	}
+	return true
+}
+
+// Apply splits the pages into the published and excluded ones.
+func (f Filter) Apply(pages []*Page) (published, excluded []*Page) {
+	for _, p := range pages {
+		if f.Includes(p) {
+			published = append(published, p)
+		} else {
+			excluded = append(excluded, p)
+		}
+	}
+	return published, excluded
+}
+
+// Load reads the front matter of every page in the content directory. Pages
+// are sorted by publish date, newest first, then by URL.
+func Load(contentDir string) ([]*Page, error) {
+	var pages []*Page
+	if _, err := os.Stat(contentDir); os.IsNotExist(err) {
+		return pages, nil
+	}
+
+	err := filepath.Walk(contentDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name()[0] == '_' {
+			return nil
+		}
+
+		var params map[string]any
+		switch filepath.Ext(path) {
+		case ".md":
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			params, _, err = pipelines.ParseFrontMatter(content)
+			if err != nil {
+				return err
+			}
+		case ".html":
+		default:
+			return nil
+		}
+
+		pages = append(pages, New(path, params))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	Sort(pages)
+	return pages, nil
+}
+
+// Sort sorts the pages by publish date, newest first, then by URL.
+func Sort(pages []*Page) {
+	sort.SliceStable(pages, func(i, j int) bool {
+		di, dj := pages[i].PublishDate(), pages[j].PublishDate()
+		if !di.Equal(dj) {
+			return di.After(dj)
+		}
+		return pages[i].URL < pages[j].URL
+	})
+}
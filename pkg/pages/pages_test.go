@@ -0,0 +1,39 @@
+package pages_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Bitlatte/evoke/pkg/pages"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter_Includes(t *testing.T) {
+	// Arrange
+	now := time.Date(2024, 7, 8, 12, 0, 0, 0, time.UTC)
+	draft := pages.New("content/draft.md", map[string]any{"draft": true})
+	future := pages.New("content/future.md", map[string]any{"publishDate": "2024-08-01"})
+	futureDate := pages.New("content/future-date.md", map[string]any{"date": now.Add(time.Hour)})
+	expired := pages.New("content/expired.md", map[string]any{"expiryDate": "2024-07-01T00:00:00Z"})
+	published := pages.New("content/(blog)/post.md", map[string]any{"date": "2024-07-01", "expiryDate": "2025-01-01"})
+
+	tests := []struct {
+		filter pages.Filter
+		want   []*pages.Page
+	}{
+		{pages.Filter{Now: now}, []*pages.Page{published}},
+		{pages.Filter{Now: now, Drafts: true}, []*pages.Page{draft, published}},
+		{pages.Filter{Now: now, Future: true}, []*pages.Page{future, futureDate, published}},
+		{pages.Filter{Now: now, Expired: true}, []*pages.Page{expired, published}},
+	}
+
+	for _, tt := range tests {
+		// Act
+		got, excluded := tt.filter.Apply([]*pages.Page{draft, future, futureDate, expired, published})
+
+		// Assert
+		assert.Equal(t, tt.want, got)
+		assert.Len(t, excluded, 5-len(tt.want))
+	}
+	assert.Equal(t, "/post.html", published.URL)
+}
@@ -13,13 +13,20 @@ type Partials struct {
 }
 
 // LoadPartials walks the "partials" directory and parses all the files as templates.
-func LoadPartials() (*Partials, error) {
-	t := template.New("")
+// The given functions are available to the partials and to every template
+// cloned from them.
+func LoadPartials(funcs template.FuncMap) (*Partials, error) {
+	t := template.New("").Funcs(funcs)
 	err := filepath.Walk("partials", func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
+		// Shortcode templates are loaded separately by the shortcodes package.
+		if info.IsDir() && path == filepath.Join("partials", "shortcodes") {
+			return filepath.SkipDir
+		}
+
 		if !info.IsDir() {
 			// Read the content of the partial file
 			content, err := os.ReadFile(path)
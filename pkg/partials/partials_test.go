@@ -17,7 +17,7 @@ func TestLoadPartials_LoadsAllPartials(t *testing.T) {
 	os.WriteFile("partials/post.html", []byte("{{.Content}}"), 0644)
 
 	// Act
-	loadedPartials, err := partials.LoadPartials()
+	loadedPartials, err := partials.LoadPartials(nil)
 
 	// Assert
 	assert.NoError(t, err)
@@ -55,7 +55,7 @@ func BenchmarkLoadPartials(b *testing.B) {
 
 	// Act
 	for i := 0; i < b.N; i++ {
-		_, err := partials.LoadPartials()
+		_, err := partials.LoadPartials(nil)
 		if err != nil {
 			b.Fatal(err)
 		}
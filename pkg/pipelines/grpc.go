@@ -5,6 +5,8 @@ import (
 
 	"github.com/Bitlatte/evoke/pkg/plugins"
 	"github.com/Bitlatte/evoke/proto"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // GRPC is a pipeline that uses a gRPC plugin to process assets.
@@ -33,17 +35,24 @@ func (p *GRPC) Process(asset *Asset) (*Asset, error) {
 		return nil, err
 	}
 
+	metadata, err := plugins.EncodeMetadata(asset.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
 	processedAsset, err := p.Plugin.ProcessAsset(&proto.Asset{
 		Path:         asset.Path,
 		Content:      buf.Bytes(),
 		PipelineName: p.name,
+		Metadata:     protobuf.Clone(metadata).(*structpb.Struct),
 	})
 	if err != nil {
 		return nil, err
 	}
 
 	return &Asset{
-		Path:    processedAsset.Path,
-		Content: bytes.NewReader(processedAsset.Content),
+		Path:     processedAsset.Path,
+		Content:  bytes.NewReader(processedAsset.Content),
+		Metadata: plugins.MergeMetadata(asset.Metadata, metadata, processedAsset.Metadata),
 	}, nil
 }
@@ -5,18 +5,56 @@ import (
 	"bytes"
 	"path/filepath"
 
+	"github.com/Bitlatte/evoke/pkg/shortcodes"
 	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
 	"gopkg.in/yaml.v3"
 )
 
+// SourcePathKey is the parser context key holding the path of the markdown
+// file being converted, for use by AST transformers.
+var SourcePathKey = parser.NewContextKey()
+
+// ErrorKey is the parser context key where AST transformers store the error
+// they ran into, which fails the conversion of the markdown file.
+var ErrorKey = parser.NewContextKey()
+
+// contextError returns the error stored in the parser context, if any.
+func contextError(ctx parser.Context) error {
+	err, _ := ctx.Get(ErrorKey).(error)
+	return err
+}
+
 // MarkdownPipeline is a pipeline for processing Markdown files.
 type MarkdownPipeline struct {
 	Goldmark goldmark.Markdown
+	// HeadingAnchors appends a self-link anchor to every heading.
+	HeadingAnchors bool
+	// TOCStartLevel is the first heading level collected into the table of
+	// contents.
+	TOCStartLevel int
+	// TOCEndLevel is the last heading level collected into the table of
+	// contents.
+	TOCEndLevel int
+	// Shortcodes are the shortcode templates available to markdown files.
+	Shortcodes *shortcodes.Shortcodes
+	// Site is the site configuration passed to shortcodes.
+	Site map[string]any
+	// Localize returns the site and the shortcodes of the markdown file at
+	// path in the language of the file on multilingual sites. Site and
+	// Shortcodes are used when it's nil.
+	Localize func(path string) (map[string]any, *shortcodes.Shortcodes)
 }
 
 // NewMarkdownPipeline creates a new MarkdownPipeline.
 func NewMarkdownPipeline(gm goldmark.Markdown) *MarkdownPipeline {
-	return &MarkdownPipeline{Goldmark: gm}
+	return &MarkdownPipeline{
+		Goldmark:      gm,
+		TOCStartLevel: 2,
+		TOCEndLevel:   3,
+	}
 }
 
 // Name returns the name of the pipeline.
@@ -36,25 +74,171 @@ func (p *MarkdownPipeline) Process(asset *Asset) (*Asset, error) {
 		return nil, err
 	}
 
-	frontMatter, body, err := p.parseFrontMatter(buf.Bytes())
+	frontMatter, body, err := ParseFrontMatter(buf.Bytes())
 	if err != nil {
 		return nil, err
 	}
 
+	if frontMatter == nil {
+		frontMatter = make(map[string]interface{})
+	}
+	// Metadata passed with the asset, e.g. the front matter of a page
+	// generated by a plugin, fills in the keys the source doesn't set
+	for k, v := range asset.Metadata {
+		if _, ok := frontMatter[k]; !ok {
+			frontMatter[k] = v
+		}
+	}
+
+	site, sc := p.Site, p.Shortcodes
+	if p.Localize != nil {
+		site, sc = p.Localize(asset.Path)
+	}
+	var placeholders map[string][]byte
+	if sc != nil && shortcodes.Contains(body) {
+		convert := func(source []byte) ([]byte, error) {
+			return p.convert(asset.Path, source)
+		}
+		body, placeholders, err = sc.Expand(body, frontMatter, site, convert)
+		if err != nil {
+			return nil, err
+		}
+	} else if shortcodes.Contains(body) {
+		// Escaped shortcodes are shown literally even without shortcodes
+		body = shortcodes.Unescape(body)
+	}
+
+	ctx := parser.NewContext()
+	ctx.Set(SourcePathKey, asset.Path)
+	doc := p.Goldmark.Parser().Parse(text.NewReader(body), parser.WithContext(ctx))
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	toc := p.processHeadings(doc, body, ctx)
+
 	output := new(bytes.Buffer)
-	if err := p.Goldmark.Convert(body, output); err != nil {
+	if err := p.Goldmark.Renderer().Render(output, body, doc); err != nil {
 		return nil, err
 	}
 
+	if placeholders != nil {
+		output = bytes.NewBuffer(shortcodes.Restore(output.Bytes(), placeholders))
+	}
+
+	// Layouts see the table of contents as .Page.TableOfContents, unless the
+	// front matter sets it
+	if _, ok := frontMatter["TableOfContents"]; !ok {
+		frontMatter["TableOfContents"] = toc
+	}
+
 	asset.Content = output
 	asset.Metadata = frontMatter
+	asset.TableOfContents = toc
 	asset.Path = asset.Path[:len(asset.Path)-3] + ".html"
 
 	return asset, nil
 }
 
-// parseFrontMatter parses the front matter from the content.
-func (p *MarkdownPipeline) parseFrontMatter(content []byte) (map[string]interface{}, []byte, error) {
+// convert renders the given markdown, found in the file at path, to HTML.
+func (p *MarkdownPipeline) convert(path string, source []byte) ([]byte, error) {
+	ctx := parser.NewContext()
+	ctx.Set(SourcePathKey, path)
+	output := new(bytes.Buffer)
+	if err := p.Goldmark.Convert(source, output, parser.WithContext(ctx)); err != nil {
+		return nil, err
+	}
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// processHeadings gives every heading a stable id, appends self-link anchors
+// if enabled and collects the headings within the configured levels into a
+// table of contents. Explicit ids are reserved first, so that generated ids
+// never collide with them.
+func (p *MarkdownPipeline) processHeadings(doc ast.Node, source []byte, ctx parser.Context) *TableOfContents {
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := n.(*ast.Heading); ok && entering {
+			if id := headingID(heading); len(id) > 0 {
+				ctx.IDs().Put(id)
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	var headings []*TOCEntry
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		heading, ok := n.(*ast.Heading)
+		if !ok {
+			return ast.WalkContinue, nil
+		}
+
+		title := nodeText(heading, source)
+		id := headingID(heading)
+		if len(id) == 0 {
+			id = ctx.IDs().Generate([]byte(title), ast.KindHeading)
+			heading.SetAttributeString("id", id)
+		}
+
+		if p.HeadingAnchors {
+			anchor := ast.NewLink()
+			anchor.Destination = append([]byte("#"), id...)
+			anchor.SetAttributeString("class", []byte("anchor"))
+			anchor.AppendChild(anchor, ast.NewString([]byte("#")))
+			heading.AppendChild(heading, anchor)
+		}
+
+		if heading.Level >= p.TOCStartLevel && heading.Level <= p.TOCEndLevel {
+			headings = append(headings, &TOCEntry{
+				Level: heading.Level,
+				ID:    string(id),
+				Title: title,
+			})
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	return newTableOfContents(headings)
+}
+
+// headingID returns the explicit id of the heading, if any.
+func headingID(heading *ast.Heading) []byte {
+	if v, ok := heading.AttributeString("id"); ok {
+		if b, ok := v.([]byte); ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// nodeText returns the plain text of the given node and its children.
+func nodeText(n ast.Node, source []byte) string {
+	var b bytes.Buffer
+	_ = ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch t := c.(type) {
+		case *ast.Text:
+			b.Write(t.Segment.Value(source))
+			if t.SoftLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(t.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
+
+// ParseFrontMatter splits the YAML front matter from the content and returns
+// it together with the remaining body.
+func ParseFrontMatter(content []byte) (map[string]interface{}, []byte, error) {
 	var frontMatter map[string]interface{}
 	body := content
 
@@ -8,6 +8,9 @@ type Asset struct {
 	Path     string
 	Content  io.Reader
 	Metadata map[string]interface{}
+	// TableOfContents is the table of contents of a markdown page, set by
+	// the markdown pipeline along with the TableOfContents key of Metadata.
+	TableOfContents *TableOfContents
 }
 
 // Pipeline is an interface for processing assets.
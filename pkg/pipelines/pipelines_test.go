@@ -1,12 +1,14 @@
 package pipelines_test
 
 import (
+	"io"
 	"strings"
 	"testing"
 
 	"github.com/Bitlatte/evoke/pkg/pipelines"
 	"github.com/stretchr/testify/assert"
 	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/renderer/html"
 )
 
@@ -32,6 +34,58 @@ func TestMarkdownPipeline(t *testing.T) {
 	assert.NotNil(t, processedAsset.Content)
 }
 
+func TestMarkdownPipeline_TableOfContents(t *testing.T) {
+	// Arrange
+	pipeline := pipelines.NewMarkdownPipeline(goldmark.New())
+	pipeline.HeadingAnchors = true
+	asset := &pipelines.Asset{
+		Path:    "content/guide.md",
+		Content: strings.NewReader("# Guide\n\n## Install\n\n### From *Source*\n\n## Install\n\n#### Deep\n"),
+	}
+
+	// Act
+	processedAsset, err := pipeline.Process(asset)
+	assert.NoError(t, err)
+
+	// Assert
+	toc := processedAsset.TableOfContents
+	assert.NotNil(t, toc)
+	assert.Same(t, toc, processedAsset.Metadata["TableOfContents"])
+	assert.Len(t, toc.Entries, 2)
+	assert.Equal(t, "install", toc.Entries[0].ID)
+	assert.Equal(t, "install-1", toc.Entries[1].ID)
+	assert.Len(t, toc.Entries[0].Children, 1)
+	assert.Equal(t, "From Source", toc.Entries[0].Children[0].Title)
+	assert.Empty(t, toc.Entries[1].Children)
+	assert.Equal(t, `<nav class="toc"><ul><li><a href="#install">Install</a><ul><li><a href="#from-source">From Source</a></li></ul></li><li><a href="#install-1">Install</a></li></ul></nav>`, string(toc.HTML()))
+
+	buf := new(strings.Builder)
+	_, err = io.Copy(buf, processedAsset.Content)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `<h2 id="install">Install<a href="#install" class="anchor">#</a></h2>`)
+	assert.Contains(t, buf.String(), `<h4 id="deep">`)
+}
+
+func TestMarkdownPipeline_ExplicitHeadingIDs(t *testing.T) {
+	// Arrange
+	pipeline := pipelines.NewMarkdownPipeline(goldmark.New(goldmark.WithParserOptions(parser.WithAttribute())))
+	asset := &pipelines.Asset{
+		Path:    "content/guide.md",
+		Content: strings.NewReader("---\nTableOfContents: mine\n---\n## Install\n\n## Setup {#install}\n"),
+	}
+
+	// Act
+	processedAsset, err := pipeline.Process(asset)
+	assert.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, "mine", processedAsset.Metadata["TableOfContents"])
+	toc := processedAsset.TableOfContents
+	assert.Len(t, toc.Entries, 2)
+	assert.Equal(t, "install-1", toc.Entries[0].ID)
+	assert.Equal(t, "install", toc.Entries[1].ID)
+}
+
 func TestHTMLPipeline(t *testing.T) {
 	// Arrange
 	pipeline := pipelines.NewHTMLPipeline()
@@ -0,0 +1,75 @@
+package pipelines
+
+import (
+	"html"
+	"html/template"
+	"strings"
+)
+
+// TOCEntry is a single heading in a table of contents.
+type TOCEntry struct {
+	// Level is the heading level, from 1 to 6.
+	Level int
+	// ID is the id attribute of the heading.
+	ID string
+	// Title is the plain text of the heading.
+	Title string
+	// Children are the headings nested below this one.
+	Children []*TOCEntry
+}
+
+// TableOfContents is the table of contents of a rendered page. It is exposed
+// to layouts as .Page.TableOfContents, and as .TableOfContents.
+type TableOfContents struct {
+	// Entries are the top level headings of the page.
+	Entries []*TOCEntry
+}
+
+// newTableOfContents nests the given headings by level. A heading becomes a
+// child of the closest preceding heading with a lower level.
+func newTableOfContents(headings []*TOCEntry) *TableOfContents {
+	toc := &TableOfContents{}
+	var stack []*TOCEntry
+	for _, h := range headings {
+		for len(stack) > 0 && stack[len(stack)-1].Level >= h.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			toc.Entries = append(toc.Entries, h)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, h)
+		}
+		stack = append(stack, h)
+	}
+	return toc
+}
+
+// HTML renders the table of contents as a nested list of links.
+func (t *TableOfContents) HTML() template.HTML {
+	if t == nil || len(t.Entries) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(`<nav class="toc">`)
+	writeTOCEntries(&b, t.Entries)
+	b.WriteString("</nav>")
+	return template.HTML(b.String())
+}
+
+// writeTOCEntries writes the given entries and their children as a list.
+func writeTOCEntries(b *strings.Builder, entries []*TOCEntry) {
+	b.WriteString("<ul>")
+	for _, e := range entries {
+		b.WriteString(`<li><a href="#`)
+		b.WriteString(html.EscapeString(e.ID))
+		b.WriteString(`">`)
+		b.WriteString(html.EscapeString(e.Title))
+		b.WriteString("</a>")
+		if len(e.Children) > 0 {
+			writeTOCEntries(b, e.Children)
+		}
+		b.WriteString("</li>")
+	}
+	b.WriteString("</ul>")
+}
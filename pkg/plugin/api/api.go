@@ -0,0 +1,179 @@
+// Package api defines the interfaces evoke plugins written in Go implement.
+// It only depends on the protocol, so that it is shared by the plugins built
+// with the sdk package, the ones compiled to WebAssembly with the wasm
+// package, and the host.
+package api
+
+import (
+	"fmt"
+
+	"github.com/Bitlatte/evoke/proto"
+)
+
+// Plugin is the interface that all evoke plugins must implement. The hooks
+// added later are part of the optional interfaces below.
+type Plugin interface {
+	// Name returns the name of the plugin.
+	Name() string
+	// OnPreBuild is called before the build process starts.
+	OnPreBuild() error
+	// OnConfigLoaded is called after the configuration is loaded.
+	OnConfigLoaded(config []byte) ([]byte, error)
+	// OnPublicAssetsCopied is called after the public assets are copied.
+	OnPublicAssetsCopied() error
+	// OnContentLoaded is called after a content file is loaded.
+	OnContentLoaded(path string, content []byte) ([]byte, error)
+	// OnContentRender is called after a content file is rendered.
+	OnContentRender(path string, content []byte) ([]byte, error)
+	// OnHTMLRendered is called after the HTML is rendered.
+	OnHTMLRendered(path string, content []byte) ([]byte, error)
+	// OnPostBuild is called after the build process is finished.
+	OnPostBuild() error
+	// RegisterPipelines is called to register custom pipelines.
+	RegisterPipelines() ([]*proto.Pipeline, error)
+	// ProcessAsset is called to process an asset with a custom pipeline.
+	ProcessAsset(asset *proto.Asset) (*proto.Asset, error)
+}
+
+// The hooks added after the Plugin interface are implemented through the
+// optional interfaces below, so that plugins written against the Plugin
+// interface keep compiling. The host checks for them with a type assertion
+// and reports the hooks of the ones a plugin implements as its capabilities.
+
+// CapabilitiesProvider can be implemented by a plugin to report the hooks it
+// implements, by the names of the RPCs of the Plugin service. The host skips
+// the RPCs of the other hooks. Plugins that don't implement it report all
+// the hooks of the interfaces they implement.
+type CapabilitiesProvider interface {
+	// Capabilities returns the names of the hooks the plugin implements.
+	Capabilities() []string
+}
+
+// Configurer can be implemented by a plugin to get its settings from
+// evoke.yaml.
+type Configurer interface {
+	// Configure is called with the settings of the plugin, encoded as JSON.
+	Configure(settings []byte) error
+}
+
+// MetadataProvider can be implemented by a plugin to report its name, version
+// and description. Other plugins are named after their executable.
+type MetadataProvider interface {
+	// Metadata returns the metadata of the plugin.
+	Metadata() (*proto.PluginMetadata, error)
+}
+
+// PageGenerator can be implemented by a plugin to add pages that don't exist
+// in the content directory.
+type PageGenerator interface {
+	// GeneratePages returns the pages to add.
+	GeneratePages() ([]*proto.GeneratedPage, error)
+}
+
+// TemplateFuncProvider can be implemented by a plugin to register functions
+// that templates can call.
+type TemplateFuncProvider interface {
+	// RegisterTemplateFunctions returns the functions of the plugin.
+	RegisterTemplateFunctions() ([]*proto.TemplateFunction, error)
+	// CallTemplateFunction is called when a template calls one of them, with
+	// its arguments encoded as a JSON array. It returns its result as JSON.
+	CallTemplateFunction(name string, args []byte) ([]byte, error)
+}
+
+// ContentLoadedHook can be implemented by a plugin to get and change the
+// front matter of a content file along with its content. It is called instead
+// of OnContentLoaded.
+type ContentLoadedHook interface {
+	OnContentLoadedFile(file *proto.ContentFile) (*proto.ContentFile, error)
+}
+
+// ContentRenderHook can be implemented by a plugin to get and change the
+// front matter of a page along with its body before it is rendered. It is
+// called instead of OnContentRender.
+type ContentRenderHook interface {
+	OnContentRenderFile(file *proto.ContentFile) (*proto.ContentFile, error)
+}
+
+// HTMLRenderedHook can be implemented by a plugin to get and change the front
+// matter of a page along with its HTML before it is placed in its layouts. It
+// is called instead of OnHTMLRendered.
+type HTMLRenderedHook interface {
+	OnHTMLRenderedFile(file *proto.ContentFile) (*proto.ContentFile, error)
+}
+
+// Configure passes the settings to the plugin if it implements Configurer.
+func Configure(p Plugin, settings []byte) error {
+	if c, ok := p.(Configurer); ok {
+		return c.Configure(settings)
+	}
+	return nil
+}
+
+// Metadata returns the metadata of the plugin. Plugins that don't implement
+// MetadataProvider are described by their name only.
+func Metadata(p Plugin) (*proto.PluginMetadata, error) {
+	if m, ok := p.(MetadataProvider); ok {
+		return m.Metadata()
+	}
+	return &proto.PluginMetadata{Name: p.Name()}, nil
+}
+
+// GeneratePages returns the pages generated by the plugin, if it implements
+// PageGenerator.
+func GeneratePages(p Plugin) ([]*proto.GeneratedPage, error) {
+	if g, ok := p.(PageGenerator); ok {
+		return g.GeneratePages()
+	}
+	return nil, nil
+}
+
+// ContentLoaded runs the OnContentLoaded hook of the plugin on a content file.
+func ContentLoaded(p Plugin, file *proto.ContentFile) (*proto.ContentFile, error) {
+	if h, ok := p.(ContentLoadedHook); ok {
+		return h.OnContentLoadedFile(file)
+	}
+	return contentHook(file, p.OnContentLoaded)
+}
+
+// ContentRender runs the OnContentRender hook of the plugin on a page.
+func ContentRender(p Plugin, file *proto.ContentFile) (*proto.ContentFile, error) {
+	if h, ok := p.(ContentRenderHook); ok {
+		return h.OnContentRenderFile(file)
+	}
+	return contentHook(file, p.OnContentRender)
+}
+
+// HTMLRendered runs the OnHTMLRendered hook of the plugin on a page.
+func HTMLRendered(p Plugin, file *proto.ContentFile) (*proto.ContentFile, error) {
+	if h, ok := p.(HTMLRenderedHook); ok {
+		return h.OnHTMLRenderedFile(file)
+	}
+	return contentHook(file, p.OnHTMLRendered)
+}
+
+// contentHook runs a hook of the Plugin interface on a file. Such hooks only
+// see the content, so the front matter is left unchanged.
+func contentHook(file *proto.ContentFile, hook func(path string, content []byte) ([]byte, error)) (*proto.ContentFile, error) {
+	content, err := hook(file.Path, file.Content)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.ContentFile{Path: file.Path, Content: content}, nil
+}
+
+// RegisterTemplateFunctions returns the template functions of the plugin, if
+// it implements TemplateFuncProvider.
+func RegisterTemplateFunctions(p Plugin) ([]*proto.TemplateFunction, error) {
+	if f, ok := p.(TemplateFuncProvider); ok {
+		return f.RegisterTemplateFunctions()
+	}
+	return nil, nil
+}
+
+// CallTemplateFunction calls a template function of the plugin.
+func CallTemplateFunction(p Plugin, name string, args []byte) ([]byte, error) {
+	if f, ok := p.(TemplateFuncProvider); ok {
+		return f.CallTemplateFunction(name, args)
+	}
+	return nil, fmt.Errorf("plugin %s does not implement template functions", p.Name())
+}
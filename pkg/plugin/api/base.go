@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Bitlatte/evoke/proto"
+)
+
+// Base provides no-op defaults for every hook of the Plugin interface and
+// the optional interfaces, so that a plugin embedding it only implements the
+// hooks it needs. It also keeps the settings passed to Configure for
+// DecodeSettings.
+//
+// The content hooks of Base only see the content of a file. To also get and
+// change its front matter, a plugin implements the file variant of the hook
+// instead, e.g. OnContentRenderFile of ContentRenderHook.
+type Base struct {
+	settings []byte
+}
+
+// Name returns the name of the plugin. The host names plugins after their
+// metadata, so Base returns an empty name.
+func (b *Base) Name() string { return "" }
+
+// Metadata returns empty metadata. The host then names the plugin after its
+// file.
+func (b *Base) Metadata() (*proto.PluginMetadata, error) {
+	return &proto.PluginMetadata{}, nil
+}
+
+// Configure keeps the settings for DecodeSettings.
+func (b *Base) Configure(settings []byte) error {
+	b.settings = settings
+	return nil
+}
+
+// DecodeSettings decodes the settings of the plugin from evoke.yaml into out,
+// which is typically a pointer to a struct with json tags. Settings missing
+// from evoke.yaml leave out untouched, so defaults can be set beforehand.
+func (b *Base) DecodeSettings(out interface{}) error {
+	if len(b.settings) == 0 {
+		return nil
+	}
+	return json.Unmarshal(b.settings, out)
+}
+
+// OnPreBuild does nothing.
+func (b *Base) OnPreBuild() error { return nil }
+
+// OnConfigLoaded returns the configuration unchanged.
+func (b *Base) OnConfigLoaded(config []byte) ([]byte, error) { return config, nil }
+
+// OnPublicAssetsCopied does nothing.
+func (b *Base) OnPublicAssetsCopied() error { return nil }
+
+// OnContentLoaded returns the content unchanged.
+func (b *Base) OnContentLoaded(path string, content []byte) ([]byte, error) {
+	return content, nil
+}
+
+// OnContentRender returns the content unchanged.
+func (b *Base) OnContentRender(path string, content []byte) ([]byte, error) {
+	return content, nil
+}
+
+// OnHTMLRendered returns the content unchanged.
+func (b *Base) OnHTMLRendered(path string, content []byte) ([]byte, error) {
+	return content, nil
+}
+
+// OnPostBuild does nothing.
+func (b *Base) OnPostBuild() error { return nil }
+
+// RegisterPipelines registers no pipelines.
+func (b *Base) RegisterPipelines() ([]*proto.Pipeline, error) { return nil, nil }
+
+// ProcessAsset returns the asset unchanged.
+func (b *Base) ProcessAsset(asset *proto.Asset) (*proto.Asset, error) { return asset, nil }
+
+// GeneratePages generates no pages.
+func (b *Base) GeneratePages() ([]*proto.GeneratedPage, error) { return nil, nil }
+
+// RegisterTemplateFunctions registers no template functions.
+func (b *Base) RegisterTemplateFunctions() ([]*proto.TemplateFunction, error) {
+	return nil, nil
+}
+
+// CallTemplateFunction fails, as Base registers no template functions.
+func (b *Base) CallTemplateFunction(name string, args []byte) ([]byte, error) {
+	return nil, fmt.Errorf("unknown template function %s", name)
+}
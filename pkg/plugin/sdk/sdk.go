@@ -0,0 +1,86 @@
+// Package sdk helps writing evoke plugins in Go.
+//
+// A plugin embeds Base, overrides the hooks it needs and calls Serve from its
+// main function:
+//
+//	type Greeter struct {
+//		sdk.Base
+//	}
+//
+//	func (g *Greeter) Metadata() (*proto.PluginMetadata, error) {
+//		return &proto.PluginMetadata{Name: "greeter", Version: "1.0.0"}, nil
+//	}
+//
+//	func (g *Greeter) OnPreBuild() error {
+//		sdk.Logger().Info("Hello from the greeter plugin")
+//		return nil
+//	}
+//
+//	func main() {
+//		sdk.Serve(&Greeter{})
+//	}
+package sdk
+
+import (
+	"os"
+
+	"github.com/Bitlatte/evoke/pkg/plugin/api"
+	"github.com/Bitlatte/evoke/pkg/plugins"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin"
+)
+
+// Plugin is the interface a plugin served by Serve implements.
+type Plugin = plugins.Plugin
+
+// Base provides no-op defaults for every hook of the Plugin interface and
+// the optional interfaces of the api package, so that a plugin embedding it
+// only implements the hooks it needs. It also keeps the settings passed to
+// Configure for DecodeSettings and the host the plugin is connected to.
+//
+// The content hooks of Base only see the content of a file. To also get and
+// change its front matter, a plugin implements the file variant of the hook
+// instead, e.g. OnContentRenderFile of plugins.ContentRenderHook.
+type Base struct {
+	api.Base
+	host plugins.Host
+}
+
+// SetHost keeps the host for Host.
+func (b *Base) SetHost(host plugins.Host) { b.host = host }
+
+// Host returns the host the plugin is connected to, which gives access to
+// the site being built. It is nil until the plugin is started, and when the
+// host doesn't support it.
+func (b *Base) Host() plugins.Host { return b.host }
+
+// logger writes JSON to stderr, which the host parses and forwards to its own
+// logger at the same level.
+var logger = hclog.New(&hclog.LoggerOptions{
+	Level:      hclog.Trace,
+	Output:     os.Stderr,
+	JSONFormat: true,
+})
+
+// Logger returns the logger plugins should log with. Its messages are shown
+// by evoke along with its own.
+func Logger() hclog.Logger {
+	return logger
+}
+
+// Serve serves the plugin to evoke. It is meant to be called from the main
+// function of the plugin and doesn't return.
+//
+// Plugins embedding Base implement every hook, so the host calls all of them.
+// Implement plugins.CapabilitiesProvider to list the hooks the plugin
+// actually uses and spare the host the other calls.
+func Serve(p Plugin) {
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig: plugins.Handshake,
+		Plugins: map[string]plugin.Plugin{
+			"evoke": &plugins.EvokePlugin{Impl: p},
+		},
+		GRPCServer: plugin.DefaultGRPCServer,
+		Logger:     logger,
+	})
+}
@@ -0,0 +1,146 @@
+package sdk_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Bitlatte/evoke/pkg/plugin/sdk"
+	"github.com/Bitlatte/evoke/pkg/plugin/sdk/sdktest"
+	"github.com/Bitlatte/evoke/pkg/plugins"
+	"github.com/Bitlatte/evoke/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type settings struct {
+	Prefix string `json:"prefix"`
+	Count  int    `json:"count"`
+}
+
+type prefixPlugin struct {
+	sdk.Base
+	settings settings
+}
+
+func (p *prefixPlugin) Metadata() (*proto.PluginMetadata, error) {
+	return &proto.PluginMetadata{Name: "prefix", Version: "1.0.0"}, nil
+}
+
+func (p *prefixPlugin) Configure(raw []byte) error {
+	if err := p.Base.Configure(raw); err != nil {
+		return err
+	}
+	p.settings = settings{Prefix: "default"}
+	return p.DecodeSettings(&p.settings)
+}
+
+func (p *prefixPlugin) OnContentLoaded(path string, content []byte) ([]byte, error) {
+	return append([]byte(p.settings.Prefix+":"), content...), nil
+}
+
+func (p *prefixPlugin) Capabilities() []string {
+	return []string{plugins.HookGetMetadata, plugins.HookConfigure, plugins.HookOnContentLoaded}
+}
+
+func TestBase(t *testing.T) {
+	b := &sdk.Base{}
+	var p sdk.Plugin = b
+
+	config, err := p.OnConfigLoaded([]byte(`{"title":"Site"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"title":"Site"}`, string(config))
+
+	content, err := p.OnHTMLRendered("index.html", []byte("<p>Hi</p>"))
+	require.NoError(t, err)
+	assert.Equal(t, "<p>Hi</p>", string(content))
+
+	// Base leaves the file variants of the content hooks to the plugin, so
+	// that the content hooks it overrides are called
+	_, ok := p.(plugins.HTMLRenderedHook)
+	assert.False(t, ok)
+
+	pages, err := b.GeneratePages()
+	require.NoError(t, err)
+	assert.Empty(t, pages)
+
+	_, err = b.CallTemplateFunction("missing", []byte("[]"))
+	assert.Error(t, err)
+}
+
+func TestStart(t *testing.T) {
+	host := sdktest.Start(t, &prefixPlugin{}, map[string]interface{}{"prefix": "hello"})
+
+	metadata, err := host.Metadata()
+	require.NoError(t, err)
+	assert.Equal(t, "prefix", metadata.Name)
+
+	content, err := host.OnContentLoaded("index.md", []byte("world"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello:world", string(content))
+
+	// Hooks left out of the capabilities are skipped by the host.
+	content, err = host.OnContentRender("index.md", []byte("world"))
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(content))
+}
+
+func TestStart_DefaultSettings(t *testing.T) {
+	host := sdktest.Start(t, &prefixPlugin{}, nil)
+
+	content, err := host.OnContentLoaded("index.md", []byte("world"))
+	require.NoError(t, err)
+	assert.Equal(t, "default:world", string(content))
+}
+
+// linkPlugin reports links to pages that don't exist.
+type linkPlugin struct {
+	sdk.Base
+}
+
+func (p *linkPlugin) OnContentLoaded(path string, content []byte) ([]byte, error) {
+	target := strings.TrimSpace(string(content))
+	url, err := p.Host().ResolveURL(target)
+	if err != nil {
+		return content, p.Host().AddDiagnostic(&proto.Diagnostic{
+			Severity: "error",
+			Message:  "broken link to " + target,
+			Path:     path,
+		})
+	}
+	return []byte(url), nil
+}
+
+func TestHost(t *testing.T) {
+	site := &sdktest.Site{
+		Config: map[string]interface{}{"title": "Site"},
+		Pages: []*proto.Page{
+			{Path: "content/about.md", Url: "/about.html", Title: "About"},
+		},
+	}
+	p := &linkPlugin{}
+	host := sdktest.StartWithSite(t, p, nil, site)
+	require.NotNil(t, p.Host())
+
+	content, err := host.OnContentLoaded("content/index.md", []byte("about.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "/about.html", string(content))
+
+	_, err = host.OnContentLoaded("content/index.md", []byte("missing.md"))
+	require.NoError(t, err)
+	diagnostics := site.Diagnostics()
+	require.Len(t, diagnostics, 1)
+	assert.Equal(t, "error", diagnostics[0].Severity)
+	assert.Equal(t, "content/index.md", diagnostics[0].Path)
+
+	config, err := p.Host().GetConfig()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"title":"Site"}`, string(config))
+
+	pages, err := p.Host().ListPages()
+	require.NoError(t, err)
+	require.Len(t, pages, 1)
+	assert.Equal(t, "About", pages[0].Title)
+
+	assert.NoError(t, p.Host().Log("info", "hello"))
+	assert.Error(t, p.Host().Log("loud", "hello"))
+}
@@ -0,0 +1,116 @@
+// Package sdktest runs evoke plugins against an in-process host, so that
+// plugin authors can test them without building a binary.
+package sdktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Bitlatte/evoke/pkg/plugins"
+	"github.com/Bitlatte/evoke/proto"
+	"github.com/hashicorp/go-plugin"
+)
+
+// Site is a site served to the plugin under test. It records the
+// diagnostics reported by the plugin.
+type Site struct {
+	// Config is the configuration of the site.
+	Config map[string]interface{}
+	// Pages are the published pages of the site.
+	Pages []*proto.Page
+
+	mu          sync.Mutex
+	diagnostics []*proto.Diagnostic
+}
+
+// Diagnostics returns the diagnostics reported by the plugin so far.
+func (s *Site) Diagnostics() []*proto.Diagnostic {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*proto.Diagnostic(nil), s.diagnostics...)
+}
+
+// site implements plugins.Site for a Site.
+type site struct {
+	*Site
+}
+
+// Page returns the page with the given source path.
+func (s site) Page(path string) (*proto.Page, error) {
+	for _, p := range s.Site.Pages {
+		if p.Path == path || p.Path == "content/"+path {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("page %s not found", path)
+}
+
+// Pages returns the pages of the site.
+func (s site) Pages() ([]*proto.Page, error) {
+	return s.Site.Pages, nil
+}
+
+// Config returns the configuration as a JSON object.
+func (s site) Config() ([]byte, error) {
+	if s.Site.Config == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(s.Site.Config)
+}
+
+// AddDiagnostic records the diagnostic.
+func (s site) AddDiagnostic(diagnostic *proto.Diagnostic) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.diagnostics = append(s.diagnostics, diagnostic)
+}
+
+// Start serves the plugin over an in-process gRPC connection and returns the
+// host's client for it, set up the way evoke sets up a plugin it loads: its
+// capabilities are negotiated, it is connected to an empty site and it is
+// configured with the given settings. The connection is closed when the test
+// finishes.
+func Start(t testing.TB, p plugins.Plugin, settings map[string]interface{}) *plugins.EvokeGRPCClient {
+	t.Helper()
+	return StartWithSite(t, p, settings, &Site{})
+}
+
+// StartWithSite is like Start, but serves the given site to the plugin.
+func StartWithSite(t testing.TB, p plugins.Plugin, settings map[string]interface{}, s *Site) *plugins.EvokeGRPCClient {
+	t.Helper()
+
+	client, server := plugin.TestPluginGRPCConn(t, false, map[string]plugin.Plugin{
+		"evoke": &plugins.EvokePlugin{Impl: p},
+	})
+	t.Cleanup(func() {
+		client.Close()
+		server.Stop()
+	})
+
+	raw, err := client.Dispense("evoke")
+	if err != nil {
+		t.Fatalf("error dispensing plugin: %s", err)
+	}
+	host := raw.(*plugins.EvokeGRPCClient)
+
+	if err := host.LoadCapabilities(plugins.ProtocolVersion); err != nil {
+		t.Fatalf("error getting capabilities: %s", err)
+	}
+	if err := host.ConnectHost(site{s}); err != nil {
+		t.Fatalf("error connecting to host: %s", err)
+	}
+
+	if settings == nil {
+		settings = make(map[string]interface{})
+	}
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		t.Fatalf("error encoding settings: %s", err)
+	}
+	if err := host.Configure(encoded); err != nil {
+		t.Fatalf("error configuring plugin: %s", err)
+	}
+	return host
+}
@@ -0,0 +1,126 @@
+package wasm
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Bitlatte/evoke/pkg/plugin/api"
+	"github.com/Bitlatte/evoke/proto"
+)
+
+// server implements the Plugin service on top of a Plugin.
+type server struct {
+	impl Plugin
+	proto.UnimplementedPluginServer
+}
+
+// GetCapabilities reports the hooks the plugin implements. WebAssembly
+// plugins handle one call at a time and don't implement the batched hooks.
+func (s *server) GetCapabilities(ctx context.Context, req *proto.GetCapabilitiesRequest) (*proto.GetCapabilitiesResponse, error) {
+	reported := append([]string(nil), hooks...)
+	for hook, implemented := range optionalHooks {
+		if implemented(s.impl) {
+			reported = append(reported, hook)
+		}
+	}
+	sort.Strings(reported)
+	if p, ok := s.impl.(CapabilitiesProvider); ok {
+		reported = p.Capabilities()
+	}
+	return &proto.GetCapabilitiesResponse{Hooks: reported}, nil
+}
+
+// GetMetadata returns the name, version and description of the plugin.
+func (s *server) GetMetadata(ctx context.Context, req *proto.GetMetadataRequest) (*proto.PluginMetadata, error) {
+	return api.Metadata(s.impl)
+}
+
+// Configure is called with the settings of the plugin from evoke.yaml.
+func (s *server) Configure(ctx context.Context, req *proto.ConfigureRequest) (*proto.ConfigureResponse, error) {
+	return &proto.ConfigureResponse{}, api.Configure(s.impl, []byte(req.SettingsJson))
+}
+
+// OnPreBuild is called before the build process starts.
+func (s *server) OnPreBuild(ctx context.Context, req *proto.PreBuildRequest) (*proto.PreBuildResponse, error) {
+	return &proto.PreBuildResponse{}, s.impl.OnPreBuild()
+}
+
+// OnConfigLoaded is called after the configuration is loaded.
+func (s *server) OnConfigLoaded(ctx context.Context, req *proto.ConfigLoadedRequest) (*proto.ConfigLoadedResponse, error) {
+	config, err := s.impl.OnConfigLoaded([]byte(req.ConfigJson))
+	if err != nil {
+		return nil, err
+	}
+	return &proto.ConfigLoadedResponse{ConfigJson: string(config)}, nil
+}
+
+// OnPublicAssetsCopied is called after the public assets are copied.
+func (s *server) OnPublicAssetsCopied(ctx context.Context, req *proto.PublicAssetsCopiedRequest) (*proto.PublicAssetsCopiedResponse, error) {
+	return &proto.PublicAssetsCopiedResponse{}, s.impl.OnPublicAssetsCopied()
+}
+
+// OnContentLoaded is called after a content file is loaded.
+func (s *server) OnContentLoaded(ctx context.Context, req *proto.ContentFile) (*proto.ContentFile, error) {
+	return api.ContentLoaded(s.impl, req)
+}
+
+// OnContentRender is called before a page is rendered, with its body and
+// front matter.
+func (s *server) OnContentRender(ctx context.Context, req *proto.ContentFile) (*proto.ContentFile, error) {
+	return api.ContentRender(s.impl, req)
+}
+
+// OnHTMLRendered is called after a page is rendered to HTML, before it is
+// placed in its layouts.
+func (s *server) OnHTMLRendered(ctx context.Context, req *proto.ContentFile) (*proto.ContentFile, error) {
+	return api.HTMLRendered(s.impl, req)
+}
+
+// OnPostBuild is called after the build process is finished.
+func (s *server) OnPostBuild(ctx context.Context, req *proto.PostBuildRequest) (*proto.PostBuildResponse, error) {
+	return &proto.PostBuildResponse{}, s.impl.OnPostBuild()
+}
+
+// RegisterPipelines is called to register custom pipelines.
+func (s *server) RegisterPipelines(ctx context.Context, req *proto.RegisterPipelinesRequest) (*proto.RegisterPipelinesResponse, error) {
+	pipelines, err := s.impl.RegisterPipelines()
+	if err != nil {
+		return nil, err
+	}
+	return &proto.RegisterPipelinesResponse{Pipelines: pipelines}, nil
+}
+
+// ProcessAsset is called to process an asset with a custom pipeline.
+func (s *server) ProcessAsset(ctx context.Context, req *proto.Asset) (*proto.Asset, error) {
+	return s.impl.ProcessAsset(req)
+}
+
+// GeneratePages is called to add pages that don't exist in the content
+// directory.
+func (s *server) GeneratePages(ctx context.Context, req *proto.GeneratePagesRequest) (*proto.GeneratePagesResponse, error) {
+	pages, err := api.GeneratePages(s.impl)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.GeneratePagesResponse{Pages: pages}, nil
+}
+
+// RegisterTemplateFunctions is called to register functions that templates
+// can call.
+func (s *server) RegisterTemplateFunctions(ctx context.Context, req *proto.RegisterTemplateFunctionsRequest) (*proto.RegisterTemplateFunctionsResponse, error) {
+	functions, err := api.RegisterTemplateFunctions(s.impl)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.RegisterTemplateFunctionsResponse{Functions: functions}, nil
+}
+
+// CallTemplateFunction is called when a template calls a function registered
+// by the plugin.
+func (s *server) CallTemplateFunction(ctx context.Context, req *proto.CallTemplateFunctionRequest) (*proto.CallTemplateFunctionResponse, error) {
+	result, err := api.CallTemplateFunction(s.impl, req.Name, []byte(req.ArgumentsJson))
+	if err != nil {
+		return nil, err
+	}
+	return &proto.CallTemplateFunctionResponse{ResultJson: string(result)}, nil
+}
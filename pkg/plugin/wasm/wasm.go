@@ -0,0 +1,176 @@
+// Package wasm helps writing evoke plugins in Go that compile to WebAssembly.
+//
+// WebAssembly plugins run inside evoke instead of in their own process, so
+// the same module runs on every platform. They only see their working
+// directory, mounted as their root directory: a temporary directory of their
+// own unless their sandbox sets one, read-only unless their sandbox makes it
+// writable. They have no access to the network, nor to the environment
+// besides the variables allowed by their sandbox.
+//
+// A plugin embeds Base, overrides the hooks it needs and calls Serve from its
+// main function, like a plugin written with the sdk package:
+//
+//	type Greeter struct {
+//		wasm.Base
+//	}
+//
+//	func (g *Greeter) OnPreBuild() error {
+//		fmt.Fprintln(os.Stderr, "Hello from the greeter plugin")
+//		return nil
+//	}
+//
+//	func main() {
+//		wasm.Serve(&Greeter{})
+//	}
+//
+// It is then built for WASI and placed in the plugins directory:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -o plugins/greeter.wasm .
+package wasm
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Bitlatte/evoke/pkg/plugin/api"
+	"github.com/Bitlatte/evoke/proto"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// Plugin is the interface a plugin served by Serve implements. It is the
+// interface of the plugins built with the sdk package, and the hooks of the
+// optional interfaces of the api package are called the same way.
+type Plugin = api.Plugin
+
+// CapabilitiesProvider can be implemented by a plugin to report the hooks it
+// implements, by the names of the RPCs of the Plugin service. The host
+// doesn't call the other hooks.
+type CapabilitiesProvider = api.CapabilitiesProvider
+
+// Base provides no-op defaults for every hook, like the Base of the sdk
+// package. WebAssembly plugins can't reach the host services, so it has no
+// Host method.
+type Base = api.Base
+
+// hooks are the hooks of the Plugin interface, reported for plugins that
+// don't implement CapabilitiesProvider.
+var hooks = []string{
+	"OnPreBuild",
+	"OnConfigLoaded",
+	"OnPublicAssetsCopied",
+	"OnContentLoaded",
+	"OnContentRender",
+	"OnHTMLRendered",
+	"OnPostBuild",
+	"RegisterPipelines",
+	"ProcessAsset",
+}
+
+// optionalHooks report whether a plugin implements the optional interface of
+// a hook.
+var optionalHooks = map[string]func(Plugin) bool{
+	"GetMetadata":               implements[api.MetadataProvider],
+	"Configure":                 implements[api.Configurer],
+	"GeneratePages":             implements[api.PageGenerator],
+	"RegisterTemplateFunctions": implements[api.TemplateFuncProvider],
+	"CallTemplateFunction":      implements[api.TemplateFuncProvider],
+}
+
+// implements reports whether the plugin implements the interface T.
+func implements[T any](p Plugin) bool {
+	_, ok := p.(T)
+	return ok
+}
+
+// Serve serves the plugin to evoke. It is meant to be called from the main
+// function of the plugin, and returns when evoke stops the plugin.
+//
+// Calls are read from stdin and responses written to stdout, so the plugin
+// must not write to stdout itself. What it writes to stderr is shown by evoke
+// along with its own messages.
+func Serve(p Plugin) {
+	if err := serve(p, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// serve answers the calls read from r until it's closed.
+func serve(p Plugin, r io.Reader, w io.Writer) error {
+	in := bufio.NewReader(r)
+	srv := &server{impl: p}
+	for {
+		frame, err := readFrame(in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading call: %w", err)
+		}
+
+		var req proto.WasmRequest
+		if err := protobuf.Unmarshal(frame, &req); err != nil {
+			return fmt.Errorf("error decoding call: %w", err)
+		}
+		resp := srv.call(&req)
+		out, err := protobuf.Marshal(resp)
+		if err != nil {
+			return fmt.Errorf("error encoding response: %w", err)
+		}
+		if err := writeFrame(w, out); err != nil {
+			return fmt.Errorf("error writing response: %w", err)
+		}
+	}
+}
+
+// call runs the RPC of the Plugin service named by the request, through the
+// handler generated for gRPC.
+func (s *server) call(req *proto.WasmRequest) *proto.WasmResponse {
+	for _, method := range proto.Plugin_ServiceDesc.Methods {
+		if method.MethodName != req.Method {
+			continue
+		}
+		decode := func(in interface{}) error {
+			return protobuf.Unmarshal(req.Payload, in.(protobuf.Message))
+		}
+		out, err := method.Handler(s, context.Background(), decode, nil)
+		if err != nil {
+			return &proto.WasmResponse{Error: err.Error()}
+		}
+		payload, err := protobuf.Marshal(out.(protobuf.Message))
+		if err != nil {
+			return &proto.WasmResponse{Error: err.Error()}
+		}
+		return &proto.WasmResponse{Payload: payload}
+	}
+	return &proto.WasmResponse{Error: fmt.Sprintf("unknown method %s", req.Method)}
+}
+
+// writeFrame writes a message preceded by its length.
+func writeFrame(w io.Writer, msg []byte) error {
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(msg)))
+	if _, err := w.Write(size[:]); err != nil || len(msg) == 0 {
+		// An empty write would wait on a pipe for a read that never comes
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+// readFrame reads a message preceded by its length.
+func readFrame(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.LittleEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,108 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// maxBatchLen is the maximum number of files sent in one batch.
+	maxBatchLen = 64
+	// maxBatchSize is the size of the content after which no more files are
+	// added to a batch, to stay well below the gRPC message size limit.
+	maxBatchSize = 1 << 20
+)
+
+// batchCall is a call waiting to be sent in a batch.
+type batchCall[T any] struct {
+	in   T
+	out  T
+	err  error
+	done chan struct{}
+}
+
+// batcher groups the calls made to a hook by concurrent workers into
+// batches. A worker sends the calls waiting when it gets its turn to call the
+// plugin, so calls pile up into a batch while the plugin processes the
+// previous one.
+type batcher[T any] struct {
+	client  *EvokeGRPCClient
+	pending chan *batchCall[T]
+	// size returns the size of the content of a call.
+	size func(T) int
+	// send sends a batch and returns the results and the error of each call.
+	send func([]T) ([]T, []string, error)
+}
+
+// newBatcher creates a batcher for the plugin.
+func newBatcher[T any](client *EvokeGRPCClient, size func(T) int, send func([]T) ([]T, []string, error)) *batcher[T] {
+	return &batcher[T]{
+		client:  client,
+		pending: make(chan *batchCall[T], 1024),
+		size:    size,
+		send:    send,
+	}
+}
+
+// do makes a call as part of a batch.
+func (b *batcher[T]) do(in T) (T, error) {
+	c := &batchCall[T]{in: in, done: make(chan struct{})}
+	b.pending <- c
+	for {
+		b.client.acquire()
+		select {
+		case <-c.done:
+			b.client.release()
+			return c.out, c.err
+		default:
+		}
+		sent := b.flush()
+		b.client.release()
+		if sent == 0 {
+			// The call is part of a batch sent by another worker
+			<-c.done
+			return c.out, c.err
+		}
+	}
+}
+
+// flush sends the calls waiting, up to the size of a batch, and returns the
+// number of calls sent.
+func (b *batcher[T]) flush() int {
+	var calls []*batchCall[T]
+	size := 0
+take:
+	for len(calls) < maxBatchLen && size < maxBatchSize {
+		select {
+		case c := <-b.pending:
+			calls = append(calls, c)
+			size += b.size(c.in)
+		default:
+			break take
+		}
+	}
+	if len(calls) == 0 {
+		return 0
+	}
+
+	in := make([]T, len(calls))
+	for i, c := range calls {
+		in[i] = c.in
+	}
+	out, errs, err := b.send(in)
+	if err == nil && (len(out) != len(calls) || len(errs) != len(calls)) {
+		err = fmt.Errorf("plugin %s returned %d results for a batch of %d", b.client.name, len(out), len(calls))
+	}
+	for i, c := range calls {
+		switch {
+		case err != nil:
+			c.err = err
+		case errs[i] != "":
+			c.err = errors.New(errs[i])
+		default:
+			c.out = out[i]
+		}
+		close(c.done)
+	}
+	return len(calls)
+}
@@ -0,0 +1,78 @@
+package plugins
+
+import "github.com/Bitlatte/evoke/pkg/plugin/api"
+
+// The names of the hooks a plugin can implement. They match the names of the
+// RPCs of the Plugin service.
+const (
+	HookGetMetadata               = "GetMetadata"
+	HookConfigure                 = "Configure"
+	HookConnectHost               = "ConnectHost"
+	HookOnPreBuild                = "OnPreBuild"
+	HookOnConfigLoaded            = "OnConfigLoaded"
+	HookOnPublicAssetsCopied      = "OnPublicAssetsCopied"
+	HookOnContentLoaded           = "OnContentLoaded"
+	HookOnContentRender           = "OnContentRender"
+	HookOnHTMLRendered            = "OnHTMLRendered"
+	HookOnPostBuild               = "OnPostBuild"
+	HookRegisterPipelines         = "RegisterPipelines"
+	HookProcessAsset              = "ProcessAsset"
+	HookGeneratePages             = "GeneratePages"
+	HookRegisterTemplateFunctions = "RegisterTemplateFunctions"
+	HookCallTemplateFunction      = "CallTemplateFunction"
+	HookOnContentLoadedBatch      = "OnContentLoadedBatch"
+	HookOnContentRenderBatch      = "OnContentRenderBatch"
+	HookOnHTMLRenderedBatch       = "OnHTMLRenderedBatch"
+	HookProcessAssetBatch         = "ProcessAssetBatch"
+)
+
+// batchHooks are the batched variants of the hooks. A plugin implementing a
+// hook implements its batched variant.
+var batchHooks = map[string]string{
+	HookOnContentLoaded: HookOnContentLoadedBatch,
+	HookOnContentRender: HookOnContentRenderBatch,
+	HookOnHTMLRendered:  HookOnHTMLRenderedBatch,
+	HookProcessAsset:    HookProcessAssetBatch,
+}
+
+// legacyHooks are the hooks of protocol version 1. Plugins speaking it can't
+// report their capabilities, so they are assumed to implement all of them.
+var legacyHooks = []string{
+	HookOnPreBuild,
+	HookOnConfigLoaded,
+	HookOnPublicAssetsCopied,
+	HookOnContentLoaded,
+	HookOnContentRender,
+	HookOnHTMLRendered,
+	HookOnPostBuild,
+	HookRegisterPipelines,
+	HookProcessAsset,
+}
+
+// AllHooks are the hooks of the current protocol version.
+var AllHooks = append(append([]string{}, legacyHooks...),
+	HookGetMetadata,
+	HookConfigure,
+	HookConnectHost,
+	HookGeneratePages,
+	HookRegisterTemplateFunctions,
+	HookCallTemplateFunction,
+	HookOnContentLoadedBatch,
+	HookOnContentRenderBatch,
+	HookOnHTMLRenderedBatch,
+	HookProcessAssetBatch,
+)
+
+// CapabilitiesProvider can be implemented by a plugin to report the hooks it
+// implements. The host skips the RPCs of the other hooks. Plugins that don't
+// implement it report all hooks of the interfaces they implement.
+type CapabilitiesProvider = api.CapabilitiesProvider
+
+// ConcurrencyProvider can be implemented by a plugin to report that it can
+// handle several calls at the same time, e.g. content hooks for different
+// files. The host then calls it from all its workers in parallel. Other
+// plugins get one call at a time.
+type ConcurrencyProvider interface {
+	// ConcurrencySafe reports whether the plugin is concurrency safe.
+	ConcurrencySafe() bool
+}
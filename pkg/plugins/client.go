@@ -2,19 +2,27 @@ package plugins
 
 import (
 	"context"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"fmt"
+	"runtime"
 
+	"github.com/Bitlatte/evoke/pkg/plugin/api"
 	"github.com/Bitlatte/evoke/proto"
-	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-plugin"
 	"google.golang.org/grpc"
 )
 
-// Handshake is a common handshake that is shared by plugin and host.
+// ProtocolVersion is the current version of the plugin protocol. Version 2
+// added GetCapabilities, GetMetadata, Configure, GeneratePages and the
+// template function hooks.
+const ProtocolVersion = 2
+
+// SupportedProtocolVersions are the protocol versions the host can talk to.
+var SupportedProtocolVersions = []int{1, 2}
+
+// Handshake is a common handshake that is shared by plugin and host. Plugins
+// served with it speak the current protocol version.
 var Handshake = plugin.HandshakeConfig{
-	ProtocolVersion:  1,
+	ProtocolVersion:  ProtocolVersion,
 	MagicCookieKey:   "EVOKE_PLUGIN",
 	MagicCookieValue: "1.0",
 }
@@ -24,6 +32,13 @@ var PluginMap = map[string]plugin.Plugin{
 	"evoke": &EvokePlugin{},
 }
 
+// VersionedPlugins are the plugins we can dispense for each supported
+// protocol version. The newest version both sides support is used.
+var VersionedPlugins = map[int]plugin.PluginSet{
+	1: PluginMap,
+	2: PluginMap,
+}
+
 // EvokePlugin is the implementation of plugin.Plugin so we can serve/consume plugins.
 type EvokePlugin struct {
 	plugin.Plugin
@@ -33,43 +48,43 @@ type EvokePlugin struct {
 
 // GRPCServer registers the plugin with the gRPC server.
 func (p *EvokePlugin) GRPCServer(broker *plugin.GRPCBroker, s *grpc.Server) error {
-	proto.RegisterPluginServer(s, &GRPCServer{Impl: p.Impl})
+	proto.RegisterPluginServer(s, &GRPCServer{Impl: p.Impl, broker: broker})
 	return nil
 }
 
 // GRPCClient returns the gRPC client for the plugin.
 func (p *EvokePlugin) GRPCClient(ctx context.Context, broker *plugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
-	return &EvokeGRPCClient{Client: proto.NewPluginClient(c)}, nil
-}
-
-// Plugin is the interface that all evoke plugins must implement.
-type Plugin interface {
-	// Name returns the name of the plugin.
-	Name() string
-	// OnPreBuild is called before the build process starts.
-	OnPreBuild() error
-	// OnConfigLoaded is called after the configuration is loaded.
-	OnConfigLoaded(config []byte) ([]byte, error)
-	// OnPublicAssetsCopied is called after the public assets are copied.
-	OnPublicAssetsCopied() error
-	// OnContentLoaded is called after a content file is loaded.
-	OnContentLoaded(path string, content []byte) ([]byte, error)
-	// OnContentRender is called after a content file is rendered.
-	OnContentRender(path string, content []byte) ([]byte, error)
-	// OnHTMLRendered is called after the HTML is rendered.
-	OnHTMLRendered(path string, content []byte) ([]byte, error)
-	// OnPostBuild is called after the build process is finished.
-	OnPostBuild() error
-	// RegisterPipelines is called to register custom pipelines.
-	RegisterPipelines() ([]*proto.Pipeline, error)
-	// ProcessAsset is called to process an asset with a custom pipeline.
-	ProcessAsset(asset *proto.Asset) (*proto.Asset, error)
+	return &EvokeGRPCClient{Client: proto.NewPluginClient(c), broker: broker}, nil
 }
 
+// Plugin is the interface that all evoke plugins must implement. It is
+// defined in the api package, along with the optional interfaces of the hooks
+// added later.
+type Plugin = api.Plugin
+
 // EvokeGRPCClient is an implementation of Plugin that talks over RPC.
 type EvokeGRPCClient struct {
 	Client proto.PluginClient
 	name   string
+	// version is the negotiated protocol version.
+	version int
+	// hooks are the hooks the plugin implements. Nil means all hooks.
+	hooks map[string]bool
+	// metadata is the metadata reported by the plugin.
+	metadata *proto.PluginMetadata
+	// broker serves the Host service to the plugin.
+	broker *plugin.GRPCBroker
+	// concurrencySafe reports whether the plugin can handle several calls at
+	// the same time.
+	concurrencySafe bool
+	// slots limits the number of calls made to the plugin at the same time.
+	// Nil means no limit.
+	slots chan struct{}
+	// The batchers of the hooks the plugin implements batched variants of.
+	contentLoaded *batcher[*proto.ContentFile]
+	contentRender *batcher[*proto.ContentFile]
+	htmlRendered  *batcher[*proto.ContentFile]
+	assets        *batcher[*proto.Asset]
 }
 
 // Name returns the name of the plugin.
@@ -77,14 +92,137 @@ func (m *EvokeGRPCClient) Name() string {
 	return m.name
 }
 
+// ProtocolVersion returns the protocol version negotiated with the plugin.
+func (m *EvokeGRPCClient) ProtocolVersion() int {
+	return m.version
+}
+
+// Implements reports whether the plugin implements the hook.
+func (m *EvokeGRPCClient) Implements(hook string) bool {
+	return m.hooks == nil || m.hooks[hook]
+}
+
+// ConcurrencySafe reports whether the plugin can handle several calls at the
+// same time.
+func (m *EvokeGRPCClient) ConcurrencySafe() bool {
+	return m.concurrencySafe
+}
+
+// LoadCapabilities records the hooks implemented by a plugin speaking the
+// given protocol version and whether it is concurrency safe.
+func (m *EvokeGRPCClient) LoadCapabilities(version int) error {
+	m.version = version
+	hooks := legacyHooks
+	m.concurrencySafe = false
+	if version >= 2 {
+		resp, err := m.Client.GetCapabilities(context.Background(), &proto.GetCapabilitiesRequest{})
+		if err != nil {
+			return err
+		}
+		hooks = resp.Hooks
+		m.concurrencySafe = resp.ConcurrencySafe
+	}
+
+	m.hooks = make(map[string]bool, len(hooks))
+	for _, hook := range hooks {
+		m.hooks[hook] = true
+	}
+
+	// Calls to plugins that aren't concurrency safe are made one at a time
+	m.slots = make(chan struct{}, 1)
+	if m.concurrencySafe {
+		m.slots = make(chan struct{}, runtime.NumCPU())
+	}
+
+	m.contentLoaded, m.contentRender, m.htmlRendered, m.assets = nil, nil, nil, nil
+	if m.hooks[HookOnContentLoadedBatch] {
+		m.contentLoaded = newBatcher(m, contentFileSize, m.contentFileBatch(m.Client.OnContentLoadedBatch))
+	}
+	if m.hooks[HookOnContentRenderBatch] {
+		m.contentRender = newBatcher(m, contentFileSize, m.contentFileBatch(m.Client.OnContentRenderBatch))
+	}
+	if m.hooks[HookOnHTMLRenderedBatch] {
+		m.htmlRendered = newBatcher(m, contentFileSize, m.contentFileBatch(m.Client.OnHTMLRenderedBatch))
+	}
+	if m.hooks[HookProcessAssetBatch] {
+		m.assets = newBatcher(m, assetSize, m.assetBatch)
+	}
+	return nil
+}
+
+// acquire waits until the plugin can take another call.
+func (m *EvokeGRPCClient) acquire() {
+	if m.slots != nil {
+		m.slots <- struct{}{}
+	}
+}
+
+// release signals that a call to the plugin is done.
+func (m *EvokeGRPCClient) release() {
+	if m.slots != nil {
+		<-m.slots
+	}
+}
+
+// contentFileBatch returns a function sending a batch of content files with
+// the given RPC.
+func (m *EvokeGRPCClient) contentFileBatch(rpc func(context.Context, *proto.ContentFileBatch, ...grpc.CallOption) (*proto.ContentFileBatchResponse, error)) func([]*proto.ContentFile) ([]*proto.ContentFile, []string, error) {
+	return func(files []*proto.ContentFile) ([]*proto.ContentFile, []string, error) {
+		resp, err := rpc(context.Background(), &proto.ContentFileBatch{Files: files})
+		if err != nil {
+			return nil, nil, err
+		}
+		return resp.Files, resp.Errors, nil
+	}
+}
+
+// assetBatch sends a batch of assets.
+func (m *EvokeGRPCClient) assetBatch(assets []*proto.Asset) ([]*proto.Asset, []string, error) {
+	resp, err := m.Client.ProcessAssetBatch(context.Background(), &proto.AssetBatch{Assets: assets})
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Assets, resp.Errors, nil
+}
+
+// contentFileSize returns the size of the content of a file.
+func contentFileSize(file *proto.ContentFile) int {
+	return len(file.Content)
+}
+
+// assetSize returns the size of the content of an asset.
+func assetSize(asset *proto.Asset) int {
+	return len(asset.Content)
+}
+
+// ConnectHost serves the site to the plugin through the Host service, if the
+// plugin asks for it.
+func (m *EvokeGRPCClient) ConnectHost(site Site) error {
+	if !m.Implements(HookConnectHost) {
+		return nil
+	}
+	if m.broker == nil {
+		return fmt.Errorf("plugin %s asks for the host services, but has no connection to serve them through", m.name)
+	}
+	id := serveHost(m.broker, site, m.name)
+	_, err := m.Client.ConnectHost(context.Background(), &proto.ConnectHostRequest{BrokerId: id})
+	return err
+}
+
 // OnPreBuild is called before the build process starts.
 func (m *EvokeGRPCClient) OnPreBuild() error {
+	if !m.Implements(HookOnPreBuild) {
+		return nil
+	}
 	_, err := m.Client.OnPreBuild(context.Background(), &proto.PreBuildRequest{})
 	return err
 }
 
 // OnConfigLoaded is called after the configuration is loaded.
 func (m *EvokeGRPCClient) OnConfigLoaded(config []byte) ([]byte, error) {
+	if !m.Implements(HookOnConfigLoaded) {
+		return config, nil
+	}
 	resp, err := m.Client.OnConfigLoaded(context.Background(), &proto.ConfigLoadedRequest{
 		ConfigJson: string(config),
 	})
@@ -96,54 +234,96 @@ func (m *EvokeGRPCClient) OnConfigLoaded(config []byte) ([]byte, error) {
 
 // OnPublicAssetsCopied is called after the public assets are copied.
 func (m *EvokeGRPCClient) OnPublicAssetsCopied() error {
+	if !m.Implements(HookOnPublicAssetsCopied) {
+		return nil
+	}
 	_, err := m.Client.OnPublicAssetsCopied(context.Background(), &proto.PublicAssetsCopiedRequest{})
 	return err
 }
 
 // OnContentLoaded is called after a content file is loaded.
 func (m *EvokeGRPCClient) OnContentLoaded(path string, content []byte) ([]byte, error) {
-	resp, err := m.Client.OnContentLoaded(context.Background(), &proto.ContentFile{
-		Path:    path,
-		Content: content,
-	})
+	file, err := m.OnContentLoadedFile(&proto.ContentFile{Path: path, Content: content})
 	if err != nil {
 		return nil, err
 	}
-	return resp.Content, nil
+	return file.Content, nil
 }
 
 // OnContentRender is called after a content file is rendered.
 func (m *EvokeGRPCClient) OnContentRender(path string, content []byte) ([]byte, error) {
-	resp, err := m.Client.OnContentRender(context.Background(), &proto.ContentFile{
-		Path:    path,
-		Content: content,
-	})
+	file, err := m.OnContentRenderFile(&proto.ContentFile{Path: path, Content: content})
 	if err != nil {
 		return nil, err
 	}
-	return resp.Content, nil
+	return file.Content, nil
 }
 
 // OnHTMLRendered is called after the HTML is rendered.
 func (m *EvokeGRPCClient) OnHTMLRendered(path string, content []byte) ([]byte, error) {
-	resp, err := m.Client.OnHTMLRendered(context.Background(), &proto.ContentFile{
-		Path:    path,
-		Content: content,
-	})
+	file, err := m.OnHTMLRenderedFile(&proto.ContentFile{Path: path, Content: content})
 	if err != nil {
 		return nil, err
 	}
-	return resp.Content, nil
+	return file.Content, nil
+}
+
+// OnContentLoadedFile is called after a content file is loaded, with its
+// front matter.
+func (m *EvokeGRPCClient) OnContentLoadedFile(file *proto.ContentFile) (*proto.ContentFile, error) {
+	if !m.Implements(HookOnContentLoaded) {
+		return file, nil
+	}
+	if m.contentLoaded != nil {
+		return m.contentLoaded.do(file)
+	}
+	m.acquire()
+	defer m.release()
+	return m.Client.OnContentLoaded(context.Background(), file)
+}
+
+// OnContentRenderFile is called before a page is rendered, with its body and
+// front matter.
+func (m *EvokeGRPCClient) OnContentRenderFile(file *proto.ContentFile) (*proto.ContentFile, error) {
+	if !m.Implements(HookOnContentRender) {
+		return file, nil
+	}
+	if m.contentRender != nil {
+		return m.contentRender.do(file)
+	}
+	m.acquire()
+	defer m.release()
+	return m.Client.OnContentRender(context.Background(), file)
+}
+
+// OnHTMLRenderedFile is called after a page is rendered to HTML, before it is
+// placed in its layouts.
+func (m *EvokeGRPCClient) OnHTMLRenderedFile(file *proto.ContentFile) (*proto.ContentFile, error) {
+	if !m.Implements(HookOnHTMLRendered) {
+		return file, nil
+	}
+	if m.htmlRendered != nil {
+		return m.htmlRendered.do(file)
+	}
+	m.acquire()
+	defer m.release()
+	return m.Client.OnHTMLRendered(context.Background(), file)
 }
 
 // OnPostBuild is called after the build process is finished.
 func (m *EvokeGRPCClient) OnPostBuild() error {
+	if !m.Implements(HookOnPostBuild) {
+		return nil
+	}
 	_, err := m.Client.OnPostBuild(context.Background(), &proto.PostBuildRequest{})
 	return err
 }
 
 // RegisterPipelines is called to register custom pipelines.
 func (m *EvokeGRPCClient) RegisterPipelines() ([]*proto.Pipeline, error) {
+	if !m.Implements(HookRegisterPipelines) {
+		return nil, nil
+	}
 	resp, err := m.Client.RegisterPipelines(context.Background(), &proto.RegisterPipelinesRequest{})
 	if err != nil {
 		return nil, err
@@ -153,62 +333,85 @@ func (m *EvokeGRPCClient) RegisterPipelines() ([]*proto.Pipeline, error) {
 
 // ProcessAsset is called to process an asset with a custom pipeline.
 func (m *EvokeGRPCClient) ProcessAsset(asset *proto.Asset) (*proto.Asset, error) {
+	if !m.Implements(HookProcessAsset) {
+		return asset, nil
+	}
+	if m.assets != nil {
+		return m.assets.do(asset)
+	}
+	m.acquire()
+	defer m.release()
 	return m.Client.ProcessAsset(context.Background(), asset)
 }
 
-// LoadPlugins loads all the plugins in the plugins directory.
-func LoadPlugins() ([]Plugin, error) {
-	var plugins []Plugin
-	// We're going to walk the plugins directory and look for executable files
-	err := filepath.Walk("plugins", func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// If it's a directory, skip it
-		if info.IsDir() {
-			return nil
-		}
-
-		// If it's not executable, skip it
-		if info.Mode()&0111 == 0 {
-			return nil
-		}
-
-		// Create a new plugin client
-		client := plugin.NewClient(&plugin.ClientConfig{
-			HandshakeConfig: Handshake,
-			Plugins:         PluginMap,
-			Cmd:             exec.Command(path),
-			Logger: hclog.New(&hclog.LoggerOptions{
-				Name:  "plugin",
-				Level: hclog.Error,
-			}),
-		})
-
-		// Connect to the plugin
-		rpcClient, err := client.Client()
-		if err != nil {
-			return err
-		}
-
-		// Request the plugin
-		raw, err := rpcClient.Dispense("evoke")
-		if err != nil {
-			return err
-		}
+// GeneratePages is called to add pages that don't exist in the content
+// directory.
+func (m *EvokeGRPCClient) GeneratePages() ([]*proto.GeneratedPage, error) {
+	if !m.Implements(HookGeneratePages) {
+		return nil, nil
+	}
+	resp, err := m.Client.GeneratePages(context.Background(), &proto.GeneratePagesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Pages, nil
+}
 
-		// Assert that the plugin is the correct type
-		p, ok := raw.(*EvokeGRPCClient)
-		if !ok {
-			return err
-		}
+// RegisterTemplateFunctions is called to register functions that templates
+// can call.
+func (m *EvokeGRPCClient) RegisterTemplateFunctions() ([]*proto.TemplateFunction, error) {
+	if !m.Implements(HookRegisterTemplateFunctions) {
+		return nil, nil
+	}
+	resp, err := m.Client.RegisterTemplateFunctions(context.Background(), &proto.RegisterTemplateFunctionsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Functions, nil
+}
 
-		p.name = filepath.Base(path)
-		plugins = append(plugins, p)
+// CallTemplateFunction is called when a template calls a function registered
+// by the plugin.
+func (m *EvokeGRPCClient) CallTemplateFunction(name string, args []byte) ([]byte, error) {
+	if !m.Implements(HookCallTemplateFunction) {
+		return nil, fmt.Errorf("plugin %s does not implement template functions", m.name)
+	}
+	m.acquire()
+	defer m.release()
+	resp, err := m.Client.CallTemplateFunction(context.Background(), &proto.CallTemplateFunctionRequest{
+		Name:          name,
+		ArgumentsJson: string(args),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(resp.ResultJson), nil
+}
 
+// Configure is called with the settings of the plugin from evoke.yaml.
+func (m *EvokeGRPCClient) Configure(settings []byte) error {
+	if !m.Implements(HookConfigure) {
 		return nil
-	})
+	}
+	_, err := m.Client.Configure(context.Background(), &proto.ConfigureRequest{SettingsJson: string(settings)})
+	return err
+}
 
-	return plugins, err
+// Metadata returns the name, version and description reported by the plugin.
+func (m *EvokeGRPCClient) Metadata() (*proto.PluginMetadata, error) {
+	if m.metadata != nil {
+		return m.metadata, nil
+	}
+	if !m.Implements(HookGetMetadata) {
+		return &proto.PluginMetadata{Name: m.name}, nil
+	}
+	metadata, err := m.Client.GetMetadata(context.Background(), &proto.GetMetadataRequest{})
+	if err != nil {
+		return nil, err
+	}
+	if metadata.Name == "" {
+		metadata.Name = m.name
+	}
+	m.metadata = metadata
+	return metadata, nil
 }
@@ -0,0 +1,172 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"reflect"
+	"regexp"
+	"sync"
+
+	"github.com/Bitlatte/evoke/proto"
+)
+
+// funcNameRegexp matches the names a template function can be called by.
+var funcNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// templateBuiltins are the functions predefined by Go templates.
+var templateBuiltins = []string{
+	"and", "call", "html", "index", "slice", "js", "len", "not", "or", "print",
+	"printf", "println", "urlquery", "eq", "ge", "gt", "le", "lt", "ne",
+}
+
+// TemplateFuncs returns a FuncMap with a proxy for every template function
+// registered by the given plugins. A proxy checks the arguments against the
+// registered schema and calls back into its plugin. Results are cached for the
+// lifetime of the FuncMap, so a new one should be created for every build.
+// Plugins can't register the functions predefined by Go templates or by the
+// builtin FuncMaps.
+func TemplateFuncs(loadedPlugins []Plugin, builtin ...template.FuncMap) (template.FuncMap, error) {
+	funcs := make(template.FuncMap)
+	registeredBy := make(map[string]string)
+	defined := make(map[string]bool)
+	for _, name := range templateBuiltins {
+		defined[name] = true
+	}
+	for _, fm := range builtin {
+		for name := range fm {
+			defined[name] = true
+		}
+	}
+	c := &funcCache{calls: make(map[string]*funcCall)}
+
+	for _, p := range loadedPlugins {
+		provider, ok := p.(TemplateFuncProvider)
+		if !ok {
+			continue
+		}
+		functions, err := provider.RegisterTemplateFunctions()
+		if err != nil {
+			return nil, fmt.Errorf("error registering template functions of plugin %s: %w", p.Name(), err)
+		}
+		for _, f := range functions {
+			if !funcNameRegexp.MatchString(f.Name) {
+				return nil, fmt.Errorf("plugin %s registered template function with invalid name %q", p.Name(), f.Name)
+			}
+			if defined[f.Name] {
+				return nil, fmt.Errorf("plugin %s registered template function %s, which evoke already defines", p.Name(), f.Name)
+			}
+			if other, ok := registeredBy[f.Name]; ok {
+				return nil, fmt.Errorf("plugins %s and %s both registered template function %s", other, p.Name(), f.Name)
+			}
+			for _, arg := range f.Arguments {
+				if _, ok := argumentKinds[arg.Type]; !ok {
+					return nil, fmt.Errorf("template function %s of plugin %s has argument %s of unknown type %q", f.Name, p.Name(), arg.Name, arg.Type)
+				}
+			}
+			registeredBy[f.Name] = p.Name()
+			funcs[f.Name] = proxyFunc(provider, f, c)
+		}
+	}
+	return funcs, nil
+}
+
+// argumentKinds maps the argument types of the schema to the kinds of values
+// they accept.
+var argumentKinds = map[string][]reflect.Kind{
+	"":       nil,
+	"any":    nil,
+	"string": {reflect.String},
+	"bool":   {reflect.Bool},
+	"int": {
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+	},
+	"float": {
+		reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+	},
+}
+
+// proxyFunc returns the template function calling f of plugin p.
+func proxyFunc(p TemplateFuncProvider, f *proto.TemplateFunction, c *funcCache) func(args ...any) (any, error) {
+	return func(args ...any) (any, error) {
+		if len(args) != len(f.Arguments) {
+			return nil, fmt.Errorf("%s: expected %d arguments, got %d", f.Name, len(f.Arguments), len(args))
+		}
+		for i, arg := range f.Arguments {
+			if !acceptsKind(argumentKinds[arg.Type], args[i]) {
+				return nil, fmt.Errorf("%s: argument %s must be of type %s, got %T", f.Name, arg.Name, arg.Type, args[i])
+			}
+		}
+
+		encoded, err := json.Marshal(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: error encoding arguments: %w", f.Name, err)
+		}
+		return c.call(f.Name+"\x00"+string(encoded), func() (any, error) {
+			result, err := p.CallTemplateFunction(f.Name, encoded)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			if len(result) == 0 {
+				return nil, nil
+			}
+			var value any
+			if err := json.Unmarshal(result, &value); err != nil {
+				return nil, fmt.Errorf("%s: error decoding result: %w", f.Name, err)
+			}
+			return value, nil
+		})
+	}
+}
+
+// acceptsKind reports whether the value is of one of the kinds. No kinds
+// means any value is accepted.
+func acceptsKind(kinds []reflect.Kind, value any) bool {
+	if kinds == nil {
+		return true
+	}
+	if value == nil {
+		return false
+	}
+	kind := reflect.TypeOf(value).Kind()
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// funcCache caches the results of template function calls. Concurrent calls
+// with the same arguments wait for the first one instead of calling the
+// plugin again.
+type funcCache struct {
+	mu    sync.Mutex
+	calls map[string]*funcCall
+}
+
+// funcCall is the result of a template function call.
+type funcCall struct {
+	once   sync.Once
+	result any
+	err    error
+}
+
+// call returns the cached result for the key, calling fn if there is none.
+func (c *funcCache) call(key string, fn func() (any, error)) (any, error) {
+	c.mu.Lock()
+	fc, ok := c.calls[key]
+	if !ok {
+		fc = &funcCall{}
+		c.calls[key] = fc
+	}
+	c.mu.Unlock()
+
+	fc.once.Do(func() {
+		fc.result, fc.err = fn()
+	})
+	return fc.result, fc.err
+}
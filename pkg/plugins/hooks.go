@@ -0,0 +1,59 @@
+package plugins
+
+import "github.com/Bitlatte/evoke/pkg/plugin/api"
+
+// The hooks added after the Plugin interface are implemented through the
+// optional interfaces of the api package, which are repeated here.
+type (
+	// Configurer can be implemented by a plugin to get its settings from
+	// evoke.yaml.
+	Configurer = api.Configurer
+	// MetadataProvider can be implemented by a plugin to report its name,
+	// version and description.
+	MetadataProvider = api.MetadataProvider
+	// PageGenerator can be implemented by a plugin to add pages that don't
+	// exist in the content directory.
+	PageGenerator = api.PageGenerator
+	// TemplateFuncProvider can be implemented by a plugin to register
+	// functions that templates can call.
+	TemplateFuncProvider = api.TemplateFuncProvider
+	// ContentLoadedHook can be implemented by a plugin to get and change the
+	// front matter of a content file along with its content.
+	ContentLoadedHook = api.ContentLoadedHook
+	// ContentRenderHook can be implemented by a plugin to get and change the
+	// front matter of a page along with its body.
+	ContentRenderHook = api.ContentRenderHook
+	// HTMLRenderedHook can be implemented by a plugin to get and change the
+	// front matter of a page along with its HTML.
+	HTMLRenderedHook = api.HTMLRenderedHook
+)
+
+// optionalHooks report whether a plugin implements the interface of the
+// hooks that aren't part of the Plugin interface.
+var optionalHooks = map[string]func(Plugin) bool{
+	HookGetMetadata:               implements[MetadataProvider],
+	HookConfigure:                 implements[Configurer],
+	HookConnectHost:               implements[HostConnector],
+	HookGeneratePages:             implements[PageGenerator],
+	HookRegisterTemplateFunctions: implements[TemplateFuncProvider],
+	HookCallTemplateFunction:      implements[TemplateFuncProvider],
+}
+
+// implements reports whether the plugin implements the interface T.
+func implements[T any](p Plugin) bool {
+	_, ok := p.(T)
+	return ok
+}
+
+// implementedHooks returns the hooks of the Plugin interface and of the
+// optional interfaces the plugin implements.
+func implementedHooks(p Plugin) []string {
+	var hooks []string
+	for _, hook := range AllHooks {
+		if implemented, ok := optionalHooks[hook]; ok && !implemented(p) {
+			continue
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks
+}
@@ -0,0 +1,249 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Bitlatte/evoke/pkg/logger"
+	"github.com/Bitlatte/evoke/proto"
+	"github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+)
+
+// Host gives plugins access to the site being built. Plugins get it through
+// HostConnector once they are started.
+type Host interface {
+	// GetPage returns the page generated from the source file at path.
+	GetPage(path string) (*proto.Page, error)
+	// ListPages returns the published pages of the site.
+	ListPages() ([]*proto.Page, error)
+	// GetConfig returns the configuration of the site as a JSON object.
+	GetConfig() ([]byte, error)
+	// ResolveURL returns the URL of the page generated from the source file
+	// at path.
+	ResolveURL(path string) (string, error)
+	// Log logs a message with the host's logger at the given level, one of
+	// debug, info, warn or error.
+	Log(level, message string) error
+	// AddDiagnostic reports a problem found by the plugin. Errors fail the
+	// build once it's done.
+	AddDiagnostic(diagnostic *proto.Diagnostic) error
+}
+
+// HostConnector can be implemented by a plugin to get access to the host.
+// The plugin then reports the ConnectHost hook on its own.
+type HostConnector interface {
+	// SetHost is called once after the plugin is started.
+	SetHost(host Host)
+}
+
+// Site is the host's view of the site being built, which it serves to
+// plugins through the Host service.
+type Site interface {
+	// Page returns the page generated from the source file at path.
+	Page(path string) (*proto.Page, error)
+	// Pages returns the published pages.
+	Pages() ([]*proto.Page, error)
+	// Config returns the configuration as a JSON object.
+	Config() ([]byte, error)
+	// AddDiagnostic records a problem reported by a plugin.
+	AddDiagnostic(diagnostic *proto.Diagnostic)
+}
+
+// siteRef forwards to the site of the current build, so that plugins reused
+// across builds see the latest one.
+type siteRef struct {
+	mu   sync.RWMutex
+	site Site
+}
+
+// get returns the site of the current build.
+func (r *siteRef) get() (Site, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.site == nil {
+		return nil, fmt.Errorf("no site is being built")
+	}
+	return r.site, nil
+}
+
+// set sets the site of the current build.
+func (r *siteRef) set(site Site) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.site = site
+}
+
+// Page returns the page generated from the source file at path.
+func (r *siteRef) Page(path string) (*proto.Page, error) {
+	site, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	return site.Page(path)
+}
+
+// Pages returns the published pages.
+func (r *siteRef) Pages() ([]*proto.Page, error) {
+	site, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	return site.Pages()
+}
+
+// Config returns the configuration as a JSON object.
+func (r *siteRef) Config() ([]byte, error) {
+	site, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	return site.Config()
+}
+
+// AddDiagnostic records a problem reported by a plugin. Diagnostics reported
+// between builds are logged.
+func (r *siteRef) AddDiagnostic(diagnostic *proto.Diagnostic) {
+	site, err := r.get()
+	if err != nil {
+		logger.Logger.Warn(diagnostic.Message, "plugin", diagnostic.Plugin, "path", diagnostic.Path)
+		return
+	}
+	site.AddDiagnostic(diagnostic)
+}
+
+// HostGRPCServer serves a Site to a plugin.
+type HostGRPCServer struct {
+	// Impl is the site served to the plugin.
+	Impl Site
+	// Plugin is the name of the plugin, which its logs and diagnostics are
+	// attributed to.
+	Plugin string
+	proto.UnimplementedHostServer
+}
+
+// GetPage returns the page generated from the source file at the given path.
+func (h *HostGRPCServer) GetPage(ctx context.Context, req *proto.GetPageRequest) (*proto.Page, error) {
+	return h.Impl.Page(req.Path)
+}
+
+// ListPages returns the published pages of the site.
+func (h *HostGRPCServer) ListPages(ctx context.Context, req *proto.ListPagesRequest) (*proto.ListPagesResponse, error) {
+	pages, err := h.Impl.Pages()
+	if err != nil {
+		return nil, err
+	}
+	return &proto.ListPagesResponse{Pages: pages}, nil
+}
+
+// GetConfig returns the configuration of the site.
+func (h *HostGRPCServer) GetConfig(ctx context.Context, req *proto.GetConfigRequest) (*proto.GetConfigResponse, error) {
+	config, err := h.Impl.Config()
+	if err != nil {
+		return nil, err
+	}
+	return &proto.GetConfigResponse{ConfigJson: string(config)}, nil
+}
+
+// ResolveURL returns the URL of the page generated from the source file at
+// the given path.
+func (h *HostGRPCServer) ResolveURL(ctx context.Context, req *proto.ResolveURLRequest) (*proto.ResolveURLResponse, error) {
+	page, err := h.Impl.Page(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.ResolveURLResponse{Url: page.Url}, nil
+}
+
+// Log logs the message with the evoke logger.
+func (h *HostGRPCServer) Log(ctx context.Context, req *proto.LogRequest) (*proto.LogResponse, error) {
+	switch strings.ToLower(req.Level) {
+	case "debug", "trace":
+		logger.Logger.Debug(req.Message, "plugin", h.Plugin)
+	case "", "info":
+		logger.Logger.Info(req.Message, "plugin", h.Plugin)
+	case "warn", "warning":
+		logger.Logger.Warn(req.Message, "plugin", h.Plugin)
+	case "error":
+		logger.Logger.Error(req.Message, "plugin", h.Plugin)
+	default:
+		return nil, fmt.Errorf("unknown log level %q", req.Level)
+	}
+	return &proto.LogResponse{}, nil
+}
+
+// AddDiagnostic records a problem found by the plugin.
+func (h *HostGRPCServer) AddDiagnostic(ctx context.Context, req *proto.Diagnostic) (*proto.AddDiagnosticResponse, error) {
+	switch req.Severity {
+	case "warning", "error":
+	default:
+		return nil, fmt.Errorf("unknown diagnostic severity %q", req.Severity)
+	}
+	req.Plugin = h.Plugin
+	h.Impl.AddDiagnostic(req)
+	return &proto.AddDiagnosticResponse{}, nil
+}
+
+// HostGRPCClient is an implementation of Host that talks over RPC.
+type HostGRPCClient struct {
+	Client proto.HostClient
+}
+
+// GetPage returns the page generated from the source file at path.
+func (h *HostGRPCClient) GetPage(path string) (*proto.Page, error) {
+	return h.Client.GetPage(context.Background(), &proto.GetPageRequest{Path: path})
+}
+
+// ListPages returns the published pages of the site.
+func (h *HostGRPCClient) ListPages() ([]*proto.Page, error) {
+	resp, err := h.Client.ListPages(context.Background(), &proto.ListPagesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Pages, nil
+}
+
+// GetConfig returns the configuration of the site as a JSON object.
+func (h *HostGRPCClient) GetConfig() ([]byte, error) {
+	resp, err := h.Client.GetConfig(context.Background(), &proto.GetConfigRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(resp.ConfigJson), nil
+}
+
+// ResolveURL returns the URL of the page generated from the source file at
+// path.
+func (h *HostGRPCClient) ResolveURL(path string) (string, error) {
+	resp, err := h.Client.ResolveURL(context.Background(), &proto.ResolveURLRequest{Path: path})
+	if err != nil {
+		return "", err
+	}
+	return resp.Url, nil
+}
+
+// Log logs a message with the host's logger.
+func (h *HostGRPCClient) Log(level, message string) error {
+	_, err := h.Client.Log(context.Background(), &proto.LogRequest{Level: level, Message: message})
+	return err
+}
+
+// AddDiagnostic reports a problem found by the plugin.
+func (h *HostGRPCClient) AddDiagnostic(diagnostic *proto.Diagnostic) error {
+	_, err := h.Client.AddDiagnostic(context.Background(), diagnostic)
+	return err
+}
+
+// serveHost serves the site to a plugin over the broker and returns the ID
+// the plugin dials to reach it.
+func serveHost(broker *plugin.GRPCBroker, site Site, name string) uint32 {
+	id := broker.NextId()
+	go broker.AcceptAndServe(id, func(opts []grpc.ServerOption) *grpc.Server {
+		s := grpc.NewServer(opts...)
+		proto.RegisterHostServer(s, &HostGRPCServer{Impl: site, Plugin: name})
+		return s
+	})
+	return id
+}
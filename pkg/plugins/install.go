@@ -0,0 +1,276 @@
+package plugins
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Bitlatte/evoke/pkg/config"
+	"github.com/Bitlatte/evoke/pkg/hash"
+)
+
+// Install installs a plugin into the plugins directory dir and returns its
+// lockfile entry. The source is a plugin executable, a WebAssembly module, or
+// a .zip, .tar.gz or .tgz archive containing exactly one of them along with
+// the files it needs. Executables and archives are installed in a directory
+// named after the plugin, modules directly in dir.
+//
+// The plugin is started once to read its version, so that a broken plugin
+// isn't installed.
+func Install(source, dir string) (LockedPlugin, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return LockedPlugin{}, fmt.Errorf("error creating %s: %w", dir, err)
+	}
+
+	var name, path string
+	var err error
+	if isArchive(source) {
+		name, path, err = installArchive(source, dir)
+	} else {
+		name, path, err = installFile(source, dir)
+	}
+	if err != nil {
+		return LockedPlugin{}, err
+	}
+
+	version, err := pluginVersion(config.Plugin{Name: name, Path: path})
+	if err != nil {
+		if !sameFile(source, path) {
+			uninstall(path, dir)
+		}
+		return LockedPlugin{}, err
+	}
+	sum, err := hash.New(path)
+	if err != nil {
+		return LockedPlugin{}, fmt.Errorf("error computing the checksum of plugin %s: %w", name, err)
+	}
+	return LockedPlugin{Name: name, Version: version, Source: source, Path: path, SHA256: sum}, nil
+}
+
+// Uninstall removes the files of an installed plugin from the plugins
+// directory dir.
+func Uninstall(p LockedPlugin, dir string) error {
+	if err := uninstall(p.Path, dir); err != nil {
+		return fmt.Errorf("error removing plugin %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+// uninstall removes the plugin at path, along with its directory if it was
+// installed in one.
+func uninstall(path, dir string) error {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("%s is outside of %s", path, dir)
+	}
+	if parts := strings.Split(rel, string(os.PathSeparator)); len(parts) > 1 {
+		return os.RemoveAll(filepath.Join(dir, parts[0]))
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// isArchive reports whether the file is an archive Install can extract.
+func isArchive(path string) bool {
+	return archiveExt(path) != ""
+}
+
+// archiveExt returns the archive extension of the file, or an empty string.
+func archiveExt(path string) string {
+	for _, ext := range []string{".zip", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(path, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// installFile copies a plugin executable or module into dir. A plugin that
+// is already installed there is left in place.
+func installFile(source, dir string) (string, string, error) {
+	base := filepath.Base(source)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	path := filepath.Join(dir, name, base)
+	perm := os.FileMode(0755)
+	if filepath.Ext(base) == ".wasm" {
+		path = filepath.Join(dir, base)
+		perm = 0644
+	}
+	if sameFile(source, path) {
+		return name, path, nil
+	}
+
+	if err := uninstall(path, dir); err != nil {
+		return "", "", fmt.Errorf("error replacing plugin %s: %w", name, err)
+	}
+	return name, path, copyFile(source, path, perm)
+}
+
+// sameFile reports whether both paths are the same existing file.
+func sameFile(a, b string) bool {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(infoA, infoB)
+}
+
+// installArchive extracts an archive into a directory of dir named after the
+// plugin it contains.
+func installArchive(source, dir string) (string, string, error) {
+	tmp, err := os.MkdirTemp(dir, ".install-")
+	if err != nil {
+		return "", "", fmt.Errorf("error installing %s: %w", source, err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if archiveExt(source) == ".zip" {
+		err = extractZip(source, tmp)
+	} else {
+		err = extractTar(source, tmp)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("error extracting %s: %w", source, err)
+	}
+
+	found, err := findPlugins(tmp)
+	if err != nil {
+		return "", "", fmt.Errorf("error installing %s: %w", source, err)
+	}
+	if len(found.names) != 1 {
+		return "", "", fmt.Errorf("archive %s must contain exactly one plugin, found %d", source, len(found.names))
+	}
+	name := found.names[0]
+	rel, err := filepath.Rel(tmp, found.paths[name])
+	if err != nil {
+		return "", "", err
+	}
+
+	target := filepath.Join(dir, name)
+	if err := os.RemoveAll(target); err != nil {
+		return "", "", fmt.Errorf("error replacing plugin %s: %w", name, err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return "", "", fmt.Errorf("error installing plugin %s: %w", name, err)
+	}
+	return name, filepath.Join(target, rel), nil
+}
+
+// extractZip extracts the zip archive into dir.
+func extractZip(source, dir string) error {
+	r, err := zip.OpenReader(source)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		in, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = extractFile(in, dir, f.Name, f.Mode())
+		in.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractTar extracts the gzipped tar archive into dir.
+func extractTar(source, dir string) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	r := tar.NewReader(gz)
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := extractFile(r, dir, header.Name, header.FileInfo().Mode()); err != nil {
+			return err
+		}
+	}
+}
+
+// extractFile writes a file of an archive into dir. Files outside of dir
+// are refused.
+func extractFile(r io.Reader, dir, name string, mode os.FileMode) error {
+	path := filepath.Join(dir, name)
+	if !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+		return fmt.Errorf("file %s is outside of the archive", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copyFile copies the file at source to path with the given permissions.
+func copyFile(source, path string, perm os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("error installing %s: %w", source, err)
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error installing %s: %w", source, err)
+	}
+	if err := extractFile(in, filepath.Dir(path), filepath.Base(path), perm); err != nil {
+		return fmt.Errorf("error installing %s: %w", source, err)
+	}
+	return nil
+}
+
+// pluginVersion starts the plugin to read the version from its metadata.
+func pluginVersion(cfg config.Plugin) (string, error) {
+	proc, p, err := starter(cfg.Path)(cfg, &siteRef{})
+	if err != nil {
+		return "", err
+	}
+	defer proc.Kill()
+	metadata, err := p.Metadata()
+	if err != nil {
+		return "", fmt.Errorf("error getting metadata of plugin %s: %w", cfg.Name, err)
+	}
+	return metadata.Version, nil
+}
@@ -0,0 +1,159 @@
+package plugins
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/Bitlatte/evoke/pkg/hash"
+	"gopkg.in/yaml.v3"
+)
+
+// LockFile is the file recording the installed plugins.
+const LockFile = "evoke.lock"
+
+// Statuses of the plugins reported by Status.
+const (
+	// StatusOK is the status of a locked plugin matching its checksum.
+	StatusOK = "ok"
+	// StatusModified is the status of a locked plugin that doesn't match its
+	// checksum.
+	StatusModified = "modified"
+	// StatusMissing is the status of a locked plugin that isn't installed.
+	StatusMissing = "missing"
+	// StatusUnlocked is the status of a plugin missing from the lockfile.
+	StatusUnlocked = "unlocked"
+)
+
+// Lock records the installed plugins, so that a plugin can't be replaced
+// without it being noticed.
+type Lock struct {
+	Plugins []LockedPlugin `yaml:"plugins"`
+}
+
+// LockedPlugin records an installed plugin.
+type LockedPlugin struct {
+	// Name is the name the plugin is discovered by in the plugins directory.
+	Name string `yaml:"name"`
+	// Version is the version reported by the plugin's metadata.
+	Version string `yaml:"version"`
+	// Source is the file the plugin was installed from.
+	Source string `yaml:"source"`
+	// Path is the path of the plugin executable or module.
+	Path string `yaml:"path"`
+	// SHA256 is the checksum of the plugin executable or module.
+	SHA256 string `yaml:"sha256"`
+}
+
+// ReadLock reads the lockfile at path. A missing lockfile is an empty lock.
+func ReadLock(path string) (*Lock, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Lock{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	var lock Lock
+	if err := yaml.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return &lock, nil
+}
+
+// Write writes the lock to path, with the plugins sorted by name.
+func (l *Lock) Write(path string) error {
+	sort.Slice(l.Plugins, func(i, j int) bool { return l.Plugins[i].Name < l.Plugins[j].Name })
+	var buf bytes.Buffer
+	buf.WriteString("# This file is generated by evoke plugin. Do not edit it by hand.\n")
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(l); err != nil {
+		return fmt.Errorf("error encoding %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// Find returns the locked plugin with the name, or nil.
+func (l *Lock) Find(name string) *LockedPlugin {
+	for i := range l.Plugins {
+		if l.Plugins[i].Name == name {
+			return &l.Plugins[i]
+		}
+	}
+	return nil
+}
+
+// Set records the plugin, replacing the plugin with the same name.
+func (l *Lock) Set(p LockedPlugin) {
+	if existing := l.Find(p.Name); existing != nil {
+		*existing = p
+		return
+	}
+	l.Plugins = append(l.Plugins, p)
+}
+
+// Remove removes the plugin with the name and reports whether it was locked.
+func (l *Lock) Remove(name string) bool {
+	for i, p := range l.Plugins {
+		if p.Name == name {
+			l.Plugins = append(l.Plugins[:i], l.Plugins[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Verify checks that the file at path matches the checksum of the plugin.
+func (p *LockedPlugin) Verify(path string) error {
+	sum, err := hash.New(path)
+	if err != nil {
+		return fmt.Errorf("error computing the checksum of plugin %s: %w", p.Name, err)
+	}
+	if sum != p.SHA256 {
+		return fmt.Errorf("plugin %s at %s doesn't match its checksum in %s; reinstall it with evoke plugin add", p.Name, path, LockFile)
+	}
+	return nil
+}
+
+// PluginStatus is the status of a plugin, as reported by Status.
+type PluginStatus struct {
+	Name    string
+	Version string
+	Path    string
+	// Status is one of StatusOK, StatusModified, StatusMissing or
+	// StatusUnlocked.
+	Status string
+}
+
+// Status returns the status of the plugins found in the plugins directory
+// and of the locked plugins, sorted by name.
+func Status(dir string, lock *Lock) ([]PluginStatus, error) {
+	discovered, err := findPlugins(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []PluginStatus
+	for _, p := range lock.Plugins {
+		status := PluginStatus{Name: p.Name, Version: p.Version, Path: p.Path, Status: StatusOK}
+		if _, err := os.Stat(p.Path); errors.Is(err, os.ErrNotExist) {
+			status.Status = StatusMissing
+		} else if err := p.Verify(p.Path); err != nil {
+			status.Status = StatusModified
+		}
+		statuses = append(statuses, status)
+	}
+	for _, name := range discovered.names {
+		if lock.Find(name) == nil {
+			statuses = append(statuses, PluginStatus{Name: name, Path: discovered.paths[name], Status: StatusUnlocked})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses, nil
+}
@@ -0,0 +1,84 @@
+package plugins
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/Bitlatte/evoke/pkg/logger"
+	"github.com/hashicorp/go-hclog"
+)
+
+// newPluginLogger returns the logger plugin clients log to. Messages logged by
+// the plugins through hclog, as well as the client's own messages, are
+// forwarded to the evoke logger.
+func newPluginLogger() hclog.Logger {
+	l := hclog.NewInterceptLogger(&hclog.LoggerOptions{
+		Name:   "plugin",
+		Level:  hclog.Trace,
+		Output: io.Discard,
+	})
+	l.RegisterSink(hostLogSink{})
+	return l
+}
+
+// hostLogSink forwards hclog messages to the evoke logger.
+type hostLogSink struct{}
+
+// Accept logs the message with the evoke logger at the matching level.
+func (hostLogSink) Accept(name string, level hclog.Level, msg string, args ...interface{}) {
+	fields := []interface{}{"plugin", name}
+	for i := 0; i+1 < len(args); i += 2 {
+		// The client adds the time of each message of the plugin, which the
+		// evoke logger already prints
+		if args[i] == "timestamp" {
+			continue
+		}
+		fields = append(fields, args[i], args[i+1])
+	}
+
+	// The client's own messages, e.g. about a plugin process exiting, are
+	// only interesting when debugging
+	if name == "plugin" && level == hclog.Info {
+		level = hclog.Debug
+	}
+
+	switch level {
+	case hclog.Trace, hclog.Debug:
+		logger.Logger.Debug(msg, fields...)
+	case hclog.Info:
+		logger.Logger.Info(msg, fields...)
+	case hclog.Warn:
+		logger.Logger.Warn(msg, fields...)
+	default:
+		logger.Logger.Error(msg, fields...)
+	}
+}
+
+// pluginLogWriter forwards the lines a plugin writes to stderr to the evoke
+// logger.
+type pluginLogWriter struct {
+	name string
+	buf  []byte
+}
+
+// newPluginLogWriter returns the writer for the stderr of the named plugin.
+func newPluginLogWriter(name string) io.Writer {
+	return &pluginLogWriter{name: name}
+}
+
+// Write logs every complete line written and keeps the rest.
+func (w *pluginLogWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(w.buf[:i])); line != "" {
+			logger.Logger.Info(line, "plugin", w.name)
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
@@ -0,0 +1,343 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bitlatte/evoke/pkg/config"
+	"github.com/Bitlatte/evoke/pkg/logger"
+	"github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+)
+
+// Manager owns the plugin processes. Plugins are started the first time a
+// build needs them and reused by later builds, unless their process exited
+// or their binary changed, in which case they are restarted.
+type Manager struct {
+	mu      sync.Mutex
+	running map[string]*managedPlugin
+	// site is served to the plugins through the Host service.
+	site siteRef
+}
+
+// process is a running plugin, either a plugin process or a WebAssembly
+// module.
+type process interface {
+	Kill()
+	Exited() bool
+}
+
+// managedPlugin is a running plugin.
+type managedPlugin struct {
+	client process
+	plugin *EvokeGRPCClient
+	// modTime and size identify the binary the process was started from.
+	modTime time.Time
+	size    int64
+	// settings are the settings the plugin was last configured with.
+	settings string
+	// sandbox is the sandbox the plugin was started in.
+	sandbox config.Sandbox
+}
+
+// NewManager creates a new Manager.
+func NewManager() *Manager {
+	return &Manager{running: make(map[string]*managedPlugin)}
+}
+
+// Load returns the plugins in the plugins directory. Plugins listed in the
+// configuration come first, in the listed order, unless they are disabled.
+// The remaining plugins follow them. Plugins that are no longer needed are
+// stopped.
+//
+// Plugins recorded in the lockfile are only started if they match their
+// checksum.
+func (m *Manager) Load(configs []config.Plugin) ([]Plugin, error) {
+	toLoad, err := resolvePlugins("plugins", configs)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := ReadLock(LockFile)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	needed := make(map[string]bool, len(toLoad))
+	var plugins []Plugin
+	for _, cfg := range toLoad {
+		needed[cfg.Path] = true
+		p, err := m.load(cfg, lock.Find(cfg.Name))
+		if err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, p)
+	}
+
+	for path, mp := range m.running {
+		if !needed[path] {
+			logger.Logger.Debug("Stopping plugin", "plugin", mp.plugin.Name())
+			mp.client.Kill()
+			delete(m.running, path)
+		}
+	}
+	return plugins, nil
+}
+
+// load returns the running plugin for the configuration, starting or
+// restarting it if needed, and configures it with its settings. A locked
+// plugin is verified before it is started.
+func (m *Manager) load(cfg config.Plugin, locked *LockedPlugin) (*EvokeGRPCClient, error) {
+	info, err := os.Stat(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading plugin %s: %w", cfg.Name, err)
+	}
+
+	mp := m.running[cfg.Path]
+	switch {
+	case mp == nil:
+	case mp.client.Exited():
+		logger.Logger.Warn("Plugin exited, restarting it", "plugin", mp.plugin.Name())
+		mp.client.Kill()
+		mp = nil
+	case !mp.modTime.Equal(info.ModTime()) || mp.size != info.Size():
+		logger.Logger.Info("Plugin changed, reloading it", "plugin", mp.plugin.Name())
+		mp.client.Kill()
+		mp = nil
+	case !reflect.DeepEqual(mp.sandbox, cfg.Sandbox):
+		logger.Logger.Info("Plugin sandbox changed, restarting it", "plugin", mp.plugin.Name())
+		mp.client.Kill()
+		mp = nil
+	}
+
+	if mp == nil {
+		if locked != nil {
+			if err := locked.Verify(cfg.Path); err != nil {
+				delete(m.running, cfg.Path)
+				return nil, err
+			}
+		}
+		client, p, err := starter(cfg.Path)(cfg, &m.site)
+		if err != nil {
+			delete(m.running, cfg.Path)
+			return nil, err
+		}
+		mp = &managedPlugin{client: client, plugin: p, modTime: info.ModTime(), size: info.Size(), sandbox: cfg.Sandbox}
+		m.running[cfg.Path] = mp
+	}
+
+	if cfg.Settings == nil {
+		cfg.Settings = make(map[string]interface{})
+	}
+	settings, err := json.Marshal(cfg.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding settings of plugin %s: %w", cfg.Name, err)
+	}
+	if string(settings) != mp.settings {
+		if err := mp.plugin.Configure(settings); err != nil {
+			return nil, fmt.Errorf("error configuring plugin %s: %w", cfg.Name, err)
+		}
+		mp.settings = string(settings)
+	}
+	return mp.plugin, nil
+}
+
+// SetSite sets the site served to the plugins through the Host service. It
+// is set by every build, so that plugins reused across builds see the site
+// being built.
+func (m *Manager) SetSite(site Site) {
+	m.site.set(site)
+}
+
+// Kill stops all plugin processes.
+func (m *Manager) Kill() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for path, mp := range m.running {
+		mp.client.Kill()
+		delete(m.running, path)
+	}
+}
+
+// KillAll stops the plugin processes of every manager. It is meant to be
+// called when evoke is interrupted.
+func KillAll() {
+	plugin.CleanupClients()
+}
+
+// resolvePlugins returns the configurations of the plugins to load, in order.
+func resolvePlugins(dir string, configs []config.Plugin) ([]config.Plugin, error) {
+	discovered, err := findPlugins(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := make(map[string]bool)
+	var toLoad []config.Plugin
+	for _, cfg := range configs {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("plugin without a name in evoke.yaml")
+		}
+		if listed[cfg.Name] {
+			return nil, fmt.Errorf("plugin %s is listed more than once in evoke.yaml", cfg.Name)
+		}
+		listed[cfg.Name] = true
+		if cfg.Path == "" {
+			cfg.Path = discovered.paths[cfg.Name]
+		}
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("plugin %s listed in evoke.yaml not found in the plugins directory", cfg.Name)
+		}
+		if cfg.IsEnabled() {
+			toLoad = append(toLoad, cfg)
+		}
+	}
+	for _, name := range discovered.names {
+		if !listed[name] {
+			toLoad = append(toLoad, config.Plugin{Name: name, Path: discovered.paths[name]})
+		}
+	}
+	return toLoad, nil
+}
+
+// discoveredPlugins are the plugin executables found in the plugins
+// directory, by name.
+type discoveredPlugins struct {
+	names []string
+	paths map[string]string
+}
+
+// findPlugins walks the plugins directory and looks for executable files and
+// WebAssembly modules. A plugin is named after its file name without the
+// extension.
+func findPlugins(dir string) (*discoveredPlugins, error) {
+	discovered := &discoveredPlugins{paths: make(map[string]string)}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return discovered, nil
+	}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// If it's a directory, skip it
+		if info.IsDir() {
+			return nil
+		}
+
+		// If it's neither executable nor a WebAssembly module, skip it
+		if info.Mode()&0111 == 0 && filepath.Ext(path) != ".wasm" {
+			return nil
+		}
+
+		name := strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
+		if other, ok := discovered.paths[name]; ok {
+			return fmt.Errorf("plugins %s and %s have the same name %s", other, path, name)
+		}
+		discovered.names = append(discovered.names, name)
+		discovered.paths[name] = path
+		return nil
+	})
+	return discovered, err
+}
+
+// starter returns the function starting the plugin at path.
+func starter(path string) func(config.Plugin, Site) (process, *EvokeGRPCClient, error) {
+	if filepath.Ext(path) == ".wasm" {
+		// WebAssembly plugins can't reach the host services
+		return func(cfg config.Plugin, _ Site) (process, *EvokeGRPCClient, error) {
+			return startWasmPlugin(cfg)
+		}
+	}
+	return startPlugin
+}
+
+// startPlugin starts the plugin process in its sandbox and connects to it.
+func startPlugin(cfg config.Plugin, site Site) (process, *EvokeGRPCClient, error) {
+	logger.Logger.Debug("Starting plugin", "plugin", cfg.Name, "path", cfg.Path)
+
+	// The plugin runs in its own working directory, so its path must not be
+	// relative to the project
+	path, err := filepath.Abs(cfg.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error starting plugin %s: %w", cfg.Name, err)
+	}
+	cmd, err := sandboxCommand(path, cfg.Sandbox)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error sandboxing plugin %s: %w", cfg.Name, err)
+	}
+	dir, cleanup, err := sandboxDir(cfg.Sandbox)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating working directory of plugin %s: %w", cfg.Name, err)
+	}
+	cmd.Dir = dir
+	guard := &callGuard{name: cfg.Name, timeout: sandboxTimeout(cfg.Sandbox)}
+
+	// Create a new plugin client
+	client := plugin.NewClient(&plugin.ClientConfig{
+		HandshakeConfig:  Handshake,
+		VersionedPlugins: VersionedPlugins,
+		AllowedProtocols: []plugin.Protocol{plugin.ProtocolGRPC},
+		Cmd:              cmd,
+		SkipHostEnv:      true,
+		Managed:          true,
+		Logger:           newPluginLogger(),
+		GRPCDialOptions:  []grpc.DialOption{grpc.WithUnaryInterceptor(guard.intercept)},
+	})
+	guard.exited = client.Exited
+	proc := &cleanupProcess{process: client, cleanup: cleanup}
+
+	// Connect to the plugin
+	rpcClient, err := client.Client()
+	if err != nil {
+		proc.Kill()
+		if strings.Contains(err.Error(), "Incompatible API version") {
+			return nil, nil, fmt.Errorf("plugin %s uses an unsupported protocol version, this version of evoke supports protocol versions %v; rebuild the plugin against a compatible version of evoke: %w", cfg.Name, SupportedProtocolVersions, err)
+		}
+		return nil, nil, fmt.Errorf("error starting plugin %s: %w", cfg.Name, err)
+	}
+
+	// Request the plugin
+	raw, err := rpcClient.Dispense("evoke")
+	if err != nil {
+		proc.Kill()
+		return nil, nil, fmt.Errorf("error starting plugin %s: %w", cfg.Name, err)
+	}
+
+	// Assert that the plugin is the correct type
+	p, ok := raw.(*EvokeGRPCClient)
+	if !ok {
+		proc.Kill()
+		return nil, nil, fmt.Errorf("plugin %s has an unexpected type %T", cfg.Name, raw)
+	}
+
+	p.name = cfg.Name
+	if err := p.LoadCapabilities(client.NegotiatedVersion()); err != nil {
+		proc.Kill()
+		return nil, nil, fmt.Errorf("error getting capabilities of plugin %s: %w", cfg.Name, err)
+	}
+
+	// Name the plugin after its metadata
+	metadata, err := p.Metadata()
+	if err != nil {
+		proc.Kill()
+		return nil, nil, fmt.Errorf("error getting metadata of plugin %s: %w", cfg.Name, err)
+	}
+	p.name = metadata.Name
+	guard.name = metadata.Name
+
+	if err := p.ConnectHost(site); err != nil {
+		proc.Kill()
+		return nil, nil, fmt.Errorf("error connecting plugin %s to the host: %w", cfg.Name, err)
+	}
+	return proc, p, nil
+}
@@ -0,0 +1,52 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// EncodeMetadata converts metadata, such as the front matter of a page, to a
+// Struct that can be sent to plugins. Values are converted the way they are
+// encoded to JSON, e.g. dates become strings.
+func EncodeMetadata(metadata map[string]interface{}) (*structpb.Struct, error) {
+	if metadata == nil {
+		return &structpb.Struct{Fields: map[string]*structpb.Value{}}, nil
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding metadata: %w", err)
+	}
+	s := &structpb.Struct{}
+	if err := s.UnmarshalJSON(encoded); err != nil {
+		return nil, fmt.Errorf("error encoding metadata: %w", err)
+	}
+	return s, nil
+}
+
+// MergeMetadata applies the changes a plugin made to the metadata it was sent
+// to metadata, which is returned. Keys the plugin removed are deleted and keys
+// it added or changed are set, while the values it left alone keep their
+// original type. A nil result from the plugin leaves metadata unchanged.
+func MergeMetadata(metadata map[string]interface{}, sent, returned *structpb.Struct) map[string]interface{} {
+	if returned == nil {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = make(map[string]interface{}, len(returned.Fields))
+	}
+	for k := range sent.GetFields() {
+		if _, ok := returned.Fields[k]; !ok {
+			delete(metadata, k)
+		}
+	}
+	for k, v := range returned.Fields {
+		if original, ok := sent.GetFields()[k]; ok && proto.Equal(original, v) {
+			continue
+		}
+		metadata[k] = v.AsInterface()
+	}
+	return metadata
+}
@@ -1,17 +1,48 @@
 package plugins_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
 	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/Bitlatte/evoke/pkg/config"
 	"github.com/Bitlatte/evoke/pkg/plugins"
 	"github.com/Bitlatte/evoke/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
+// TestMain starts the plugins with resource limits when the test binary is
+// run as ExecCommand, as evoke does.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == plugins.ExecCommand {
+		if err := plugins.ExecLimited(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	os.Exit(m.Run())
+}
+
 // mockPlugin is a mock implementation of the Plugin interface.
-type mockPlugin struct{}
+type mockPlugin struct {
+	calls int
+}
 
 func (m *mockPlugin) Name() string      { return "mock" }
 func (m *mockPlugin) OnPreBuild() error { return nil }
@@ -40,6 +71,64 @@ func (m *mockPlugin) RegisterPipelines() ([]*proto.Pipeline, error) {
 func (m *mockPlugin) ProcessAsset(asset *proto.Asset) (*proto.Asset, error) {
 	return asset, nil
 }
+func (m *mockPlugin) Configure(settings []byte) error { return nil }
+func (m *mockPlugin) Metadata() (*proto.PluginMetadata, error) {
+	return &proto.PluginMetadata{Name: "mock", Version: "1.0.0"}, nil
+}
+func (m *mockPlugin) GeneratePages() ([]*proto.GeneratedPage, error) {
+	return []*proto.GeneratedPage{
+		{
+			Path:            "api/users.md",
+			FrontMatterJson: `{"title": "Users"}`,
+			Content:         []byte("# Users"),
+		},
+	}, nil
+}
+
+func (m *mockPlugin) RegisterTemplateFunctions() ([]*proto.TemplateFunction, error) {
+	return []*proto.TemplateFunction{
+		{
+			Name:      "repeat",
+			Arguments: []*proto.TemplateFunctionArgument{{Name: "s", Type: "string"}, {Name: "n", Type: "int"}},
+		},
+	}, nil
+}
+func (m *mockPlugin) CallTemplateFunction(name string, args []byte) ([]byte, error) {
+	m.calls++
+	return args, nil
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	mock := &mockPlugin{}
+	funcs, err := plugins.TemplateFuncs([]plugins.Plugin{mock})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Results are cached per FuncMap
+	tmpl := template.Must(template.New("").Funcs(funcs).Parse(`{{ repeat "a" 2 }}{{ repeat "a" 2 }}`))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if buf.String() != "[a 2][a 2]" {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+	if mock.calls != 1 {
+		t.Fatalf("expected 1 call, got %d", mock.calls)
+	}
+
+	// Arguments are checked against the schema
+	tmpl = template.Must(template.New("").Funcs(funcs).Parse(`{{ repeat 2 "a" }}`))
+	if err := tmpl.Execute(&buf, nil); err == nil {
+		t.Fatal("expected an error for arguments of the wrong type")
+	}
+
+	// Plugins can't take the names of the functions evoke defines
+	if _, err := plugins.TemplateFuncs([]plugins.Plugin{mock}, template.FuncMap{"repeat": strings.Repeat}); err == nil || !strings.Contains(err.Error(), "already defines") {
+		t.Fatalf("expected an error for a builtin function, got %v", err)
+	}
+}
 
 func TestPlugin(t *testing.T) {
 	// Create a mock server
@@ -69,6 +158,662 @@ func TestPlugin(t *testing.T) {
 	if err := client.OnPreBuild(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
+
+	pages, err := client.GeneratePages()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(pages) != 1 || pages[0].Path != "api/users.md" || string(pages[0].Content) != "# Users" {
+		t.Fatalf("unexpected pages: %v", pages)
+	}
+}
+
+// preBuildPlugin is a mock plugin that only implements OnPreBuild.
+type preBuildPlugin struct {
+	mockPlugin
+}
+
+func (m *preBuildPlugin) Capabilities() []string {
+	return []string{plugins.HookOnPreBuild}
+}
+func (m *preBuildPlugin) GeneratePages() ([]*proto.GeneratedPage, error) {
+	m.calls++
+	return nil, nil
+}
+
+func TestPlugin_Capabilities(t *testing.T) {
+	// Create a mock server
+	mock := &preBuildPlugin{}
+	server := grpc.NewServer()
+	proto.RegisterPluginServer(server, &plugins.GRPCServer{Impl: mock})
+
+	// Create a listener
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Serve the server in a goroutine
+	go server.Serve(lis)
+
+	// Create a client
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer conn.Close()
+
+	// Hooks the plugin doesn't declare are skipped
+	client := &plugins.EvokeGRPCClient{Client: proto.NewPluginClient(conn)}
+	if err := client.LoadCapabilities(plugins.ProtocolVersion); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !client.Implements(plugins.HookOnPreBuild) || client.Implements(plugins.HookGeneratePages) {
+		t.Fatalf("unexpected capabilities")
+	}
+	if _, err := client.GeneratePages(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if mock.calls != 0 {
+		t.Fatalf("expected GeneratePages to be skipped")
+	}
+
+	// Plugins speaking protocol version 1 implement the original hooks
+	client = &plugins.EvokeGRPCClient{Client: proto.NewPluginClient(conn)}
+	if err := client.LoadCapabilities(1); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !client.Implements(plugins.HookProcessAsset) || client.Implements(plugins.HookGeneratePages) {
+		t.Fatalf("unexpected capabilities for protocol version 1")
+	}
+}
+
+// legacyPlugin only implements the Plugin interface.
+type legacyPlugin struct{}
+
+func (m *legacyPlugin) Name() string      { return "legacy" }
+func (m *legacyPlugin) OnPreBuild() error { return nil }
+func (m *legacyPlugin) OnConfigLoaded(config []byte) ([]byte, error) {
+	return config, nil
+}
+func (m *legacyPlugin) OnPublicAssetsCopied() error { return nil }
+func (m *legacyPlugin) OnContentLoaded(path string, content []byte) ([]byte, error) {
+	return append([]byte("loaded:"), content...), nil
+}
+func (m *legacyPlugin) OnContentRender(path string, content []byte) ([]byte, error) {
+	return content, nil
+}
+func (m *legacyPlugin) OnHTMLRendered(path string, content []byte) ([]byte, error) {
+	return content, nil
+}
+func (m *legacyPlugin) OnPostBuild() error { return nil }
+func (m *legacyPlugin) RegisterPipelines() ([]*proto.Pipeline, error) {
+	return nil, nil
+}
+func (m *legacyPlugin) ProcessAsset(asset *proto.Asset) (*proto.Asset, error) {
+	return asset, nil
+}
+
+func TestPlugin_Legacy(t *testing.T) {
+	server := grpc.NewServer()
+	proto.RegisterPluginServer(server, &plugins.GRPCServer{Impl: &legacyPlugin{}})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	go server.Serve(lis)
+	defer server.Stop()
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer conn.Close()
+
+	// Only the hooks of the optional interfaces the plugin implements are
+	// reported
+	client := &plugins.EvokeGRPCClient{Client: proto.NewPluginClient(conn)}
+	if err := client.LoadCapabilities(plugins.ProtocolVersion); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !client.Implements(plugins.HookOnContentLoaded) || client.Implements(plugins.HookGeneratePages) || client.Implements(plugins.HookConfigure) {
+		t.Fatalf("unexpected capabilities")
+	}
+
+	// The front matter sent to the content hooks is left unchanged
+	metadata, err := plugins.EncodeMetadata(map[string]interface{}{"title": "Home"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	file, err := client.OnContentLoadedFile(&proto.ContentFile{Path: "index.md", Content: []byte("content"), Metadata: metadata})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(file.Content) != "loaded:content" || file.Metadata != nil {
+		t.Fatalf("unexpected file: %v", file)
+	}
+}
+
+// batchPlugin is a mock plugin that records how many content hooks run at
+// the same time.
+type batchPlugin struct {
+	mockPlugin
+	concurrent bool
+	running    int32
+	maxRunning int32
+}
+
+func (m *batchPlugin) ConcurrencySafe() bool { return m.concurrent }
+func (m *batchPlugin) OnContentLoadedFile(file *proto.ContentFile) (*proto.ContentFile, error) {
+	running := atomic.AddInt32(&m.running, 1)
+	defer atomic.AddInt32(&m.running, -1)
+	for {
+		max := atomic.LoadInt32(&m.maxRunning)
+		if running <= max || atomic.CompareAndSwapInt32(&m.maxRunning, max, running) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	if file.Path == "bad.md" {
+		return nil, fmt.Errorf("bad file")
+	}
+	file.Content = append([]byte("loaded:"), file.Content...)
+	return file, nil
+}
+
+func TestPlugin_Batch(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		// Count the RPCs the host makes
+		var rpcs sync.Map
+		server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			n, _ := rpcs.LoadOrStore(info.FullMethod, new(int32))
+			atomic.AddInt32(n.(*int32), 1)
+			return handler(ctx, req)
+		}))
+		mock := &batchPlugin{concurrent: concurrent}
+		proto.RegisterPluginServer(server, &plugins.GRPCServer{Impl: mock})
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		go server.Serve(lis)
+		defer server.Stop()
+		conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		defer conn.Close()
+
+		client := &plugins.EvokeGRPCClient{Client: proto.NewPluginClient(conn)}
+		if err := client.LoadCapabilities(plugins.ProtocolVersion); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if client.ConcurrencySafe() != concurrent {
+			t.Fatalf("expected the plugin to be concurrency safe: %t", concurrent)
+		}
+
+		// Call the hook from many workers at once
+		const calls = 100
+		var wg sync.WaitGroup
+		errs := make([]error, calls)
+		results := make([]string, calls)
+		for i := 0; i < calls; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				path := fmt.Sprintf("page-%d.md", i)
+				if i == 0 {
+					path = "bad.md"
+				}
+				file, err := client.OnContentLoadedFile(&proto.ContentFile{Path: path, Content: []byte(path)})
+				errs[i] = err
+				if err == nil {
+					results[i] = string(file.Content)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		// Only the failing file fails
+		if errs[0] == nil {
+			t.Fatalf("expected an error for bad.md")
+		}
+		for i := 1; i < calls; i++ {
+			if errs[i] != nil {
+				t.Fatalf("err: %s", errs[i])
+			}
+			if expected := fmt.Sprintf("loaded:page-%d.md", i); results[i] != expected {
+				t.Fatalf("expected %q, got %q", expected, results[i])
+			}
+		}
+
+		if n, ok := rpcs.Load("/proto.Plugin/OnContentLoaded"); ok {
+			t.Fatalf("expected batched calls only, got %d single calls", *n.(*int32))
+		}
+		if !concurrent {
+			n, _ := rpcs.Load("/proto.Plugin/OnContentLoadedBatch")
+			if batches := atomic.LoadInt32(n.(*int32)); batches >= calls {
+				t.Fatalf("expected the calls to be batched, got %d batches", batches)
+			}
+			if mock.maxRunning != 1 {
+				t.Fatalf("expected one call at a time, got %d", mock.maxRunning)
+			}
+		}
+	}
+}
+
+func TestManager_Config(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	os.Chdir(tmpDir)
+	defer os.Chdir(originalWd)
+
+	// An executable that isn't a plugin fails to start if it's loaded
+	os.Mkdir("plugins", 0755)
+	os.WriteFile("plugins/broken", []byte("#!/bin/sh\nexit 1\n"), 0755)
+
+	// Disabled plugins aren't started
+	disabled := false
+	manager := plugins.NewManager()
+	defer manager.Kill()
+	loaded, err := manager.Load([]config.Plugin{{Name: "broken", Enabled: &disabled}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(loaded) != 0 {
+		t.Fatalf("expected no plugins, got %d", len(loaded))
+	}
+
+	// Listed plugins must exist
+	if _, err := manager.Load([]config.Plugin{{Name: "missing"}, {Name: "broken", Enabled: &disabled}}); err == nil {
+		t.Fatal("expected an error for a missing plugin")
+	}
+}
+
+func TestManager_Lock(t *testing.T) {
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	os.Chdir(tmpDir)
+	defer os.Chdir(originalWd)
+
+	os.Mkdir("plugins", 0755)
+	os.WriteFile("plugins/tampered", []byte("#!/bin/sh\nexit 1\n"), 0755)
+	lock := &plugins.Lock{}
+	lock.Set(plugins.LockedPlugin{Name: "tampered", Version: "1.0.0", Path: "plugins/tampered", SHA256: "0000"})
+	if err := lock.Write(plugins.LockFile); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Plugins not matching their checksum aren't started
+	manager := plugins.NewManager()
+	defer manager.Kill()
+	_, err = manager.Load(nil)
+	if err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("expected a checksum error, got %v", err)
+	}
+
+	statuses, err := plugins.Status("plugins", lock)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(statuses) != 1 || statuses[0].Status != plugins.StatusModified {
+		t.Fatalf("unexpected statuses: %v", statuses)
+	}
+}
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), plugins.LockFile)
+
+	// A missing lockfile is empty
+	lock, err := plugins.ReadLock(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(lock.Plugins) != 0 {
+		t.Fatalf("expected no plugins, got %v", lock.Plugins)
+	}
+
+	lock.Set(plugins.LockedPlugin{Name: "sitemap", Version: "1.0.0"})
+	lock.Set(plugins.LockedPlugin{Name: "search", Version: "1.0.0"})
+	lock.Set(plugins.LockedPlugin{Name: "sitemap", Version: "2.0.0"})
+	if err := lock.Write(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	lock, err = plugins.ReadLock(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(lock.Plugins) != 2 || lock.Plugins[0].Name != "search" || lock.Find("sitemap").Version != "2.0.0" {
+		t.Fatalf("unexpected plugins: %v", lock.Plugins)
+	}
+	if !lock.Remove("search") || lock.Remove("search") || lock.Find("search") != nil {
+		t.Fatalf("unexpected plugins after removing one: %v", lock.Plugins)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a plugin binary")
+	}
+	tmpDir := t.TempDir()
+	dir := filepath.Join(tmpDir, "plugins")
+
+	// Build the test plugin and archive it with a file it needs
+	src := filepath.Join(tmpDir, "src")
+	build := exec.Command("go", "build", "-o", filepath.Join(src, "crash"), "./testdata/crash")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("error building plugin: %s\n%s", err, out)
+	}
+	os.WriteFile(filepath.Join(src, "README"), []byte("crash"), 0644)
+	archive := filepath.Join(tmpDir, "crash.tar.gz")
+	tar := exec.Command("tar", "-czf", archive, "-C", src, ".")
+	if out, err := tar.CombinedOutput(); err != nil {
+		t.Fatalf("error archiving plugin: %s\n%s", err, out)
+	}
+
+	p, err := plugins.Install(archive, dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.Name != "crash" || p.Version != "1.0.0" || p.Path != filepath.Join(dir, "crash", "crash") || p.SHA256 == "" {
+		t.Fatalf("unexpected plugin: %+v", p)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "crash", "README")); err != nil {
+		t.Fatalf("expected the files of the archive to be installed: %s", err)
+	}
+	if err := p.Verify(p.Path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Reinstalling the plugin in place keeps it
+	again, err := plugins.Install(p.Path, dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if again.Path != p.Path || again.SHA256 != p.SHA256 {
+		t.Fatalf("unexpected plugin: %+v", again)
+	}
+
+	if err := plugins.Uninstall(p, dir); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "crash")); !os.IsNotExist(err) {
+		t.Fatalf("expected the plugin directory to be removed, got %v", err)
+	}
+}
+
+func TestManager_Lifecycle(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a plugin binary")
+	}
+
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Build the test plugin
+	binary := filepath.Join(tmpDir, "plugins", "crash", "crash")
+	build := exec.Command("go", "build", "-o", binary, "./testdata/crash")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("error building plugin: %s\n%s", err, out)
+	}
+
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	os.Chdir(tmpDir)
+	defer os.Chdir(originalWd)
+
+	manager := plugins.NewManager()
+	defer manager.Kill()
+	load := func() plugins.Plugin {
+		t.Helper()
+		loaded, err := manager.Load(nil)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if len(loaded) != 1 || loaded[0].Name() != "crash" {
+			t.Fatalf("unexpected plugins: %v", loaded)
+		}
+		return loaded[0]
+	}
+
+	// Running plugins are reused
+	first := load()
+	if load() != first {
+		t.Fatal("expected the running plugin to be reused")
+	}
+
+	// Plugins whose process exited are restarted
+	first.OnPostBuild()
+	time.Sleep(100 * time.Millisecond)
+	second := load()
+	if second == first {
+		t.Fatal("expected the exited plugin to be restarted")
+	}
+	if err := second.OnPreBuild(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Plugins whose binary changed are reloaded
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(binary, later, later)
+	if load() == second {
+		t.Fatal("expected the changed plugin to be reloaded")
+	}
+}
+
+func TestManager_Sandbox(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a plugin binary")
+	}
+	tmpDir := t.TempDir()
+
+	// Build the test plugin
+	build := exec.Command("go", "build", "-o", filepath.Join(tmpDir, "plugins", "sandbox"), "./testdata/sandbox")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("error building plugin: %s\n%s", err, out)
+	}
+
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	os.Chdir(tmpDir)
+	defer os.Chdir(originalWd)
+
+	t.Setenv("EVOKE_TEST_SECRET", "secret")
+	t.Setenv("EVOKE_TEST_ALLOWED", "allowed")
+	manager := plugins.NewManager()
+	defer manager.Kill()
+	loaded, err := manager.Load([]config.Plugin{{
+		Name: "sandbox",
+		Sandbox: config.Sandbox{
+			Env:     []string{"EVOKE_TEST_ALLOWED"},
+			WorkDir: "work",
+			Timeout: 500 * time.Millisecond,
+			Memory:  256,
+			CPU:     10,
+		},
+	}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	p := loaded[0]
+	call := func(name string, args ...string) (string, error) {
+		t.Helper()
+		raw, _ := json.Marshal(args)
+		result, err := p.(plugins.TemplateFuncProvider).CallTemplateFunction(name, raw)
+		if err != nil {
+			return "", err
+		}
+		var s string
+		json.Unmarshal(result, &s)
+		return s, nil
+	}
+
+	// Only the allowed environment variables are passed to the plugin
+	if value, err := call("env", "EVOKE_TEST_SECRET"); err != nil || value != "" {
+		t.Fatalf("expected the secret to be hidden, got %q, %v", value, err)
+	}
+	if value, err := call("env", "EVOKE_TEST_ALLOWED"); err != nil || value != "allowed" {
+		t.Fatalf("expected the allowed variable, got %q, %v", value, err)
+	}
+
+	// The plugin runs in its working directory
+	if dir, err := call("cwd"); err != nil || filepath.Base(dir) != "work" {
+		t.Fatalf("expected the plugin to run in its working directory, got %q, %v", dir, err)
+	}
+
+	// The resource limits apply to the plugin process
+	if runtime.GOOS == "linux" {
+		limits, err := call("limits")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !regexp.MustCompile(`Max cpu time\s+10\s+10\s`).MatchString(limits) {
+			t.Fatalf("expected the CPU time to be limited, got:\n%s", limits)
+		}
+		if !regexp.MustCompile(`Max data size\s+268435456\s+268435456\s`).MatchString(limits) {
+			t.Fatalf("expected the memory to be limited, got:\n%s", limits)
+		}
+	}
+
+	// Calls taking too long fail, naming the plugin
+	_, err = call("sleep")
+	if err == nil || !strings.Contains(err.Error(), "plugin sandbox") || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+
+	// Without a working directory, the plugin gets a temporary one, removed
+	// once it's stopped
+	loaded, err = manager.Load([]config.Plugin{{Name: "sandbox"}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	p = loaded[0]
+	dir, err := call("cwd")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if project, _ := os.Getwd(); dir == project || strings.HasPrefix(dir, project+string(filepath.Separator)) {
+		t.Fatalf("expected the plugin to run outside of the project, got %q", dir)
+	}
+	manager.Kill()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected the working directory to be removed, got %v", err)
+	}
+}
+
+func TestManager_Wasm(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a plugin module")
+	}
+
+	// Create a temporary directory for the test
+	tmpDir, err := os.MkdirTemp("", "evoke-test")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Build the test plugin
+	module := filepath.Join(tmpDir, "plugins", "prefix.wasm")
+	build := exec.Command("go", "build", "-o", module, "./testdata/wasm")
+	build.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("error building plugin: %s\n%s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "prefix.txt"), []byte("prefix:"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	os.Chdir(tmpDir)
+	defer os.Chdir(originalWd)
+
+	manager := plugins.NewManager()
+	defer manager.Kill()
+	loaded, err := manager.Load(nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(loaded) != 1 || loaded[0].Name() != "prefix" {
+		t.Fatalf("unexpected plugins: %v", loaded)
+	}
+
+	// The project directory is only mounted when it's the working directory
+	if _, err := loaded[0].OnContentLoaded("prefix.txt", nil); err == nil {
+		t.Fatal("expected an error reading a file of the project")
+	}
+	loaded, err = manager.Load([]config.Plugin{{Name: "prefix", Sandbox: config.Sandbox{WorkDir: "."}}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	p := loaded[0]
+
+	// The plugin reads files from the project directory
+	content, err := p.OnContentLoaded("prefix.txt", []byte("content"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(content) != "prefix:content" {
+		t.Fatalf("unexpected content: %s", content)
+	}
+
+	// But not from outside of it
+	outside := filepath.Join(originalWd, "plugins_test.go")
+	if _, err := p.OnContentLoaded(outside, nil); err == nil {
+		t.Fatal("expected an error reading a file outside the project")
+	}
+	if _, err := p.OnContentLoaded("../"+filepath.Base(tmpDir)+"/prefix.txt", nil); err == nil {
+		t.Fatal("expected an error reading a file through the parent directory")
+	}
+
+	// Hooks the plugin doesn't implement aren't called
+	if err := p.OnPostBuild(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The project directory is read-only unless the sandbox makes it writable
+	if err := p.OnPreBuild(); err == nil {
+		t.Fatal("expected an error writing to the project directory")
+	}
+	loaded, err = manager.Load([]config.Plugin{{Name: "prefix", Sandbox: config.Sandbox{WorkDir: ".", Writable: true}}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := loaded[0].OnPreBuild(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := os.Stat("written.txt"); err != nil {
+		t.Fatalf("expected the plugin to write to the project directory: %s", err)
+	}
 }
 
 func BenchmarkPlugin(b *testing.B) {
@@ -107,3 +852,31 @@ func BenchmarkPlugin(b *testing.B) {
 		}
 	}
 }
+
+func TestMergeMetadata(t *testing.T) {
+	date := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	metadata := map[string]interface{}{"title": "Home", "date": date, "draft": false}
+	sent, err := plugins.EncodeMetadata(metadata)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A plugin returning no metadata leaves it unchanged
+	if merged := plugins.MergeMetadata(metadata, sent, nil); !reflect.DeepEqual(merged, metadata) {
+		t.Fatalf("unexpected metadata: %v", merged)
+	}
+
+	returned, err := structpb.NewStruct(map[string]interface{}{
+		"title":       "Home",
+		"date":        "2024-01-02T00:00:00Z",
+		"readingTime": 3,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	merged := plugins.MergeMetadata(metadata, sent, returned)
+	expected := map[string]interface{}{"title": "Home", "date": date, "readingTime": float64(3)}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Fatalf("expected %v, got %v", expected, merged)
+	}
+}
@@ -0,0 +1,116 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bitlatte/evoke/pkg/config"
+	"google.golang.org/grpc"
+)
+
+// DefaultTimeout is the longest a call to a plugin may take when its sandbox
+// doesn't set a timeout.
+const DefaultTimeout = 5 * time.Minute
+
+// ExecCommand is the hidden command of evoke starting a plugin with resource
+// limits, run as "evoke exec-plugin <memory> <cpu> <path>". It calls
+// ExecLimited with its arguments. Programs loading plugins with resource
+// limits must handle it the same way.
+const ExecCommand = "exec-plugin"
+
+// defaultEnv are the environment variables passed to every plugin.
+var defaultEnv = []string{"PATH", "TMPDIR", "TEMP", "TMP", "LANG", "LC_ALL", "TZ", "SYSTEMROOT"}
+
+// sandboxEnv returns the variables of the environment of evoke that the
+// plugin is allowed to see.
+func sandboxEnv(sandbox config.Sandbox) []string {
+	var env []string
+	for _, name := range append(append([]string{}, defaultEnv...), sandbox.Env...) {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// sandboxDir returns the absolute path of the working directory of the
+// plugin, creating it if needed, and the function to call once the plugin is
+// stopped. A plugin without a working directory gets a temporary one of its
+// own, removed once it's stopped, so that it only sees the project if it's
+// configured to.
+func sandboxDir(sandbox config.Sandbox) (string, func(), error) {
+	if sandbox.WorkDir == "" {
+		dir, err := os.MkdirTemp("", "evoke-plugin-")
+		if err != nil {
+			return "", nil, err
+		}
+		return dir, func() { os.RemoveAll(dir) }, nil
+	}
+	dir, err := filepath.Abs(sandbox.WorkDir)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nil, err
+	}
+	return dir, func() {}, nil
+}
+
+// cleanupProcess is a plugin whose working directory is cleaned up once it's
+// stopped.
+type cleanupProcess struct {
+	process
+	cleanup func()
+	once    sync.Once
+}
+
+// Kill stops the plugin and cleans up its working directory.
+func (p *cleanupProcess) Kill() {
+	p.process.Kill()
+	p.once.Do(p.cleanup)
+}
+
+// sandboxTimeout returns the longest a call to the plugin may take.
+func sandboxTimeout(sandbox config.Sandbox) time.Duration {
+	if sandbox.Timeout > 0 {
+		return sandbox.Timeout
+	}
+	return DefaultTimeout
+}
+
+// callGuard enforces the timeout of the calls to a plugin and names the
+// plugin in the errors they return, so that a misbehaving plugin is easy to
+// spot in a failed build.
+type callGuard struct {
+	name    string
+	timeout time.Duration
+	// exited reports whether the plugin exited, e.g. because it exceeded its
+	// resource limits.
+	exited func() bool
+}
+
+// intercept is a grpc.UnaryClientInterceptor making the call with the
+// timeout.
+func (g *callGuard) intercept(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if err == nil {
+		return nil
+	}
+
+	hook := method[strings.LastIndex(method, "/")+1:]
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("plugin %s: %s timed out after %s", g.name, hook, g.timeout)
+	case g.exited != nil && g.exited():
+		return fmt.Errorf("plugin %s exited during %s, it may have exceeded its resource limits: %w", g.name, hook, err)
+	}
+	return fmt.Errorf("plugin %s: %w", g.name, err)
+}
@@ -0,0 +1,62 @@
+package plugins
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"github.com/Bitlatte/evoke/pkg/config"
+	"golang.org/x/sys/unix"
+)
+
+// ExecLimited applies the resource limits and runs the plugin in place of
+// the current process, so that the plugin is limited from its first
+// instruction. The arguments are the memory limit in megabytes, the CPU limit
+// in seconds and the path of the plugin, as passed to ExecCommand.
+func ExecLimited(args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("expected the memory limit, the CPU limit and the plugin to start")
+	}
+	memory, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid memory limit %q: %w", args[0], err)
+	}
+	cpu, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid CPU limit %q: %w", args[1], err)
+	}
+	if memory > 0 {
+		limit := uint64(memory) << 20
+		if err := unix.Setrlimit(unix.RLIMIT_DATA, &unix.Rlimit{Cur: limit, Max: limit}); err != nil {
+			return fmt.Errorf("error limiting memory: %w", err)
+		}
+	}
+	if cpu > 0 {
+		limit := uint64(cpu)
+		if err := unix.Setrlimit(unix.RLIMIT_CPU, &unix.Rlimit{Cur: limit, Max: limit}); err != nil {
+			return fmt.Errorf("error limiting CPU time: %w", err)
+		}
+	}
+	return syscall.Exec(args[2], args[2:], os.Environ())
+}
+
+// sandboxCommand returns the command starting the plugin at path with the
+// environment of its sandbox. A plugin with resource limits is started by
+// running the current executable with ExecCommand, which applies them before
+// running the plugin.
+func sandboxCommand(path string, sandbox config.Sandbox) (*exec.Cmd, error) {
+	if sandbox.Memory <= 0 && sandbox.CPU <= 0 {
+		cmd := exec.Command(path)
+		cmd.Env = sandboxEnv(sandbox)
+		return cmd, nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(self, ExecCommand, strconv.Itoa(sandbox.Memory), strconv.Itoa(sandbox.CPU), path)
+	cmd.Env = sandboxEnv(sandbox)
+	return cmd, nil
+}
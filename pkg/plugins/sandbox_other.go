@@ -0,0 +1,28 @@
+//go:build !linux
+
+package plugins
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/Bitlatte/evoke/pkg/config"
+	"github.com/Bitlatte/evoke/pkg/logger"
+)
+
+// sandboxCommand returns the command starting the plugin at path with the
+// environment of its sandbox. It warns that resource limits are only
+// enforced on Linux.
+func sandboxCommand(path string, sandbox config.Sandbox) (*exec.Cmd, error) {
+	if sandbox.Memory > 0 || sandbox.CPU > 0 {
+		logger.Logger.Warn("Plugin resource limits are only enforced on Linux")
+	}
+	cmd := exec.Command(path)
+	cmd.Env = sandboxEnv(sandbox)
+	return cmd, nil
+}
+
+// ExecLimited fails, as resource limits are only enforced on Linux.
+func ExecLimited(args []string) error {
+	return fmt.Errorf("plugin resource limits are only enforced on Linux")
+}
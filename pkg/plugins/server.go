@@ -3,17 +3,69 @@ package plugins
 
 import (
 	"context"
+	"fmt"
+	"slices"
 
+	"github.com/Bitlatte/evoke/pkg/plugin/api"
 	"github.com/Bitlatte/evoke/proto"
+	"github.com/hashicorp/go-plugin"
 )
 
 // GRPCServer is the gRPC server that GRPCClient talks to.
 type GRPCServer struct {
 	// Impl is the real implementation of the plugin.
 	Impl Plugin
+	// broker is used to reach the Host service.
+	broker *plugin.GRPCBroker
 	proto.UnimplementedPluginServer
 }
 
+// GetCapabilities reports the hooks the plugin implements.
+func (m *GRPCServer) GetCapabilities(ctx context.Context, req *proto.GetCapabilitiesRequest) (*proto.GetCapabilitiesResponse, error) {
+	hooks := implementedHooks(m.Impl)
+	if p, ok := m.Impl.(CapabilitiesProvider); ok {
+		hooks = append([]string(nil), p.Capabilities()...)
+	}
+	if _, ok := m.Impl.(HostConnector); ok && !slices.Contains(hooks, HookConnectHost) {
+		hooks = append(hooks, HookConnectHost)
+	}
+	// The server implements the batched variants of the hooks
+	for _, hook := range hooks {
+		if batch, ok := batchHooks[hook]; ok && !slices.Contains(hooks, batch) {
+			hooks = append(hooks, batch)
+		}
+	}
+	concurrencySafe := false
+	if p, ok := m.Impl.(ConcurrencyProvider); ok {
+		concurrencySafe = p.ConcurrencySafe()
+	}
+	return &proto.GetCapabilitiesResponse{Hooks: hooks, ConcurrencySafe: concurrencySafe}, nil
+}
+
+// GetMetadata returns the name, version and description of the plugin.
+func (m *GRPCServer) GetMetadata(ctx context.Context, req *proto.GetMetadataRequest) (*proto.PluginMetadata, error) {
+	return api.Metadata(m.Impl)
+}
+
+// Configure is called with the settings of the plugin from evoke.yaml.
+func (m *GRPCServer) Configure(ctx context.Context, req *proto.ConfigureRequest) (*proto.ConfigureResponse, error) {
+	return &proto.ConfigureResponse{}, api.Configure(m.Impl, []byte(req.SettingsJson))
+}
+
+// ConnectHost connects to the Host service and hands it to the plugin.
+func (m *GRPCServer) ConnectHost(ctx context.Context, req *proto.ConnectHostRequest) (*proto.ConnectHostResponse, error) {
+	connector, ok := m.Impl.(HostConnector)
+	if !ok {
+		return &proto.ConnectHostResponse{}, nil
+	}
+	conn, err := m.broker.Dial(req.BrokerId)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to host: %w", err)
+	}
+	connector.SetHost(&HostGRPCClient{Client: proto.NewHostClient(conn)})
+	return &proto.ConnectHostResponse{}, nil
+}
+
 // OnPreBuild is called before the build process starts.
 func (m *GRPCServer) OnPreBuild(ctx context.Context, req *proto.PreBuildRequest) (*proto.PreBuildResponse, error) {
 	return &proto.PreBuildResponse{}, m.Impl.OnPreBuild()
@@ -35,29 +87,52 @@ func (m *GRPCServer) OnPublicAssetsCopied(ctx context.Context, req *proto.Public
 
 // OnContentLoaded is called after a content file is loaded.
 func (m *GRPCServer) OnContentLoaded(ctx context.Context, req *proto.ContentFile) (*proto.ContentFile, error) {
-	content, err := m.Impl.OnContentLoaded(req.Path, req.Content)
-	if err != nil {
-		return nil, err
-	}
-	return &proto.ContentFile{Path: req.Path, Content: content}, nil
+	return api.ContentLoaded(m.Impl, req)
 }
 
-// OnContentRender is called after a content file is rendered.
+// OnContentRender is called before a page is rendered, with its body and
+// front matter.
 func (m *GRPCServer) OnContentRender(ctx context.Context, req *proto.ContentFile) (*proto.ContentFile, error) {
-	content, err := m.Impl.OnContentRender(req.Path, req.Content)
-	if err != nil {
-		return nil, err
-	}
-	return &proto.ContentFile{Path: req.Path, Content: content}, nil
+	return api.ContentRender(m.Impl, req)
 }
 
-// OnHTMLRendered is called after the HTML is rendered.
+// OnHTMLRendered is called after a page is rendered to HTML, before it is
+// placed in its layouts.
 func (m *GRPCServer) OnHTMLRendered(ctx context.Context, req *proto.ContentFile) (*proto.ContentFile, error) {
-	content, err := m.Impl.OnHTMLRendered(req.Path, req.Content)
-	if err != nil {
-		return nil, err
+	return api.HTMLRendered(m.Impl, req)
+}
+
+// OnContentLoadedBatch calls OnContentLoaded for each file of the batch.
+func (m *GRPCServer) OnContentLoadedBatch(ctx context.Context, req *proto.ContentFileBatch) (*proto.ContentFileBatchResponse, error) {
+	return processContentFiles(req, m.Impl, api.ContentLoaded), nil
+}
+
+// OnContentRenderBatch calls OnContentRender for each file of the batch.
+func (m *GRPCServer) OnContentRenderBatch(ctx context.Context, req *proto.ContentFileBatch) (*proto.ContentFileBatchResponse, error) {
+	return processContentFiles(req, m.Impl, api.ContentRender), nil
+}
+
+// OnHTMLRenderedBatch calls OnHTMLRendered for each file of the batch.
+func (m *GRPCServer) OnHTMLRenderedBatch(ctx context.Context, req *proto.ContentFileBatch) (*proto.ContentFileBatchResponse, error) {
+	return processContentFiles(req, m.Impl, api.HTMLRendered), nil
+}
+
+// processContentFiles runs the hook of the plugin on each file of the batch.
+func processContentFiles(batch *proto.ContentFileBatch, p Plugin, hook func(Plugin, *proto.ContentFile) (*proto.ContentFile, error)) *proto.ContentFileBatchResponse {
+	resp := &proto.ContentFileBatchResponse{
+		Files:  make([]*proto.ContentFile, len(batch.Files)),
+		Errors: make([]string, len(batch.Files)),
+	}
+	for i, file := range batch.Files {
+		out, err := hook(p, file)
+		if err != nil {
+			resp.Files[i] = &proto.ContentFile{}
+			resp.Errors[i] = err.Error()
+			continue
+		}
+		resp.Files[i] = out
 	}
-	return &proto.ContentFile{Path: req.Path, Content: content}, nil
+	return resp
 }
 
 // OnPostBuild is called after the build process is finished.
@@ -78,3 +153,51 @@ func (m *GRPCServer) RegisterPipelines(ctx context.Context, req *proto.RegisterP
 func (m *GRPCServer) ProcessAsset(ctx context.Context, req *proto.Asset) (*proto.Asset, error) {
 	return m.Impl.ProcessAsset(req)
 }
+
+// ProcessAssetBatch calls ProcessAsset for each asset of the batch.
+func (m *GRPCServer) ProcessAssetBatch(ctx context.Context, req *proto.AssetBatch) (*proto.AssetBatchResponse, error) {
+	resp := &proto.AssetBatchResponse{
+		Assets: make([]*proto.Asset, len(req.Assets)),
+		Errors: make([]string, len(req.Assets)),
+	}
+	for i, asset := range req.Assets {
+		out, err := m.Impl.ProcessAsset(asset)
+		if err != nil {
+			resp.Assets[i] = &proto.Asset{}
+			resp.Errors[i] = err.Error()
+			continue
+		}
+		resp.Assets[i] = out
+	}
+	return resp, nil
+}
+
+// GeneratePages is called to add pages that don't exist in the content
+// directory.
+func (m *GRPCServer) GeneratePages(ctx context.Context, req *proto.GeneratePagesRequest) (*proto.GeneratePagesResponse, error) {
+	pages, err := api.GeneratePages(m.Impl)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.GeneratePagesResponse{Pages: pages}, nil
+}
+
+// RegisterTemplateFunctions is called to register functions that templates
+// can call.
+func (m *GRPCServer) RegisterTemplateFunctions(ctx context.Context, req *proto.RegisterTemplateFunctionsRequest) (*proto.RegisterTemplateFunctionsResponse, error) {
+	functions, err := api.RegisterTemplateFunctions(m.Impl)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.RegisterTemplateFunctionsResponse{Functions: functions}, nil
+}
+
+// CallTemplateFunction is called when a template calls a function registered
+// by the plugin.
+func (m *GRPCServer) CallTemplateFunction(ctx context.Context, req *proto.CallTemplateFunctionRequest) (*proto.CallTemplateFunctionResponse, error) {
+	result, err := api.CallTemplateFunction(m.Impl, req.Name, []byte(req.ArgumentsJson))
+	if err != nil {
+		return nil, err
+	}
+	return &proto.CallTemplateFunctionResponse{ResultJson: string(result)}, nil
+}
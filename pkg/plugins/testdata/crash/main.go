@@ -0,0 +1,49 @@
+// Command crash is a plugin used by the tests of the plugin manager. Its
+// process exits when the OnPostBuild hook is called.
+package main
+
+import (
+	"os"
+
+	"github.com/Bitlatte/evoke/pkg/plugins"
+	"github.com/Bitlatte/evoke/proto"
+	"github.com/hashicorp/go-plugin"
+)
+
+type crashPlugin struct{}
+
+func (p *crashPlugin) Name() string                                  { return "crash" }
+func (p *crashPlugin) Configure(settings []byte) error               { return nil }
+func (p *crashPlugin) OnPreBuild() error                             { return nil }
+func (p *crashPlugin) OnConfigLoaded(config []byte) ([]byte, error)  { return config, nil }
+func (p *crashPlugin) OnPublicAssetsCopied() error                   { return nil }
+func (p *crashPlugin) RegisterPipelines() ([]*proto.Pipeline, error) { return nil, nil }
+func (p *crashPlugin) OnContentLoaded(path string, content []byte) ([]byte, error) {
+	return content, nil
+}
+func (p *crashPlugin) OnContentRender(path string, content []byte) ([]byte, error) {
+	return content, nil
+}
+func (p *crashPlugin) OnHTMLRendered(path string, content []byte) ([]byte, error) {
+	return content, nil
+}
+func (p *crashPlugin) OnPostBuild() error {
+	os.Exit(1)
+	return nil
+}
+func (p *crashPlugin) ProcessAsset(asset *proto.Asset) (*proto.Asset, error) {
+	return asset, nil
+}
+func (p *crashPlugin) Metadata() (*proto.PluginMetadata, error) {
+	return &proto.PluginMetadata{Name: "crash", Version: "1.0.0"}, nil
+}
+
+func main() {
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig: plugins.Handshake,
+		Plugins: map[string]plugin.Plugin{
+			"evoke": &plugins.EvokePlugin{Impl: &crashPlugin{}},
+		},
+		GRPCServer: plugin.DefaultGRPCServer,
+	})
+}
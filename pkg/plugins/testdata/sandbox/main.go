@@ -0,0 +1,51 @@
+// Command sandbox is a plugin used by the tests of the plugin sandbox. Its
+// template functions report what the plugin can see.
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/Bitlatte/evoke/pkg/plugin/sdk"
+	"github.com/Bitlatte/evoke/proto"
+)
+
+type sandboxPlugin struct {
+	sdk.Base
+}
+
+func (p *sandboxPlugin) Metadata() (*proto.PluginMetadata, error) {
+	return &proto.PluginMetadata{Name: "sandbox", Version: "1.0.0"}, nil
+}
+
+func (p *sandboxPlugin) CallTemplateFunction(name string, args []byte) ([]byte, error) {
+	var result string
+	switch name {
+	case "env":
+		var names []string
+		if err := json.Unmarshal(args, &names); err != nil {
+			return nil, err
+		}
+		result = os.Getenv(names[0])
+	case "cwd":
+		dir, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		result = dir
+	case "limits":
+		limits, err := os.ReadFile("/proc/self/limits")
+		if err != nil {
+			return nil, err
+		}
+		result = string(limits)
+	case "sleep":
+		time.Sleep(10 * time.Second)
+	}
+	return json.Marshal(result)
+}
+
+func main() {
+	sdk.Serve(&sandboxPlugin{})
+}
@@ -0,0 +1,40 @@
+// Command wasm is a WebAssembly plugin used by the tests of the plugin
+// manager. It prefixes the content files it loads with the content of
+// prefix.txt in the project directory, and writes written.txt before the
+// build.
+package main
+
+import (
+	"os"
+
+	"github.com/Bitlatte/evoke/pkg/plugin/wasm"
+	"github.com/Bitlatte/evoke/proto"
+)
+
+type prefixPlugin struct {
+	wasm.Base
+}
+
+func (p *prefixPlugin) Metadata() (*proto.PluginMetadata, error) {
+	return &proto.PluginMetadata{Name: "prefix", Version: "1.0.0"}, nil
+}
+
+func (p *prefixPlugin) OnContentLoaded(path string, content []byte) ([]byte, error) {
+	prefix, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return append(prefix, content...), nil
+}
+
+func (p *prefixPlugin) OnPreBuild() error {
+	return os.WriteFile("written.txt", []byte("written"), 0644)
+}
+
+func (p *prefixPlugin) Capabilities() []string {
+	return []string{"GetMetadata", "OnPreBuild", "OnContentLoaded"}
+}
+
+func main() {
+	wasm.Serve(&prefixPlugin{})
+}
@@ -0,0 +1,262 @@
+package plugins
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bitlatte/evoke/pkg/config"
+	"github.com/Bitlatte/evoke/pkg/logger"
+	"github.com/Bitlatte/evoke/proto"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+	"google.golang.org/grpc"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// maxWasmFrame is the size of the largest message exchanged with a
+// WebAssembly plugin.
+const maxWasmFrame = 64 << 20
+
+// wasmConn is the connection to a WebAssembly plugin. Calls are sent to the
+// plugin's stdin and responses read from its stdout, as WasmRequest and
+// WasmResponse messages preceded by their length. It implements
+// grpc.ClientConnInterface, so that WebAssembly plugins are used through the
+// same client as the other plugins.
+type wasmConn struct {
+	mu     sync.Mutex
+	stdin  io.Writer
+	stdout io.Reader
+	guard  *callGuard
+	// kill stops the plugin when a call times out.
+	kill func()
+}
+
+// Invoke calls the RPC of the Plugin service named by method, with the
+// timeout of the plugin.
+func (c *wasmConn) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	return c.guard.intercept(ctx, method, args, reply, nil, c.invoke)
+}
+
+// invoke calls the RPC. A plugin still busy when the context is done is
+// stopped, as it can't be interrupted otherwise.
+func (c *wasmConn) invoke(ctx context.Context, method string, args, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() { done <- c.call(method, args, reply) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		c.kill()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// call sends the call and reads the response.
+func (c *wasmConn) call(method string, args, reply interface{}) error {
+	payload, err := protobuf.Marshal(args.(protobuf.Message))
+	if err != nil {
+		return err
+	}
+	req, err := protobuf.Marshal(&proto.WasmRequest{
+		Method:  method[strings.LastIndex(method, "/")+1:],
+		Payload: payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := writeWasmFrame(c.stdin, req); err != nil {
+		return fmt.Errorf("error calling plugin: %w", err)
+	}
+	frame, err := readWasmFrame(c.stdout)
+	if err != nil {
+		return fmt.Errorf("error reading the response of the plugin: %w", err)
+	}
+
+	var resp proto.WasmResponse
+	if err := protobuf.Unmarshal(frame, &resp); err != nil {
+		return fmt.Errorf("error decoding the response of the plugin: %w", err)
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	return protobuf.Unmarshal(resp.Payload, reply.(protobuf.Message))
+}
+
+// NewStream fails, as WebAssembly plugins don't support streams.
+func (c *wasmConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, fmt.Errorf("WebAssembly plugins don't support streams")
+}
+
+// writeWasmFrame writes a message preceded by its length.
+func writeWasmFrame(w io.Writer, msg []byte) error {
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(msg)))
+	if _, err := w.Write(size[:]); err != nil || len(msg) == 0 {
+		// An empty write would wait on a pipe for a read that never comes
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+// readWasmFrame reads a message preceded by its length.
+func readWasmFrame(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(size[:])
+	if n > maxWasmFrame {
+		return nil, fmt.Errorf("message of %d bytes is too large", n)
+	}
+	msg := make([]byte, n)
+	_, err := io.ReadFull(r, msg)
+	return msg, err
+}
+
+// wasmProcess is a running WebAssembly plugin.
+type wasmProcess struct {
+	runtime wazero.Runtime
+	stdin   io.Closer
+	stdout  *io.PipeReader
+	// cancel interrupts the plugin.
+	cancel context.CancelFunc
+	exited chan struct{}
+	once   sync.Once
+}
+
+// Kill stops the plugin. Closing its stdin ends its serve loop, closing its
+// stdout fails the writes nobody reads anymore, and the plugin is interrupted
+// if it doesn't exit on its own.
+func (p *wasmProcess) Kill() {
+	p.once.Do(func() {
+		p.stdin.Close()
+		p.stdout.CloseWithError(io.ErrClosedPipe)
+		select {
+		case <-p.exited:
+		case <-time.After(time.Second):
+			p.cancel()
+			<-p.exited
+		}
+		p.runtime.Close(context.Background())
+	})
+}
+
+// Exited reports whether the plugin exited.
+func (p *wasmProcess) Exited() bool {
+	select {
+	case <-p.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// startWasmPlugin runs a WebAssembly plugin in-process and connects to it.
+// The plugin runs as a WASI command with its working directory mounted as its
+// root directory, read-only unless its sandbox makes it writable. It has no
+// access to the rest of the file system, the network, the host services, or
+// the environment besides the variables allowed by its sandbox.
+func startWasmPlugin(cfg config.Plugin) (process, *EvokeGRPCClient, error) {
+	logger.Logger.Debug("Starting WebAssembly plugin", "plugin", cfg.Name, "path", cfg.Path)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	code, err := os.ReadFile(cfg.Path)
+	if err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("error starting plugin %s: %w", cfg.Name, err)
+	}
+	runtimeConfig := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if cfg.Sandbox.Memory > 0 {
+		// Memory is limited in pages of 64KiB
+		runtimeConfig = runtimeConfig.WithMemoryLimitPages(uint32(cfg.Sandbox.Memory) << 4)
+	}
+	r := wazero.NewRuntimeWithConfig(ctx, runtimeConfig)
+	wasi_snapshot_preview1.MustInstantiate(ctx, r)
+	compiled, err := r.CompileModule(ctx, code)
+	if err != nil {
+		r.Close(ctx)
+		cancel()
+		return nil, nil, fmt.Errorf("error compiling plugin %s: %w", cfg.Name, err)
+	}
+
+	dir, cleanup, err := sandboxDir(cfg.Sandbox)
+	if err != nil {
+		r.Close(ctx)
+		cancel()
+		return nil, nil, fmt.Errorf("error creating working directory of plugin %s: %w", cfg.Name, err)
+	}
+	fsConfig := wazero.NewFSConfig().WithReadOnlyDirMount(dir, "/")
+	if cfg.Sandbox.Writable {
+		fsConfig = wazero.NewFSConfig().WithDirMount(dir, "/")
+	}
+
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	moduleConfig := wazero.NewModuleConfig().
+		WithName(cfg.Name).
+		WithArgs(cfg.Name).
+		WithStdin(stdinR).
+		WithStdout(stdoutW).
+		WithStderr(newPluginLogWriter(cfg.Name)).
+		WithFSConfig(fsConfig).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithSysNanosleep().
+		WithRandSource(rand.Reader)
+	for _, variable := range sandboxEnv(cfg.Sandbox) {
+		name, value, _ := strings.Cut(variable, "=")
+		moduleConfig = moduleConfig.WithEnv(name, value)
+	}
+
+	proc := &wasmProcess{runtime: r, stdin: stdinW, stdout: stdoutR, cancel: cancel, exited: make(chan struct{})}
+	go func() {
+		defer close(proc.exited)
+		_, err := r.InstantiateModule(ctx, compiled, moduleConfig)
+		var exitErr *sys.ExitError
+		if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 0) {
+			logger.Logger.Warn("Plugin exited", "plugin", cfg.Name, "error", err)
+		}
+		stdinR.CloseWithError(io.ErrClosedPipe)
+		stdoutW.CloseWithError(io.EOF)
+	}()
+
+	sandboxed := &cleanupProcess{process: proc, cleanup: cleanup}
+
+	guard := &callGuard{name: cfg.Name, timeout: sandboxTimeout(cfg.Sandbox), exited: proc.Exited}
+	conn := &wasmConn{stdin: stdinW, stdout: bufio.NewReader(stdoutR), guard: guard, kill: cancel}
+	p := &EvokeGRPCClient{Client: proto.NewPluginClient(conn), name: cfg.Name}
+	if err := p.LoadCapabilities(ProtocolVersion); err != nil {
+		sandboxed.Kill()
+		return nil, nil, fmt.Errorf("error getting capabilities of plugin %s: %w", cfg.Name, err)
+	}
+	// The host services are served over the go-plugin broker, which
+	// WebAssembly plugins have no connection to
+	if p.Implements(HookConnectHost) {
+		sandboxed.Kill()
+		return nil, nil, fmt.Errorf("plugin %s asks for the host services, which WebAssembly plugins can't use", cfg.Name)
+	}
+	metadata, err := p.Metadata()
+	if err != nil {
+		sandboxed.Kill()
+		return nil, nil, fmt.Errorf("error getting metadata of plugin %s: %w", cfg.Name, err)
+	}
+	p.name = metadata.Name
+	guard.name = metadata.Name
+	return sandboxed, p, nil
+}
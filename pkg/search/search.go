@@ -0,0 +1,305 @@
+// Package search builds the search index of the generated site, which the
+// search widget loads to search the site in the browser.
+package search
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// IndexFile is the name of the file, in the output directory, holding the
+// index or the list of its shards.
+const IndexFile = "search.json"
+
+// ShardDir is the directory, in the output directory, holding the shards of
+// a sharded index.
+const ShardDir = "search"
+
+// DefaultShardSize is the number of pages above which the index is split
+// into shards, and the number of pages per shard.
+const DefaultShardSize = 1000
+
+// IgnoreAttribute excludes an element and its children from the index.
+const IgnoreAttribute = "data-search-ignore"
+
+// skipped are the elements whose text isn't indexed.
+var skipped = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Iframe:   true,
+	atom.Canvas:   true,
+	atom.Nav:      true,
+	atom.Footer:   true,
+	atom.Form:     true,
+}
+
+// Heading is a heading of a page.
+type Heading struct {
+	// ID is the id of the heading, to link to it.
+	ID string `json:"id,omitempty"`
+	// Text is the text of the heading.
+	Text string `json:"text"`
+}
+
+// Document is a page of the index.
+type Document struct {
+	// URL is the URL of the page.
+	URL string `json:"url"`
+	// Title is the title of the page.
+	Title string `json:"title"`
+	// Headings are the headings of the page, in order.
+	Headings []Heading `json:"headings,omitempty"`
+	// Text is the plain text of the page, with its whitespace collapsed.
+	Text string `json:"text"`
+	// Language is the code of the language of the page on multilingual
+	// sites.
+	Language string `json:"lang,omitempty"`
+}
+
+// Extract returns the document of an HTML page. Only the text of the main
+// element is indexed if the page has one, and the text of the body
+// otherwise. Scripts, styles, navigation, footers, forms and the elements
+// with the data-search-ignore attribute are left out. The title is the one
+// of the title element, or of the first heading.
+func Extract(r io.Reader) (*Document, error) {
+	root, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{}
+	if title := find(root, atom.Title); title != nil {
+		doc.Title = collapse(textOf(title))
+	}
+	content := find(root, atom.Main)
+	if content == nil {
+		content = find(root, atom.Body)
+	}
+	if content == nil {
+		return doc, nil
+	}
+
+	var text strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			text.WriteString(n.Data)
+			return
+		case html.ElementNode:
+			if skipped[n.DataAtom] || hasAttr(n, IgnoreAttribute) || isAnchor(n) {
+				return
+			}
+			switch n.DataAtom {
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+				heading := Heading{ID: attr(n, "id"), Text: collapse(textOf(n))}
+				if heading.Text != "" {
+					doc.Headings = append(doc.Headings, heading)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		// Blocks don't run into each other
+		if n.Type == html.ElementNode {
+			text.WriteByte(' ')
+		}
+	}
+	walk(content)
+	doc.Text = collapse(text.String())
+	if doc.Title == "" && len(doc.Headings) > 0 {
+		doc.Title = doc.Headings[0].Text
+	}
+	return doc, nil
+}
+
+// find returns the first element of the tree with the given tag.
+func find(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := find(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// textOf returns the text of the node and its children, leaving out the
+// self-link anchors of headings.
+func textOf(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	if n.Type == html.ElementNode && (skipped[n.DataAtom] || isAnchor(n)) {
+		return ""
+	}
+	var text strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		text.WriteString(textOf(c))
+	}
+	return text.String()
+}
+
+// isAnchor reports whether the node is the self-link anchor of a heading.
+func isAnchor(n *html.Node) bool {
+	if n.DataAtom != atom.A {
+		return false
+	}
+	for _, class := range strings.Fields(attr(n, "class")) {
+		if class == "anchor" {
+			return true
+		}
+	}
+	return false
+}
+
+// attr returns the value of the attribute of the node.
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasAttr reports whether the node has the attribute.
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// collapse collapses the whitespace of the text.
+func collapse(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// index is the content of the index file: the documents of the index, or
+// the URLs of its shards.
+type index struct {
+	Documents []*Document `json:"documents,omitempty"`
+	Shards    []string    `json:"shards,omitempty"`
+}
+
+// Write writes the index of the documents to the output directory. An index
+// of more than shardSize documents is split into shards of shardSize
+// documents, listed by the index file, so that the widget can load and
+// search them in parallel. Shards left over by the previous index are
+// removed.
+func Write(outputDir string, documents []*Document, shardSize int) error {
+	if shardSize <= 0 {
+		shardSize = DefaultShardSize
+	}
+	indexPath := filepath.Join(outputDir, IndexFile)
+	previous, err := readIndex(indexPath)
+	if err != nil {
+		return err
+	}
+
+	idx := index{Documents: documents}
+	if documents == nil {
+		idx.Documents = []*Document{}
+	}
+	if len(documents) > shardSize {
+		idx = index{}
+		if err := os.MkdirAll(filepath.Join(outputDir, ShardDir), 0755); err != nil {
+			return err
+		}
+		for i := 0; i*shardSize < len(documents); i++ {
+			shard := documents[i*shardSize : min((i+1)*shardSize, len(documents))]
+			url := path.Join("/", ShardDir, fmt.Sprintf("%d.json", i))
+			if err := writeJSON(filepath.Join(outputDir, filepath.FromSlash(url)), shard); err != nil {
+				return err
+			}
+			idx.Shards = append(idx.Shards, url)
+		}
+	}
+
+	current := make(map[string]bool, len(idx.Shards))
+	for _, url := range idx.Shards {
+		current[url] = true
+	}
+	for _, url := range previous.Shards {
+		if current[url] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(outputDir, filepath.FromSlash(url))); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing stale search shard %s: %w", url, err)
+		}
+	}
+	return writeJSON(indexPath, idx)
+}
+
+// Remove removes the index written to the output directory by a previous
+// build, along with its shards. The shard directory is removed if nothing
+// else is left in it.
+func Remove(outputDir string) error {
+	indexPath := filepath.Join(outputDir, IndexFile)
+	previous, err := readIndex(indexPath)
+	if err != nil {
+		return err
+	}
+	for _, url := range previous.Shards {
+		if err := os.Remove(filepath.Join(outputDir, filepath.FromSlash(url))); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing search shard %s: %w", url, err)
+		}
+	}
+	if len(previous.Shards) > 0 {
+		// Pages may be published in the shard directory too
+		if entries, err := os.ReadDir(filepath.Join(outputDir, ShardDir)); err == nil && len(entries) == 0 {
+			if err := os.Remove(filepath.Join(outputDir, ShardDir)); err != nil {
+				return fmt.Errorf("error removing search shards: %w", err)
+			}
+		}
+	}
+	if err := os.Remove(indexPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing search index: %w", err)
+	}
+	return nil
+}
+
+// readIndex reads the index at path. A missing index is empty.
+func readIndex(path string) (index, error) {
+	var idx index
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return idx, fmt.Errorf("error reading search index: %w", err)
+	}
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return idx, fmt.Errorf("error parsing search index %s: %w", path, err)
+	}
+	return idx, nil
+}
+
+// writeJSON writes v to path as compact JSON.
+func writeJSON(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error encoding search index: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing search index: %w", err)
+	}
+	return nil
+}
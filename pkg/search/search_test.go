@@ -0,0 +1,93 @@
+package search_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Bitlatte/evoke/pkg/search"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtract(t *testing.T) {
+	page := `<!DOCTYPE html>
+<html>
+<head><title>Install | Docs</title><style>h1 { color: red; }</style></head>
+<body>
+	<nav><a href="/">Home</a></nav>
+	<main>
+		<h1 id="install">Install<a href="#install" class="anchor">#</a></h1>
+		<p>Download the   binary.</p>
+		<aside data-search-ignore>Edit this page</aside>
+		<h2 id="linux">On <code>Linux</code></h2>
+		<p>Run it.</p><script>console.log("hi")</script>
+	</main>
+	<footer>Copyright</footer>
+</body>
+</html>`
+
+	doc, err := search.Extract(strings.NewReader(page))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Install | Docs", doc.Title)
+	assert.Equal(t, []search.Heading{{ID: "install", Text: "Install"}, {ID: "linux", Text: "On Linux"}}, doc.Headings)
+	assert.Equal(t, "Install Download the binary. On Linux Run it.", doc.Text)
+}
+
+func TestExtract_WithoutMain(t *testing.T) {
+	doc, err := search.Extract(strings.NewReader("<h1>Hello</h1><p>World</p>"))
+	require.NoError(t, err)
+
+	// The title falls back to the first heading
+	assert.Equal(t, "Hello", doc.Title)
+	assert.Equal(t, "Hello World", doc.Text)
+}
+
+func TestWrite(t *testing.T) {
+	outputDir := t.TempDir()
+	var documents []*search.Document
+	for i := 0; i < 5; i++ {
+		documents = append(documents, &search.Document{URL: fmt.Sprintf("/%d.html", i), Title: fmt.Sprint(i)})
+	}
+
+	// Small indexes are written as one file
+	require.NoError(t, search.Write(outputDir, documents, 10))
+	var index struct {
+		Documents []*search.Document `json:"documents"`
+		Shards    []string           `json:"shards"`
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, search.IndexFile))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &index))
+	assert.Equal(t, documents, index.Documents)
+	assert.Empty(t, index.Shards)
+
+	// Large ones are split into shards
+	require.NoError(t, search.Write(outputDir, documents, 2))
+	index.Documents = nil
+	data, err = os.ReadFile(filepath.Join(outputDir, search.IndexFile))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &index))
+	assert.Empty(t, index.Documents)
+	assert.Equal(t, []string{"/search/0.json", "/search/1.json", "/search/2.json"}, index.Shards)
+	var shard []*search.Document
+	data, err = os.ReadFile(filepath.Join(outputDir, "search", "2.json"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &shard))
+	assert.Equal(t, documents[4:], shard)
+
+	// Shards of the previous index are removed
+	require.NoError(t, search.Write(outputDir, documents, 3))
+	assert.FileExists(t, filepath.Join(outputDir, "search", "1.json"))
+	assert.NoFileExists(t, filepath.Join(outputDir, "search", "2.json"))
+
+	// Removing the index removes its shards too
+	require.NoError(t, search.Remove(outputDir))
+	assert.NoFileExists(t, filepath.Join(outputDir, search.IndexFile))
+	assert.NoDirExists(t, filepath.Join(outputDir, search.ShardDir))
+	require.NoError(t, search.Remove(outputDir))
+}
@@ -17,8 +17,11 @@ import (
 	"encoding/json"
 
 	"github.com/Bitlatte/evoke/pkg/build"
+	"github.com/Bitlatte/evoke/pkg/bundle"
+	"github.com/Bitlatte/evoke/pkg/i18n"
 
 	"github.com/Bitlatte/evoke/pkg/logger"
+	"github.com/Bitlatte/evoke/pkg/plugins"
 	"github.com/fsnotify/fsnotify"
 	"github.com/gorilla/websocket"
 )
@@ -43,9 +46,15 @@ var (
 //go:embed devtools.js
 var devtoolsJS []byte
 
-// Serve starts a web server and watches for changes.
-func Serve(port int) error {
-	if err := buildAndCache(); err != nil {
+// Serve starts a web server and watches for changes. The site is built with
+// the given options. The plugins are kept running between rebuilds.
+func Serve(port int, opts build.Options) error {
+	if opts.Plugins == nil {
+		opts.Plugins = plugins.NewManager()
+	}
+	defer opts.Plugins.Kill()
+
+	if err := buildAndCache(opts); err != nil {
 		return fmt.Errorf("error building site: %w", err)
 	}
 
@@ -57,15 +66,18 @@ func Serve(port int) error {
 	}
 	defer watcher.Close()
 
-	go watchFiles(watcher)
+	go watchFiles(watcher, opts)
 
 	// Add directories and files to watch
 	if err := watchRecursive(watcher, "content"); err != nil {
 		return fmt.Errorf("error watching content directory: %w", err)
 	}
-	optionalWatch := []string{"public", "plugins", "partials", "evoke.yaml"}
 	for _, item := range optionalWatch {
-		if err := watcher.Add(item); err != nil {
+		if _, err := os.Stat(item); err != nil {
+			logger.Logger.Debug("Not watching", "item", item, "error", err)
+			continue
+		}
+		if err := watchRecursive(watcher, item); err != nil {
 			logger.Logger.Warn("Could not watch", "item", item, "error", err)
 		}
 	}
@@ -76,13 +88,30 @@ func Serve(port int) error {
 	return nil
 }
 
-// watchRecursive recursively watches a directory for changes.
-func watchRecursive(watcher *fsnotify.Watcher, path string) error {
-	return filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+// optionalWatch are the directories and files watched besides the content
+// directory, if they exist. Directories are watched recursively.
+var optionalWatch = []string{
+	"evoke.yaml",
+	"public",
+	"partials",
+	// Pages using a data file are rendered again when it changes
+	"data",
+	// Plugins are reloaded when their binary changes
+	"plugins",
+	// Bundles are built again when a file they import changes
+	bundle.Dir,
+	// Pages are rendered again when the strings they translate change
+	i18n.Dir,
+}
+
+// watchRecursive recursively watches a directory for changes. A file is
+// watched on its own.
+func watchRecursive(watcher *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if info.IsDir() {
+		if info.IsDir() || path == root {
 			if err := watcher.Add(path); err != nil {
 				return fmt.Errorf("error watching path %s: %w", path, err)
 			}
@@ -191,7 +220,7 @@ func memoryFileServer(w http.ResponseWriter, r *http.Request) {
 }
 
 // buildAndCache builds the site and caches it in memory.
-func buildAndCache() error {
+func buildAndCache(opts build.Options) error {
 	buildMutex.Lock()
 	defer buildMutex.Unlock()
 
@@ -202,7 +231,7 @@ func buildAndCache() error {
 	}
 	defer os.RemoveAll(tempDir)
 
-	if err := build.Build(tempDir, false, runtime.NumCPU()); err != nil {
+	if err := build.Build(tempDir, false, runtime.NumCPU(), opts); err != nil {
 		return err
 	}
 
@@ -230,7 +259,7 @@ func buildAndCache() error {
 }
 
 // watchFiles watches for file changes and rebuilds the site.
-func watchFiles(watcher *fsnotify.Watcher) {
+func watchFiles(watcher *fsnotify.Watcher, opts build.Options) {
 	var (
 		buildTicker = time.NewTicker(1 * time.Second)
 		buildEvents = make(map[string]fsnotify.Event)
@@ -255,6 +284,15 @@ func watchFiles(watcher *fsnotify.Watcher) {
 				continue
 			}
 
+			// Watch the directories created in a watched directory
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchRecursive(watcher, event.Name); err != nil {
+						logger.Logger.Warn("Could not watch", "item", event.Name, "error", err)
+					}
+				}
+			}
+
 			mu.Lock()
 			buildEvents[event.Name] = event
 			mu.Unlock()
@@ -273,11 +311,12 @@ func watchFiles(watcher *fsnotify.Watcher) {
 			buildEvents = make(map[string]fsnotify.Event)
 			mu.Unlock()
 
-			// Check if only CSS files have changed
+			// Check if only CSS files have changed. Stylesheets in the
+			// assets directory are bundled, so they need a rebuild.
 			onlyCSS := true
 			cssFiles := []string{}
 			for name := range events {
-				if strings.HasSuffix(name, ".css") {
+				if strings.HasSuffix(name, ".css") && !strings.HasPrefix(filepath.ToSlash(name), bundle.Dir+"/") {
 					cssFiles = append(cssFiles, name)
 				} else {
 					onlyCSS = false
@@ -304,7 +343,7 @@ func watchFiles(watcher *fsnotify.Watcher) {
 					})
 				}
 			} else {
-				if err := buildAndCache(); err != nil {
+				if err := buildAndCache(opts); err != nil {
 					logger.Logger.Error("Error rebuilding site", "error", err)
 					broadcast("error", err.Error())
 				} else {
@@ -0,0 +1,266 @@
+package shortcodes
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenText tokenKind = iota
+	tokenOpen
+	tokenClose
+)
+
+// token is a piece of text or a single shortcode tag.
+type token struct {
+	kind       tokenKind
+	text       []byte
+	name       string
+	params     map[string]string
+	positional []string
+	// selfClosing is set for tags written as {{< name />}}.
+	selfClosing bool
+}
+
+// node is a piece of text or a shortcode with its inner content.
+type node struct {
+	text      []byte
+	shortcode *token
+	// children is nil for shortcodes without a closing tag.
+	children []*node
+}
+
+// tokenize splits the source into text and shortcode tags. A tag written as
+// {{</* name */>}} is escaped and emitted as the literal text {{< name >}}.
+func tokenize(source []byte) ([]*token, error) {
+	var tokens []*token
+	for len(source) > 0 {
+		start := bytes.Index(source, openDelim)
+		if start == -1 {
+			tokens = append(tokens, &token{kind: tokenText, text: source})
+			break
+		}
+		if start > 0 {
+			tokens = append(tokens, &token{kind: tokenText, text: source[:start]})
+		}
+
+		end := bytes.Index(source[start:], closeDelim)
+		if end == -1 {
+			return nil, fmt.Errorf("unclosed shortcode starting at %q", truncate(source[start:]))
+		}
+		inner := bytes.TrimSpace(source[start+len(openDelim) : start+end])
+		source = source[start+end+len(closeDelim):]
+
+		if text, ok := unescape(inner); ok {
+			tokens = append(tokens, &token{kind: tokenText, text: text})
+			continue
+		}
+
+		if bytes.HasPrefix(inner, []byte("/")) {
+			name := string(bytes.TrimSpace(inner[1:]))
+			if name == "" {
+				return nil, fmt.Errorf("closing shortcode without a name")
+			}
+			tokens = append(tokens, &token{kind: tokenClose, name: name})
+			continue
+		}
+
+		t, err := parseTag(string(inner))
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// unescape returns the literal text of a tag written as {{</* name */>}},
+// given what's inside its delimiters, and whether the tag is escaped.
+func unescape(inner []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(inner, []byte("/*")) || !bytes.HasSuffix(inner, []byte("*/")) {
+		return nil, false
+	}
+	literal := bytes.TrimSpace(inner[2 : len(inner)-2])
+	return append(append(append([]byte("{{< "), literal...), " "...), closeDelim...), true
+}
+
+// Unescape replaces the tags written as {{</* name */>}} in the source with
+// the literal text {{< name >}}, leaving the other tags as they are. It is
+// used on pages rendered without shortcodes, which Expand would unescape
+// otherwise.
+func Unescape(source []byte) []byte {
+	var out bytes.Buffer
+	for {
+		start := bytes.Index(source, openDelim)
+		if start == -1 {
+			break
+		}
+		end := bytes.Index(source[start:], closeDelim)
+		if end == -1 {
+			break
+		}
+		out.Write(source[:start])
+		tag := source[start : start+end+len(closeDelim)]
+		if text, ok := unescape(bytes.TrimSpace(tag[len(openDelim) : len(tag)-len(closeDelim)])); ok {
+			out.Write(text)
+		} else {
+			out.Write(tag)
+		}
+		source = source[start+end+len(closeDelim):]
+	}
+	out.Write(source)
+	return out.Bytes()
+}
+
+// parseTag parses the name and parameters of an opening tag.
+func parseTag(tag string) (*token, error) {
+	t := &token{kind: tokenOpen, params: make(map[string]string)}
+	if strings.HasSuffix(tag, "/") {
+		t.selfClosing = true
+		tag = strings.TrimSpace(strings.TrimSuffix(tag, "/"))
+	}
+
+	args, err := splitArgs(tag)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("shortcode without a name")
+	}
+	t.name = args[0]
+
+	for _, arg := range args[1:] {
+		if key, value, ok := strings.Cut(arg, "="); ok && isIdentifier(key) {
+			t.params[key] = unquote(value)
+			continue
+		}
+		t.positional = append(t.positional, unquote(arg))
+	}
+	return t, nil
+}
+
+// splitArgs splits a tag on whitespace, keeping quoted values together.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArg := false
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			current.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '`':
+			quote = r
+			inArg = true
+			current.WriteRune(r)
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			inArg = true
+			current.WriteRune(r)
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in shortcode %q", s)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// parse builds the shortcode tree from the tokens. An opening tag followed by
+// a matching closing tag wraps the tokens in between, otherwise it is treated
+// as a shortcode without inner content.
+func parse(tokens []*token) ([]*node, error) {
+	var nodes []*node
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch t.kind {
+		case tokenText:
+			nodes = append(nodes, &node{text: t.text})
+		case tokenClose:
+			return nil, fmt.Errorf("unexpected closing shortcode %q", t.name)
+		case tokenOpen:
+			n := &node{shortcode: t}
+			if !t.selfClosing {
+				if end := matchingClose(tokens, i); end != -1 {
+					children, err := parse(tokens[i+1 : end])
+					if err != nil {
+						return nil, err
+					}
+					if children == nil {
+						children = []*node{}
+					}
+					n.children = children
+					i = end
+				}
+			}
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, nil
+}
+
+// matchingClose returns the index of the closing tag for the opening tag at
+// index i, or -1 if there is none.
+func matchingClose(tokens []*token, i int) int {
+	name := tokens[i].name
+	depth := 0
+	for j := i + 1; j < len(tokens); j++ {
+		t := tokens[j]
+		if t.name != name {
+			continue
+		}
+		switch {
+		case t.kind == tokenOpen && !t.selfClosing:
+			depth++
+		case t.kind == tokenClose:
+			if depth == 0 {
+				return j
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// isIdentifier reports whether s can be used as a parameter name.
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// unquote strips the surrounding quotes from a parameter value.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '`') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// truncate shortens the source for use in error messages.
+func truncate(b []byte) string {
+	if len(b) > 40 {
+		return string(b[:40]) + "..."
+	}
+	return string(b)
+}
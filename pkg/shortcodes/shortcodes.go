@@ -0,0 +1,249 @@
+// Package shortcodes provides markdown shortcodes backed by partial templates.
+//
+// A shortcode is written as {{< name param="value" >}}inner{{< /name >}}, or
+// without a closing tag when it has no inner content. It is rendered with the
+// template of the same name found in partials/shortcodes.
+package shortcodes
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Bitlatte/evoke/pkg/partials"
+)
+
+// Dir is the directory the shortcode templates are loaded from.
+var Dir = filepath.Join("partials", "shortcodes")
+
+var (
+	openDelim  = []byte("{{<")
+	closeDelim = []byte(">}}")
+)
+
+// Shortcodes holds the parsed shortcode templates.
+type Shortcodes struct {
+	*template.Template
+}
+
+// Shortcode is the data passed to a shortcode template.
+type Shortcode struct {
+	// Name is the name of the shortcode.
+	Name string
+	// Params are the named parameters of the shortcode.
+	Params map[string]string
+	// Positional are the positional parameters of the shortcode.
+	Positional []string
+	// Inner is the content between the opening and closing tags, rendered
+	// as markdown.
+	Inner template.HTML
+	// Page is the front matter of the page the shortcode is used on.
+	Page map[string]any
+	// Site is the site configuration.
+	Site map[string]any
+}
+
+// Get returns a positional parameter if key is an int, or a named parameter
+// if key is a string.
+func (s *Shortcode) Get(key any) string {
+	switch k := key.(type) {
+	case int:
+		if k >= 0 && k < len(s.Positional) {
+			return s.Positional[k]
+		}
+	case string:
+		return s.Params[k]
+	}
+	return ""
+}
+
+// LoadShortcodes walks the shortcodes directory and parses every file as a
+// shortcode template named after its path without the extension. The
+// templates are cloned from p so that shortcodes can use partials.
+func LoadShortcodes(p *partials.Partials) (*Shortcodes, error) {
+	cloned, err := p.Clone()
+	if err != nil {
+		return nil, err
+	}
+	t := cloned.Template
+
+	err = filepath.Walk(Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(Dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel)))
+		if _, err := t.New(name).Parse(string(content)); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Shortcodes{t}, nil
+}
+
+// Localize returns a copy of the shortcodes whose templates call the given
+// functions instead, e.g. the i18n function of a language. It must be called
+// before the shortcodes are executed.
+func (s *Shortcodes) Localize(funcs template.FuncMap) (*Shortcodes, error) {
+	cloned, err := s.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return &Shortcodes{cloned.Funcs(funcs)}, nil
+}
+
+// Contains reports whether the source contains any shortcodes.
+func Contains(source []byte) bool {
+	return bytes.Contains(source, openDelim)
+}
+
+// Expand renders every shortcode in the source. Each rendered shortcode is
+// replaced by a placeholder so that it passes through the markdown renderer
+// untouched; Restore puts the rendered HTML back. Inner content is rendered
+// with the given markdown function.
+func (s *Shortcodes) Expand(source []byte, page, site map[string]any, markdown func([]byte) ([]byte, error)) ([]byte, map[string][]byte, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes, err := parse(tokens)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := &renderer{
+		shortcodes:   s,
+		page:         page,
+		site:         site,
+		markdown:     markdown,
+		placeholders: make(map[string][]byte),
+	}
+	out, err := r.render(nodes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, r.placeholders, nil
+}
+
+// Restore replaces the placeholders in the rendered HTML with the output of
+// their shortcodes. A placeholder that markdown wrapped in a paragraph of its
+// own is replaced together with the paragraph.
+func Restore(html []byte, placeholders map[string][]byte) []byte {
+	if len(placeholders) == 0 {
+		return html
+	}
+	// Nested shortcodes are restored into the output of their parent, so keep
+	// replacing until no placeholder is left.
+	for changed := true; changed; {
+		changed = false
+		for placeholder, output := range placeholders {
+			p := []byte(placeholder)
+			if !bytes.Contains(html, p) {
+				continue
+			}
+			html = bytes.ReplaceAll(html, []byte("<p>"+placeholder+"</p>"), output)
+			html = bytes.ReplaceAll(html, p, output)
+			changed = true
+		}
+	}
+	return html
+}
+
+// Names returns the names of the shortcodes used in the source.
+func Names(source []byte) []string {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, t := range tokens {
+		if t.kind == tokenOpen && !seen[t.name] {
+			seen[t.name] = true
+			names = append(names, t.name)
+		}
+	}
+	return names
+}
+
+// renderer renders a parsed shortcode tree.
+type renderer struct {
+	shortcodes   *Shortcodes
+	page         map[string]any
+	site         map[string]any
+	markdown     func([]byte) ([]byte, error)
+	placeholders map[string][]byte
+}
+
+// render writes text nodes as they are and replaces shortcodes with
+// placeholders.
+func (r *renderer) render(nodes []*node) ([]byte, error) {
+	var out bytes.Buffer
+	for _, n := range nodes {
+		if n.shortcode == nil {
+			out.Write(n.text)
+			continue
+		}
+		rendered, err := r.execute(n)
+		if err != nil {
+			return nil, err
+		}
+		placeholder := fmt.Sprintf("EVOKESHORTCODE%06dX", len(r.placeholders))
+		r.placeholders[placeholder] = rendered
+		out.WriteString(placeholder)
+	}
+	return out.Bytes(), nil
+}
+
+// execute renders a single shortcode with its template.
+func (r *renderer) execute(n *node) ([]byte, error) {
+	t := r.shortcodes.Lookup(n.shortcode.name)
+	if t == nil {
+		return nil, fmt.Errorf("unknown shortcode %q", n.shortcode.name)
+	}
+
+	data := &Shortcode{
+		Name:       n.shortcode.name,
+		Params:     n.shortcode.params,
+		Positional: n.shortcode.positional,
+		Page:       r.page,
+		Site:       r.site,
+	}
+
+	if n.children != nil {
+		inner, err := r.render(n.children)
+		if err != nil {
+			return nil, err
+		}
+		html, err := r.markdown(inner)
+		if err != nil {
+			return nil, fmt.Errorf("error rendering inner content of shortcode %q: %w", n.shortcode.name, err)
+		}
+		data.Inner = template.HTML(bytes.TrimSpace(Restore(html, r.placeholders)))
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("error executing shortcode %q: %w", n.shortcode.name, err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,63 @@
+package shortcodes_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/Bitlatte/evoke/pkg/partials"
+	"github.com/Bitlatte/evoke/pkg/shortcodes"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuin/goldmark"
+)
+
+func markdown(source []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	err := goldmark.New().Convert(source, &buf)
+	return buf.Bytes(), err
+}
+
+func TestExpand_RendersShortcodes(t *testing.T) {
+	// Arrange
+	os.MkdirAll("partials/shortcodes", 0755)
+	defer os.RemoveAll("partials")
+	os.WriteFile("partials/shortcodes/callout.html", []byte(`<div class="callout {{ .Get "type" }}">{{ .Inner }}</div>`), 0644)
+	os.WriteFile("partials/shortcodes/youtube.html", []byte(`<iframe src="https://www.youtube.com/embed/{{ .Get 0 }}" title="{{ .Page.title }}"></iframe>`), 0644)
+
+	sc, err := shortcodes.LoadShortcodes(&partials.Partials{})
+	assert.NoError(t, err)
+
+	source := []byte("Intro\n\n{{< callout type=\"warning\" >}}\nBe **careful**.\n\n{{< youtube abc123 >}}\n{{< /callout >}}\n\nShow `{{</* youtube id */>}}`.\n")
+
+	// Act
+	expanded, placeholders, err := sc.Expand(source, map[string]any{"title": "Demo"}, nil, markdown)
+	assert.NoError(t, err)
+	html, err := markdown(expanded)
+	assert.NoError(t, err)
+	html = shortcodes.Restore(html, placeholders)
+
+	// Assert
+	assert.Contains(t, string(html), `<div class="callout warning"><p>Be <strong>careful</strong>.</p>
+<iframe src="https://www.youtube.com/embed/abc123" title="Demo"></iframe></div>`)
+	assert.NotContains(t, string(html), "<p><div")
+	assert.Contains(t, string(html), "<code>{{&lt; youtube id &gt;}}</code>")
+	assert.Equal(t, []string{"callout", "youtube"}, shortcodes.Names(source))
+}
+
+func TestExpand_UnknownShortcode(t *testing.T) {
+	// Arrange
+	sc, err := shortcodes.LoadShortcodes(&partials.Partials{})
+	assert.Error(t, err) // The shortcodes directory does not exist.
+	assert.Nil(t, sc)
+
+	os.MkdirAll("partials/shortcodes", 0755)
+	defer os.RemoveAll("partials")
+	sc, err = shortcodes.LoadShortcodes(&partials.Partials{})
+	assert.NoError(t, err)
+
+	// Act
+	_, _, err = sc.Expand([]byte("{{< missing >}}"), nil, nil, markdown)
+
+	// Assert
+	assert.EqualError(t, err, `unknown shortcode "missing"`)
+}
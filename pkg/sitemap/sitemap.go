@@ -0,0 +1,103 @@
+// Package sitemap writes the sitemaps of the generated site, which list its
+// pages for search engines along with the hreflang alternates of their
+// translations.
+package sitemap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Bitlatte/evoke/pkg/pages"
+)
+
+// File is the name of the sitemap, or of the sitemap index of a
+// multilingual site, in the output directory.
+const File = "sitemap.xml"
+
+const (
+	sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	xhtmlNamespace   = "http://www.w3.org/1999/xhtml"
+)
+
+// urlSet is a sitemap.
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	XHTML   string   `xml:"xmlns:xhtml,attr,omitempty"`
+	URLs    []url    `xml:"url"`
+}
+
+// url is a page of a sitemap.
+type url struct {
+	Loc        string      `xml:"loc"`
+	LastMod    string      `xml:"lastmod,omitempty"`
+	Alternates []alternate `xml:"xhtml:link"`
+}
+
+// alternate links a page to the version of the page in a language.
+type alternate struct {
+	Rel      string `xml:"rel,attr"`
+	Hreflang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
+}
+
+// sitemapIndex lists the sitemaps of a site.
+type sitemapIndex struct {
+	XMLName  xml.Name  `xml:"sitemapindex"`
+	XMLNS    string    `xml:"xmlns,attr"`
+	Sitemaps []sitemap `xml:"sitemap"`
+}
+
+// sitemap is a sitemap of a sitemap index.
+type sitemap struct {
+	Loc string `xml:"loc"`
+}
+
+// Write writes the sitemap of the pages to the file at path. The URLs of the
+// pages are made absolute with baseURL, e.g. https://example.com, and their
+// publish dates are their last modification. Pages with translations list
+// them, and themselves, as hreflang alternates.
+func Write(path, baseURL string, published []*pages.Page) error {
+	set := urlSet{XMLNS: sitemapNamespace}
+	for _, page := range published {
+		u := url{Loc: absolute(baseURL, page.URL)}
+		if date := page.PublishDate(); !date.IsZero() {
+			u.LastMod = date.Format("2006-01-02")
+		}
+		if len(page.Translations) > 0 {
+			set.XHTML = xhtmlNamespace
+			for _, version := range append([]*pages.Page{page}, page.Translations...) {
+				u.Alternates = append(u.Alternates, alternate{Rel: "alternate", Hreflang: version.Language, Href: absolute(baseURL, version.URL)})
+			}
+		}
+		set.URLs = append(set.URLs, u)
+	}
+	return writeXML(path, set)
+}
+
+// WriteIndex writes the sitemap index listing the sitemaps at the given URLs,
+// relative to the site root, to the file at path.
+func WriteIndex(path, baseURL string, sitemaps []string) error {
+	index := sitemapIndex{XMLNS: sitemapNamespace}
+	for _, u := range sitemaps {
+		index.Sitemaps = append(index.Sitemaps, sitemap{Loc: absolute(baseURL, u)})
+	}
+	return writeXML(path, index)
+}
+
+// absolute returns the URL, relative to the site root, made absolute with
+// baseURL.
+func absolute(baseURL, u string) string {
+	return strings.TrimSuffix(baseURL, "/") + u
+}
+
+// writeXML writes v to path as indented XML.
+func writeXML(path string, v any) error {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding sitemap: %w", err)
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
@@ -0,0 +1,56 @@
+package sitemap_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bitlatte/evoke/pkg/pages"
+	"github.com/Bitlatte/evoke/pkg/sitemap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	guide := &pages.Page{URL: "/guide.html", Language: "en", Params: map[string]any{"date": "2024-03-01"}}
+	de := &pages.Page{URL: "/de/guide.html", Language: "de", Params: map[string]any{}}
+	guide.Translations = []*pages.Page{de}
+	about := &pages.Page{URL: "/about.html", Language: "en", Params: map[string]any{}}
+
+	path := filepath.Join(t.TempDir(), "sitemap.xml")
+	require.NoError(t, sitemap.Write(path, "https://example.com/", []*pages.Page{guide, about}))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:xhtml="http://www.w3.org/1999/xhtml">
+  <url>
+    <loc>https://example.com/guide.html</loc>
+    <lastmod>2024-03-01</lastmod>
+    <xhtml:link rel="alternate" hreflang="en" href="https://example.com/guide.html"></xhtml:link>
+    <xhtml:link rel="alternate" hreflang="de" href="https://example.com/de/guide.html"></xhtml:link>
+  </url>
+  <url>
+    <loc>https://example.com/about.html</loc>
+  </url>
+</urlset>
+`, string(data))
+}
+
+func TestWriteIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sitemap.xml")
+	require.NoError(t, sitemap.WriteIndex(path, "https://example.com", []string{"/sitemap.en.xml", "/sitemap.de.xml"}))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap>
+    <loc>https://example.com/sitemap.en.xml</loc>
+  </sitemap>
+  <sitemap>
+    <loc>https://example.com/sitemap.de.xml</loc>
+  </sitemap>
+</sitemapindex>
+`, string(data))
+}
@@ -0,0 +1,33 @@
+package util
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// CloneFile makes dest a copy-on-write clone of src, a reflink, sharing its
+// data until one of them is modified. It fails if the file system doesn't
+// support it, or if src and dest are on different file systems.
+func CloneFile(src, dest string) error {
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	info, err := sourceFile.Stat()
+	if err != nil {
+		return err
+	}
+	destFile, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	if err := unix.IoctlFileClone(int(destFile.Fd()), int(sourceFile.Fd())); err != nil {
+		return &os.LinkError{Op: "clone", Old: src, New: dest, Err: err}
+	}
+	return destFile.Chmod(info.Mode().Perm())
+}
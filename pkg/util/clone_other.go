@@ -0,0 +1,14 @@
+//go:build !linux
+
+package util
+
+import (
+	"errors"
+	"os"
+)
+
+// CloneFile makes dest a copy-on-write clone of src. Reflinks are only
+// supported on Linux, so it always fails elsewhere.
+func CloneFile(src, dest string) error {
+	return &os.LinkError{Op: "clone", Old: src, New: dest, Err: errors.ErrUnsupported}
+}
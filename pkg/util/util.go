@@ -32,18 +32,13 @@ func CopyDirectory(src, dest string) error {
 		newPath := filepath.Join(dest, path[len(src):])
 
 		if info.IsDir() {
-			os.MkdirAll(newPath, info.Mode())
-		} else {
-			if err := CopyFile(path, newPath); err != nil {
-				return err
-			}
+			return os.MkdirAll(newPath, info.Mode().Perm())
 		}
-
-		return nil
+		return CopyFile(path, newPath)
 	})
 }
 
-// CopyFile copies a file from src to dest.
+// CopyFile copies a file from src to dest, preserving its mode.
 func CopyFile(src, dest string) error {
 	sourceFile, err := os.Open(src)
 	if err != nil {
@@ -51,12 +46,20 @@ func CopyFile(src, dest string) error {
 	}
 	defer sourceFile.Close()
 
-	destFile, err := os.Create(dest)
+	info, err := sourceFile.Stat()
+	if err != nil {
+		return err
+	}
+	destFile, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
 	if err != nil {
 		return err
 	}
 	defer destFile.Close()
 
-	_, err = io.Copy(destFile, sourceFile)
-	return err
+	if _, err := io.Copy(destFile, sourceFile); err != nil {
+		return err
+	}
+	// The mode of an existing file isn't changed by opening it, and new files
+	// are subject to the umask
+	return destFile.Chmod(info.Mode().Perm())
 }
@@ -22,6 +22,20 @@ const _ = grpc.SupportPackageIsVersion7
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type PluginClient interface {
+	// Called once after the plugin is started to find out which hooks it
+	// implements. The host doesn't call the other hooks. Added in protocol
+	// version 2.
+	GetCapabilities(ctx context.Context, in *GetCapabilitiesRequest, opts ...grpc.CallOption) (*GetCapabilitiesResponse, error)
+	// Called once after the plugin is started to get its name, version and
+	// description.
+	GetMetadata(ctx context.Context, in *GetMetadataRequest, opts ...grpc.CallOption) (*PluginMetadata, error)
+	// Called once after the plugin is started with its settings from the
+	// plugins section of evoke.yaml.
+	Configure(ctx context.Context, in *ConfigureRequest, opts ...grpc.CallOption) (*ConfigureResponse, error)
+	// Called once after the plugin is started with the ID of the Host service
+	// the host serves over the go-plugin broker. Only called if the plugin
+	// reports it in its capabilities.
+	ConnectHost(ctx context.Context, in *ConnectHostRequest, opts ...grpc.CallOption) (*ConnectHostResponse, error)
 	// Called once before the entire build process begins.
 	// Useful for setup tasks or pre-build validation.
 	OnPreBuild(ctx context.Context, in *PreBuildRequest, opts ...grpc.CallOption) (*PreBuildResponse, error)
@@ -34,17 +48,34 @@ type PluginClient interface {
 	// Allows modification of the raw file content.
 	OnContentLoaded(ctx context.Context, in *ContentFile, opts ...grpc.CallOption) (*ContentFile, error)
 	// Called before the Markdown (or other format) content is rendered to HTML.
+	// The content is the body of the page and the metadata its front matter.
 	// A plugin could use this to implement a custom renderer.
 	OnContentRender(ctx context.Context, in *ContentFile, opts ...grpc.CallOption) (*ContentFile, error)
 	// Called after content is rendered to HTML but before it's placed in a layout.
-	// Useful for post-processing the core HTML content.
+	// Useful for post-processing the core HTML content. The metadata is
+	// available to the layouts as .Page.
 	OnHTMLRendered(ctx context.Context, in *ContentFile, opts ...grpc.CallOption) (*ContentFile, error)
+	// Batched variants of the content hooks, which process many files in one
+	// call. The host uses them when the plugin reports them in its
+	// capabilities.
+	OnContentLoadedBatch(ctx context.Context, in *ContentFileBatch, opts ...grpc.CallOption) (*ContentFileBatchResponse, error)
+	OnContentRenderBatch(ctx context.Context, in *ContentFileBatch, opts ...grpc.CallOption) (*ContentFileBatchResponse, error)
+	OnHTMLRenderedBatch(ctx context.Context, in *ContentFileBatch, opts ...grpc.CallOption) (*ContentFileBatchResponse, error)
 	// Called once after all content has been processed and written to disk.
 	OnPostBuild(ctx context.Context, in *PostBuildRequest, opts ...grpc.CallOption) (*PostBuildResponse, error)
 	// Called to register custom pipelines.
 	RegisterPipelines(ctx context.Context, in *RegisterPipelinesRequest, opts ...grpc.CallOption) (*RegisterPipelinesResponse, error)
 	// Called to process an asset with a custom pipeline.
 	ProcessAsset(ctx context.Context, in *Asset, opts ...grpc.CallOption) (*Asset, error)
+	// Batched variant of ProcessAsset, which processes many assets in one call.
+	ProcessAssetBatch(ctx context.Context, in *AssetBatch, opts ...grpc.CallOption) (*AssetBatchResponse, error)
+	// Called before the content is processed to add pages that don't exist in
+	// the content directory.
+	GeneratePages(ctx context.Context, in *GeneratePagesRequest, opts ...grpc.CallOption) (*GeneratePagesResponse, error)
+	// Called to register functions that templates can call.
+	RegisterTemplateFunctions(ctx context.Context, in *RegisterTemplateFunctionsRequest, opts ...grpc.CallOption) (*RegisterTemplateFunctionsResponse, error)
+	// Called when a template calls a function registered by the plugin.
+	CallTemplateFunction(ctx context.Context, in *CallTemplateFunctionRequest, opts ...grpc.CallOption) (*CallTemplateFunctionResponse, error)
 }
 
 type pluginClient struct {
@@ -55,6 +86,42 @@ func NewPluginClient(cc grpc.ClientConnInterface) PluginClient {
 	return &pluginClient{cc}
 }
 
+func (c *pluginClient) GetCapabilities(ctx context.Context, in *GetCapabilitiesRequest, opts ...grpc.CallOption) (*GetCapabilitiesResponse, error) {
+	out := new(GetCapabilitiesResponse)
+	err := c.cc.Invoke(ctx, "/proto.Plugin/GetCapabilities", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginClient) GetMetadata(ctx context.Context, in *GetMetadataRequest, opts ...grpc.CallOption) (*PluginMetadata, error) {
+	out := new(PluginMetadata)
+	err := c.cc.Invoke(ctx, "/proto.Plugin/GetMetadata", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginClient) Configure(ctx context.Context, in *ConfigureRequest, opts ...grpc.CallOption) (*ConfigureResponse, error) {
+	out := new(ConfigureResponse)
+	err := c.cc.Invoke(ctx, "/proto.Plugin/Configure", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginClient) ConnectHost(ctx context.Context, in *ConnectHostRequest, opts ...grpc.CallOption) (*ConnectHostResponse, error) {
+	out := new(ConnectHostResponse)
+	err := c.cc.Invoke(ctx, "/proto.Plugin/ConnectHost", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *pluginClient) OnPreBuild(ctx context.Context, in *PreBuildRequest, opts ...grpc.CallOption) (*PreBuildResponse, error) {
 	out := new(PreBuildResponse)
 	err := c.cc.Invoke(ctx, "/proto.Plugin/OnPreBuild", in, out, opts...)
@@ -109,6 +176,33 @@ func (c *pluginClient) OnHTMLRendered(ctx context.Context, in *ContentFile, opts
 	return out, nil
 }
 
+func (c *pluginClient) OnContentLoadedBatch(ctx context.Context, in *ContentFileBatch, opts ...grpc.CallOption) (*ContentFileBatchResponse, error) {
+	out := new(ContentFileBatchResponse)
+	err := c.cc.Invoke(ctx, "/proto.Plugin/OnContentLoadedBatch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginClient) OnContentRenderBatch(ctx context.Context, in *ContentFileBatch, opts ...grpc.CallOption) (*ContentFileBatchResponse, error) {
+	out := new(ContentFileBatchResponse)
+	err := c.cc.Invoke(ctx, "/proto.Plugin/OnContentRenderBatch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginClient) OnHTMLRenderedBatch(ctx context.Context, in *ContentFileBatch, opts ...grpc.CallOption) (*ContentFileBatchResponse, error) {
+	out := new(ContentFileBatchResponse)
+	err := c.cc.Invoke(ctx, "/proto.Plugin/OnHTMLRenderedBatch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *pluginClient) OnPostBuild(ctx context.Context, in *PostBuildRequest, opts ...grpc.CallOption) (*PostBuildResponse, error) {
 	out := new(PostBuildResponse)
 	err := c.cc.Invoke(ctx, "/proto.Plugin/OnPostBuild", in, out, opts...)
@@ -136,10 +230,60 @@ func (c *pluginClient) ProcessAsset(ctx context.Context, in *Asset, opts ...grpc
 	return out, nil
 }
 
+func (c *pluginClient) ProcessAssetBatch(ctx context.Context, in *AssetBatch, opts ...grpc.CallOption) (*AssetBatchResponse, error) {
+	out := new(AssetBatchResponse)
+	err := c.cc.Invoke(ctx, "/proto.Plugin/ProcessAssetBatch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginClient) GeneratePages(ctx context.Context, in *GeneratePagesRequest, opts ...grpc.CallOption) (*GeneratePagesResponse, error) {
+	out := new(GeneratePagesResponse)
+	err := c.cc.Invoke(ctx, "/proto.Plugin/GeneratePages", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginClient) RegisterTemplateFunctions(ctx context.Context, in *RegisterTemplateFunctionsRequest, opts ...grpc.CallOption) (*RegisterTemplateFunctionsResponse, error) {
+	out := new(RegisterTemplateFunctionsResponse)
+	err := c.cc.Invoke(ctx, "/proto.Plugin/RegisterTemplateFunctions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pluginClient) CallTemplateFunction(ctx context.Context, in *CallTemplateFunctionRequest, opts ...grpc.CallOption) (*CallTemplateFunctionResponse, error) {
+	out := new(CallTemplateFunctionResponse)
+	err := c.cc.Invoke(ctx, "/proto.Plugin/CallTemplateFunction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PluginServer is the server API for Plugin service.
 // All implementations must embed UnimplementedPluginServer
 // for forward compatibility
 type PluginServer interface {
+	// Called once after the plugin is started to find out which hooks it
+	// implements. The host doesn't call the other hooks. Added in protocol
+	// version 2.
+	GetCapabilities(context.Context, *GetCapabilitiesRequest) (*GetCapabilitiesResponse, error)
+	// Called once after the plugin is started to get its name, version and
+	// description.
+	GetMetadata(context.Context, *GetMetadataRequest) (*PluginMetadata, error)
+	// Called once after the plugin is started with its settings from the
+	// plugins section of evoke.yaml.
+	Configure(context.Context, *ConfigureRequest) (*ConfigureResponse, error)
+	// Called once after the plugin is started with the ID of the Host service
+	// the host serves over the go-plugin broker. Only called if the plugin
+	// reports it in its capabilities.
+	ConnectHost(context.Context, *ConnectHostRequest) (*ConnectHostResponse, error)
 	// Called once before the entire build process begins.
 	// Useful for setup tasks or pre-build validation.
 	OnPreBuild(context.Context, *PreBuildRequest) (*PreBuildResponse, error)
@@ -152,17 +296,34 @@ type PluginServer interface {
 	// Allows modification of the raw file content.
 	OnContentLoaded(context.Context, *ContentFile) (*ContentFile, error)
 	// Called before the Markdown (or other format) content is rendered to HTML.
+	// The content is the body of the page and the metadata its front matter.
 	// A plugin could use this to implement a custom renderer.
 	OnContentRender(context.Context, *ContentFile) (*ContentFile, error)
 	// Called after content is rendered to HTML but before it's placed in a layout.
-	// Useful for post-processing the core HTML content.
+	// Useful for post-processing the core HTML content. The metadata is
+	// available to the layouts as .Page.
 	OnHTMLRendered(context.Context, *ContentFile) (*ContentFile, error)
+	// Batched variants of the content hooks, which process many files in one
+	// call. The host uses them when the plugin reports them in its
+	// capabilities.
+	OnContentLoadedBatch(context.Context, *ContentFileBatch) (*ContentFileBatchResponse, error)
+	OnContentRenderBatch(context.Context, *ContentFileBatch) (*ContentFileBatchResponse, error)
+	OnHTMLRenderedBatch(context.Context, *ContentFileBatch) (*ContentFileBatchResponse, error)
 	// Called once after all content has been processed and written to disk.
 	OnPostBuild(context.Context, *PostBuildRequest) (*PostBuildResponse, error)
 	// Called to register custom pipelines.
 	RegisterPipelines(context.Context, *RegisterPipelinesRequest) (*RegisterPipelinesResponse, error)
 	// Called to process an asset with a custom pipeline.
 	ProcessAsset(context.Context, *Asset) (*Asset, error)
+	// Batched variant of ProcessAsset, which processes many assets in one call.
+	ProcessAssetBatch(context.Context, *AssetBatch) (*AssetBatchResponse, error)
+	// Called before the content is processed to add pages that don't exist in
+	// the content directory.
+	GeneratePages(context.Context, *GeneratePagesRequest) (*GeneratePagesResponse, error)
+	// Called to register functions that templates can call.
+	RegisterTemplateFunctions(context.Context, *RegisterTemplateFunctionsRequest) (*RegisterTemplateFunctionsResponse, error)
+	// Called when a template calls a function registered by the plugin.
+	CallTemplateFunction(context.Context, *CallTemplateFunctionRequest) (*CallTemplateFunctionResponse, error)
 	mustEmbedUnimplementedPluginServer()
 }
 
@@ -170,6 +331,18 @@ type PluginServer interface {
 type UnimplementedPluginServer struct {
 }
 
+func (UnimplementedPluginServer) GetCapabilities(context.Context, *GetCapabilitiesRequest) (*GetCapabilitiesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCapabilities not implemented")
+}
+func (UnimplementedPluginServer) GetMetadata(context.Context, *GetMetadataRequest) (*PluginMetadata, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMetadata not implemented")
+}
+func (UnimplementedPluginServer) Configure(context.Context, *ConfigureRequest) (*ConfigureResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Configure not implemented")
+}
+func (UnimplementedPluginServer) ConnectHost(context.Context, *ConnectHostRequest) (*ConnectHostResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConnectHost not implemented")
+}
 func (UnimplementedPluginServer) OnPreBuild(context.Context, *PreBuildRequest) (*PreBuildResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method OnPreBuild not implemented")
 }
@@ -188,6 +361,15 @@ func (UnimplementedPluginServer) OnContentRender(context.Context, *ContentFile)
 func (UnimplementedPluginServer) OnHTMLRendered(context.Context, *ContentFile) (*ContentFile, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method OnHTMLRendered not implemented")
 }
+func (UnimplementedPluginServer) OnContentLoadedBatch(context.Context, *ContentFileBatch) (*ContentFileBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method OnContentLoadedBatch not implemented")
+}
+func (UnimplementedPluginServer) OnContentRenderBatch(context.Context, *ContentFileBatch) (*ContentFileBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method OnContentRenderBatch not implemented")
+}
+func (UnimplementedPluginServer) OnHTMLRenderedBatch(context.Context, *ContentFileBatch) (*ContentFileBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method OnHTMLRenderedBatch not implemented")
+}
 func (UnimplementedPluginServer) OnPostBuild(context.Context, *PostBuildRequest) (*PostBuildResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method OnPostBuild not implemented")
 }
@@ -197,6 +379,18 @@ func (UnimplementedPluginServer) RegisterPipelines(context.Context, *RegisterPip
 func (UnimplementedPluginServer) ProcessAsset(context.Context, *Asset) (*Asset, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ProcessAsset not implemented")
 }
+func (UnimplementedPluginServer) ProcessAssetBatch(context.Context, *AssetBatch) (*AssetBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ProcessAssetBatch not implemented")
+}
+func (UnimplementedPluginServer) GeneratePages(context.Context, *GeneratePagesRequest) (*GeneratePagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GeneratePages not implemented")
+}
+func (UnimplementedPluginServer) RegisterTemplateFunctions(context.Context, *RegisterTemplateFunctionsRequest) (*RegisterTemplateFunctionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterTemplateFunctions not implemented")
+}
+func (UnimplementedPluginServer) CallTemplateFunction(context.Context, *CallTemplateFunctionRequest) (*CallTemplateFunctionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CallTemplateFunction not implemented")
+}
 func (UnimplementedPluginServer) mustEmbedUnimplementedPluginServer() {}
 
 // UnsafePluginServer may be embedded to opt out of forward compatibility for this service.
@@ -210,6 +404,78 @@ func RegisterPluginServer(s grpc.ServiceRegistrar, srv PluginServer) {
 	s.RegisterService(&Plugin_ServiceDesc, srv)
 }
 
+func _Plugin_GetCapabilities_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCapabilitiesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).GetCapabilities(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Plugin/GetCapabilities",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).GetCapabilities(ctx, req.(*GetCapabilitiesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Plugin_GetMetadata_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMetadataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).GetMetadata(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Plugin/GetMetadata",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).GetMetadata(ctx, req.(*GetMetadataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Plugin_Configure_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfigureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).Configure(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Plugin/Configure",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).Configure(ctx, req.(*ConfigureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Plugin_ConnectHost_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConnectHostRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).ConnectHost(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Plugin/ConnectHost",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).ConnectHost(ctx, req.(*ConnectHostRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Plugin_OnPreBuild_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(PreBuildRequest)
 	if err := dec(in); err != nil {
@@ -318,6 +584,60 @@ func _Plugin_OnHTMLRendered_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Plugin_OnContentLoadedBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ContentFileBatch)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).OnContentLoadedBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Plugin/OnContentLoadedBatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).OnContentLoadedBatch(ctx, req.(*ContentFileBatch))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Plugin_OnContentRenderBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ContentFileBatch)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).OnContentRenderBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Plugin/OnContentRenderBatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).OnContentRenderBatch(ctx, req.(*ContentFileBatch))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Plugin_OnHTMLRenderedBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ContentFileBatch)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).OnHTMLRenderedBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Plugin/OnHTMLRenderedBatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).OnHTMLRenderedBatch(ctx, req.(*ContentFileBatch))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Plugin_OnPostBuild_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(PostBuildRequest)
 	if err := dec(in); err != nil {
@@ -372,6 +692,78 @@ func _Plugin_ProcessAsset_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Plugin_ProcessAssetBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AssetBatch)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).ProcessAssetBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Plugin/ProcessAssetBatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).ProcessAssetBatch(ctx, req.(*AssetBatch))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Plugin_GeneratePages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GeneratePagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).GeneratePages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Plugin/GeneratePages",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).GeneratePages(ctx, req.(*GeneratePagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Plugin_RegisterTemplateFunctions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterTemplateFunctionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).RegisterTemplateFunctions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Plugin/RegisterTemplateFunctions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).RegisterTemplateFunctions(ctx, req.(*RegisterTemplateFunctionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Plugin_CallTemplateFunction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CallTemplateFunctionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginServer).CallTemplateFunction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Plugin/CallTemplateFunction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginServer).CallTemplateFunction(ctx, req.(*CallTemplateFunctionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Plugin_ServiceDesc is the grpc.ServiceDesc for Plugin service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -379,6 +771,22 @@ var Plugin_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "proto.Plugin",
 	HandlerType: (*PluginServer)(nil),
 	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetCapabilities",
+			Handler:    _Plugin_GetCapabilities_Handler,
+		},
+		{
+			MethodName: "GetMetadata",
+			Handler:    _Plugin_GetMetadata_Handler,
+		},
+		{
+			MethodName: "Configure",
+			Handler:    _Plugin_Configure_Handler,
+		},
+		{
+			MethodName: "ConnectHost",
+			Handler:    _Plugin_ConnectHost_Handler,
+		},
 		{
 			MethodName: "OnPreBuild",
 			Handler:    _Plugin_OnPreBuild_Handler,
@@ -403,6 +811,18 @@ var Plugin_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "OnHTMLRendered",
 			Handler:    _Plugin_OnHTMLRendered_Handler,
 		},
+		{
+			MethodName: "OnContentLoadedBatch",
+			Handler:    _Plugin_OnContentLoadedBatch_Handler,
+		},
+		{
+			MethodName: "OnContentRenderBatch",
+			Handler:    _Plugin_OnContentRenderBatch_Handler,
+		},
+		{
+			MethodName: "OnHTMLRenderedBatch",
+			Handler:    _Plugin_OnHTMLRenderedBatch_Handler,
+		},
 		{
 			MethodName: "OnPostBuild",
 			Handler:    _Plugin_OnPostBuild_Handler,
@@ -415,6 +835,304 @@ var Plugin_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ProcessAsset",
 			Handler:    _Plugin_ProcessAsset_Handler,
 		},
+		{
+			MethodName: "ProcessAssetBatch",
+			Handler:    _Plugin_ProcessAssetBatch_Handler,
+		},
+		{
+			MethodName: "GeneratePages",
+			Handler:    _Plugin_GeneratePages_Handler,
+		},
+		{
+			MethodName: "RegisterTemplateFunctions",
+			Handler:    _Plugin_RegisterTemplateFunctions_Handler,
+		},
+		{
+			MethodName: "CallTemplateFunction",
+			Handler:    _Plugin_CallTemplateFunction_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/plugin.proto",
+}
+
+// HostClient is the client API for Host service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type HostClient interface {
+	// Returns the page generated from the source file at the given path.
+	GetPage(ctx context.Context, in *GetPageRequest, opts ...grpc.CallOption) (*Page, error)
+	// Returns the published pages of the site.
+	ListPages(ctx context.Context, in *ListPagesRequest, opts ...grpc.CallOption) (*ListPagesResponse, error)
+	// Returns the configuration of the site.
+	GetConfig(ctx context.Context, in *GetConfigRequest, opts ...grpc.CallOption) (*GetConfigResponse, error)
+	// Returns the URL of the page generated from the source file at the given
+	// path.
+	ResolveURL(ctx context.Context, in *ResolveURLRequest, opts ...grpc.CallOption) (*ResolveURLResponse, error)
+	// Logs a message with the host's logger.
+	Log(ctx context.Context, in *LogRequest, opts ...grpc.CallOption) (*LogResponse, error)
+	// Reports a problem found by the plugin. Errors fail the build once it's
+	// done.
+	AddDiagnostic(ctx context.Context, in *Diagnostic, opts ...grpc.CallOption) (*AddDiagnosticResponse, error)
+}
+
+type hostClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewHostClient(cc grpc.ClientConnInterface) HostClient {
+	return &hostClient{cc}
+}
+
+func (c *hostClient) GetPage(ctx context.Context, in *GetPageRequest, opts ...grpc.CallOption) (*Page, error) {
+	out := new(Page)
+	err := c.cc.Invoke(ctx, "/proto.Host/GetPage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hostClient) ListPages(ctx context.Context, in *ListPagesRequest, opts ...grpc.CallOption) (*ListPagesResponse, error) {
+	out := new(ListPagesResponse)
+	err := c.cc.Invoke(ctx, "/proto.Host/ListPages", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hostClient) GetConfig(ctx context.Context, in *GetConfigRequest, opts ...grpc.CallOption) (*GetConfigResponse, error) {
+	out := new(GetConfigResponse)
+	err := c.cc.Invoke(ctx, "/proto.Host/GetConfig", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hostClient) ResolveURL(ctx context.Context, in *ResolveURLRequest, opts ...grpc.CallOption) (*ResolveURLResponse, error) {
+	out := new(ResolveURLResponse)
+	err := c.cc.Invoke(ctx, "/proto.Host/ResolveURL", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hostClient) Log(ctx context.Context, in *LogRequest, opts ...grpc.CallOption) (*LogResponse, error) {
+	out := new(LogResponse)
+	err := c.cc.Invoke(ctx, "/proto.Host/Log", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hostClient) AddDiagnostic(ctx context.Context, in *Diagnostic, opts ...grpc.CallOption) (*AddDiagnosticResponse, error) {
+	out := new(AddDiagnosticResponse)
+	err := c.cc.Invoke(ctx, "/proto.Host/AddDiagnostic", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// HostServer is the server API for Host service.
+// All implementations must embed UnimplementedHostServer
+// for forward compatibility
+type HostServer interface {
+	// Returns the page generated from the source file at the given path.
+	GetPage(context.Context, *GetPageRequest) (*Page, error)
+	// Returns the published pages of the site.
+	ListPages(context.Context, *ListPagesRequest) (*ListPagesResponse, error)
+	// Returns the configuration of the site.
+	GetConfig(context.Context, *GetConfigRequest) (*GetConfigResponse, error)
+	// Returns the URL of the page generated from the source file at the given
+	// path.
+	ResolveURL(context.Context, *ResolveURLRequest) (*ResolveURLResponse, error)
+	// Logs a message with the host's logger.
+	Log(context.Context, *LogRequest) (*LogResponse, error)
+	// Reports a problem found by the plugin. Errors fail the build once it's
+	// done.
+	AddDiagnostic(context.Context, *Diagnostic) (*AddDiagnosticResponse, error)
+	mustEmbedUnimplementedHostServer()
+}
+
+// UnimplementedHostServer must be embedded to have forward compatible implementations.
+type UnimplementedHostServer struct {
+}
+
+func (UnimplementedHostServer) GetPage(context.Context, *GetPageRequest) (*Page, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPage not implemented")
+}
+func (UnimplementedHostServer) ListPages(context.Context, *ListPagesRequest) (*ListPagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPages not implemented")
+}
+func (UnimplementedHostServer) GetConfig(context.Context, *GetConfigRequest) (*GetConfigResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetConfig not implemented")
+}
+func (UnimplementedHostServer) ResolveURL(context.Context, *ResolveURLRequest) (*ResolveURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResolveURL not implemented")
+}
+func (UnimplementedHostServer) Log(context.Context, *LogRequest) (*LogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Log not implemented")
+}
+func (UnimplementedHostServer) AddDiagnostic(context.Context, *Diagnostic) (*AddDiagnosticResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddDiagnostic not implemented")
+}
+func (UnimplementedHostServer) mustEmbedUnimplementedHostServer() {}
+
+// UnsafeHostServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to HostServer will
+// result in compilation errors.
+type UnsafeHostServer interface {
+	mustEmbedUnimplementedHostServer()
+}
+
+func RegisterHostServer(s grpc.ServiceRegistrar, srv HostServer) {
+	s.RegisterService(&Host_ServiceDesc, srv)
+}
+
+func _Host_GetPage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HostServer).GetPage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Host/GetPage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HostServer).GetPage(ctx, req.(*GetPageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Host_ListPages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HostServer).ListPages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Host/ListPages",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HostServer).ListPages(ctx, req.(*ListPagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Host_GetConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HostServer).GetConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Host/GetConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HostServer).GetConfig(ctx, req.(*GetConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Host_ResolveURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolveURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HostServer).ResolveURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Host/ResolveURL",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HostServer).ResolveURL(ctx, req.(*ResolveURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Host_Log_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HostServer).Log(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Host/Log",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HostServer).Log(ctx, req.(*LogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Host_AddDiagnostic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Diagnostic)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HostServer).AddDiagnostic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Host/AddDiagnostic",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HostServer).AddDiagnostic(ctx, req.(*Diagnostic))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Host_ServiceDesc is the grpc.ServiceDesc for Host service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Host_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Host",
+	HandlerType: (*HostServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetPage",
+			Handler:    _Host_GetPage_Handler,
+		},
+		{
+			MethodName: "ListPages",
+			Handler:    _Host_ListPages_Handler,
+		},
+		{
+			MethodName: "GetConfig",
+			Handler:    _Host_GetConfig_Handler,
+		},
+		{
+			MethodName: "ResolveURL",
+			Handler:    _Host_ResolveURL_Handler,
+		},
+		{
+			MethodName: "Log",
+			Handler:    _Host_Log_Handler,
+		},
+		{
+			MethodName: "AddDiagnostic",
+			Handler:    _Host_AddDiagnostic_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/plugin.proto",